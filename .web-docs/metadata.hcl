@@ -18,9 +18,34 @@ integration {
     name = "Oxide Instance"
     slug = "instance"
   }
+  component {
+    type = "builder"
+    name = "Oxide ISO"
+    slug = "iso"
+  }
   component {
     type = "data-source"
     name = "Oxide Image"
     slug = "image"
   }
+  component {
+    type = "data-source"
+    name = "Oxide Images"
+    slug = "images"
+  }
+  component {
+    type = "post-processor"
+    name = "Oxide Image Copy"
+    slug = "image-copy"
+  }
+  component {
+    type = "post-processor"
+    name = "Oxide Image Prune"
+    slug = "image-prune"
+  }
+  component {
+    type = "post-processor"
+    name = "Oxide Import"
+    slug = "import"
+  }
 }
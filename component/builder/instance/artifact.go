@@ -5,8 +5,10 @@
 package instance
 
 import (
+	"cmp"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
@@ -14,22 +16,51 @@ import (
 
 var _ packer.Artifact = (*Artifact)(nil)
 
-// Artifact represents the Oxide image created by the builder. This artifact
-// contains the image ID and name that can be used to launch new instances.
+// Artifact represents the Oxide images created by the builder. This artifact
+// contains the image ID and name of the boot disk image that can be used to
+// launch new instances, along with the images created from additional disks.
 type Artifact struct {
 	// Unique identifier of the created image.
 	ImageID string
 	// Name of the created image.
 	ImageName string
+	// Whether the created image was promoted to a silo image.
+	Silo bool
+	// Images created from additional disks, in the order the disks are
+	// configured.
+	DiskImages []DiskImage
 	// Unique identifier of the source image used to create this artifact.
 	SourceImageID string
 	// Additional state data associated with the build.
 	StateData map[string]any
+
+	// ID of the builder that created the artifact, when it's not this one.
+	builderID string
+}
+
+// DiskImage is an Oxide image created from an additional disk.
+type DiskImage struct {
+	// Name of the disk the image was created from.
+	Disk string
+	// Unique identifier of the created image.
+	ImageID string
+	// Name of the created image.
+	ImageName string
+}
+
+// NewArtifact returns an artifact for the image imageID named imageName,
+// attributed to the builder or post-processor with ID builderID.
+func NewArtifact(builderID, imageID, imageName string) *Artifact {
+	return &Artifact{
+		ImageID:   imageID,
+		ImageName: imageName,
+		builderID: builderID,
+	}
 }
 
 // BuilderId returns the builder ID used to create this artifact.
-func (*Artifact) BuilderId() string {
-	return BuilderID
+func (a *Artifact) BuilderId() string {
+	return cmp.Or(a.builderID, BuilderID)
 }
 
 // Files returns the files associated with the artifact.
@@ -44,11 +75,46 @@ func (a *Artifact) Id() string {
 
 // String returns a description of the artifact.
 func (a *Artifact) String() string {
-	return fmt.Sprintf("%s (%s)", a.ImageName, a.ImageID)
+	image := fmt.Sprintf("%s (%s)", a.ImageName, a.ImageID)
+	if a.Silo {
+		image = fmt.Sprintf("%s (%s) in silo", a.ImageName, a.ImageID)
+	}
+
+	if len(a.DiskImages) == 0 {
+		return image
+	}
+
+	images := []string{image}
+	for _, image := range a.DiskImages {
+		images = append(
+			images,
+			fmt.Sprintf("%s (%s) from disk %s", image.ImageName, image.ImageID, image.Disk),
+		)
+	}
+
+	return strings.Join(images, ", ")
 }
 
-// State returns builder state related to the artifact.
+// State returns builder state related to the artifact. The `image_ids` state
+// contains the IDs of every created image, starting with the boot disk image,
+// and `disk_image_ids` maps the name of each additional disk to the ID of the
+// image created from it.
 func (a *Artifact) State(name string) any {
+	switch name {
+	case "image_ids":
+		imageIDs := []string{a.ImageID}
+		for _, image := range a.DiskImages {
+			imageIDs = append(imageIDs, image.ImageID)
+		}
+		return imageIDs
+	case "disk_image_ids":
+		diskImageIDs := make(map[string]string, len(a.DiskImages))
+		for _, image := range a.DiskImages {
+			diskImageIDs[image.Disk] = image.ImageID
+		}
+		return diskImageIDs
+	}
+
 	if name == registryimage.ArtifactStateURI {
 		img, err := registryimage.FromArtifact(a,
 			registryimage.WithProvider("oxide"),
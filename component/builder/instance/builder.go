@@ -9,6 +9,7 @@ package instance
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
@@ -24,14 +25,14 @@ var _ packer.Builder = (*Builder)(nil)
 
 // The `oxide-instance` builder creates custom images for use with [Oxide](https://oxide.computer).
 // The builder launches a temporary instance from an existing source image, connects to the instance
-// using its external IP, provisions the instance, and then creates a new image from the instance's
-// boot disk. The resulting image can be used to launch new instances on Oxide.
+// using its external IP, private IP, or serial console, provisions the instance, and then creates a
+// new image from the instance's boot disk. The resulting image can be used to launch new instances
+// on Oxide.
 //
 // The builder does not manage images. Once it creates an image, it is up to you
 // to use it or delete it.
 type Builder struct {
 	config Config
-	runner multistep.Runner
 }
 
 // ConfigSpec returns the HCL configuration specification for the builder.
@@ -55,70 +56,123 @@ func (b *Builder) Run(
 	ui packer.Ui,
 	hook packer.Hook,
 ) (packer.Artifact, error) {
-	opts := make([]oxide.ClientOption, 0)
-	if b.config.Host != "" {
-		opts = append(opts, oxide.WithHost(b.config.Host))
-	}
-	if b.config.Token != "" {
-		opts = append(opts, oxide.WithToken(b.config.Token))
-	}
-	if b.config.Profile != "" {
-		opts = append(opts, oxide.WithProfile(b.config.Profile))
-	}
-	if b.config.InsecureSkipVerify {
-		opts = append(opts, oxide.WithInsecureSkipVerify())
-	}
-	oxideClient, err := oxide.NewClient(opts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed creating oxide client: %w", err)
+	steps := BuildSteps(
+		&b.config,
+		[]multistep.Step{&stepImageView{}},
+		[]multistep.Step{
+			multistep.If(b.config.BootDiskSource != "", &stepBootDiskSnapshotCreate{}),
+		},
+	)
+
+	return RunBuild(ctx, ui, hook, BuilderID, &b.config, steps)
+}
+
+// BuildSteps returns the steps to create an Oxide image by provisioning a
+// temporary instance configured by config. The source steps run first to look
+// up what the boot disk is created from, and the boot disk steps run right
+// before the instance is created to prepare its disks.
+func BuildSteps(
+	config *Config,
+	sourceSteps []multistep.Step,
+	bootDiskSteps []multistep.Step,
+) []multistep.Step {
+	// The serial communicator connects over the serial console rather than the
+	// network, so it needs neither an SSH key pair nor an IP to connect to.
+	serialComm := config.Comm.Type == serialCommunicatorType
+
+	// Only look up the IP to connect to when a communicator connects over the
+	// network. With `communicator = "none"`, the instance may have no IP at all.
+	hostComm := !serialComm && config.Comm.Type != "none"
+
+	hostKey := "external_ip"
+	if config.SSHInterface == sshInterfacePrivate {
+		hostKey = "private_ip"
 	}
 
 	// Only generate a temporary SSH key pair if the user has not configured SSH.
-	genTempSSHKeyPair := b.config.Comm.SSHPassword == "" &&
-		b.config.Comm.SSHPrivateKeyFile == "" &&
-		!b.config.Comm.SSHAgentAuth
-
-	steps := []multistep.Step{
-		&stepImageView{},
-		multistep.If(!b.config.SkipCreateImage, &stepArtifactValidate{}),
+	genTempSSHKeyPair := !serialComm &&
+		config.Comm.SSHPassword == "" &&
+		config.Comm.SSHPrivateKeyFile == "" &&
+		!config.Comm.SSHAgentAuth
+
+	steps := slices.Clone(sourceSteps)
+	steps = append(steps,
+		multistep.If(!config.SkipCreateImage, &stepArtifactValidate{}),
 		multistep.If(genTempSSHKeyPair, &communicator.StepSSHKeyGen{
-			CommConf:            &b.config.Comm,
-			SSHTemporaryKeyPair: b.config.Comm.SSHTemporaryKeyPair,
+			CommConf:            &config.Comm,
+			SSHTemporaryKeyPair: config.Comm.SSHTemporaryKeyPair,
 		}),
-		multistep.If(b.config.PackerDebug && genTempSSHKeyPair,
+		multistep.If(config.PackerDebug && genTempSSHKeyPair,
 			&communicator.StepDumpSSHKey{
-				Path: fmt.Sprintf("oxide-packer-plugin-%s.pem", b.config.PackerBuildName),
-				SSH:  &b.config.Comm.SSH,
+				Path: fmt.Sprintf("oxide-packer-plugin-%s.pem", config.PackerBuildName),
+				SSH:  &config.Comm.SSH,
 			},
 		),
 		multistep.If(genTempSSHKeyPair, &stepSSHKeyCreate{}),
+		multistep.If(config.CreateFloatingIP, &stepFloatingIPCreate{}),
+	)
+	steps = append(steps, bootDiskSteps...)
+	steps = append(steps,
+		multistep.If(config.TemporaryNetwork, &stepNetworkCreate{}),
+		multistep.If(config.TemporaryFirewallRule, &stepFirewallRuleCreate{}),
 		&stepInstanceCreate{},
-		&stepInstanceExternalIPList{},
+		multistep.If(len(config.BootCommand) > 0, &stepTypeBootCommand{}),
+		multistep.If(
+			hostComm && config.SSHInterface == sshInterfaceExternal,
+			&stepInstanceExternalIPList{},
+		),
+		multistep.If(
+			hostComm && config.SSHInterface == sshInterfacePrivate,
+			&stepInstanceNetworkInterfaceList{},
+		),
 		&communicator.StepConnect{
-			Config:    &b.config.Comm,
-			Host:      communicator.CommHost(b.config.Comm.Host(), "external_ip"),
-			SSHConfig: b.config.Comm.SSHConfigFunc(),
+			Config:    &config.Comm,
+			Host:      communicator.CommHost(config.Comm.Host(), hostKey),
+			SSHConfig: config.Comm.SSHConfigFunc(),
+			CustomConnect: map[string]multistep.Step{
+				serialCommunicatorType: &stepConnectSerial{},
+			},
 		},
 		&commonsteps.StepProvision{},
+		multistep.If(config.WaitForSerialPattern != "", &stepWaitForSerialPattern{}),
 		&stepInstanceStop{},
-		multistep.If(!b.config.SkipCreateImage, &stepSnapshotCreate{}),
-		multistep.If(!b.config.SkipCreateImage, &stepImageCreate{}),
+		multistep.If(!config.SkipCreateImage, &stepSnapshotCreate{}),
+		multistep.If(!config.SkipCreateImage, &stepImageCreate{}),
+		multistep.If(config.PromoteToSilo, &stepImagePromote{}),
+	)
+
+	return steps
+}
+
+// RunBuild runs steps with config and returns an artifact for the images they
+// created, attributed to the builder with ID builderID.
+func RunBuild(
+	ctx context.Context,
+	ui packer.Ui,
+	hook packer.Hook,
+	builderID string,
+	config *Config,
+	steps []multistep.Step,
+) (packer.Artifact, error) {
+	oxideClient, err := oxide.NewClient(config.clientOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating oxide client: %w", err)
 	}
 
 	stateBag := &multistep.BasicStateBag{}
 	stateBag.Put("hook", hook)
 	stateBag.Put("ui", ui)
 	stateBag.Put("client", oxideClient)
-	stateBag.Put("config", &b.config)
+	stateBag.Put("config", config)
 
-	b.runner = commonsteps.NewRunner(steps, b.config.PackerConfig, ui)
-	b.runner.Run(ctx, stateBag)
+	runner := commonsteps.NewRunner(steps, config.PackerConfig, ui)
+	runner.Run(ctx, stateBag)
 
 	if err, ok := stateBag.GetOk("error"); ok {
 		return nil, err.(error)
 	}
 
-	if b.config.SkipCreateImage {
+	if config.SkipCreateImage {
 		ui.Say("Skipping image creation since skip_create_image is set.")
 	}
 
@@ -130,9 +184,21 @@ func (b *Builder) Run(
 	}
 
 	artifact := &Artifact{
-		ImageID:       stateBag.Get("image_id").(string),
-		ImageName:     stateBag.Get("image_name").(string),
-		SourceImageID: stateBag.Get("source_image_id").(string),
+		ImageID:   stateBag.Get("image_id").(string),
+		ImageName: stateBag.Get("image_name").(string),
+		builderID: builderID,
+	}
+
+	if _, ok := stateBag.GetOk("image_silo"); ok {
+		artifact.Silo = true
+	}
+
+	if sourceImageID, ok := stateBag.GetOk("source_image_id"); ok {
+		artifact.SourceImageID = sourceImageID.(string)
+	}
+
+	if diskImages, ok := stateBag.GetOk("disk_images"); ok {
+		artifact.DiskImages = diskImages.([]DiskImage)
 	}
 
 	return artifact, nil
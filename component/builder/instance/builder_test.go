@@ -5,6 +5,8 @@
 package instance_test
 
 import (
+	"bytes"
+	"context"
 	"embed"
 	"errors"
 	"fmt"
@@ -17,7 +19,10 @@ import (
 	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/acctest"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/builder/instance"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxidetest"
 )
 
 //go:embed testdata/*.pkr.hcl.tmpl
@@ -268,6 +273,813 @@ func TestAccBuilder_Instance(t *testing.T) {
 	}
 }
 
+// newTestBuilder returns a builder prepared to run against server using a
+// freshly seeded source image. The configuration is merged over the defaults.
+func newTestBuilder(
+	t *testing.T,
+	server *oxidetest.Server,
+	config map[string]any,
+) (*instance.Builder, oxide.Image) {
+	t.Helper()
+
+	sourceImage := server.CreateImage("", oxide.Image{
+		Name:    "noble",
+		Os:      "ubuntu",
+		Version: "24.04",
+	})
+
+	b := oxidetest.Prepare[instance.Builder](t, server, map[string]any{
+		"project":             "test-project",
+		"boot_disk_image_id":  sourceImage.Id,
+		"communicator":        "none",
+		"packer_build_name":   "test",
+		"packer_builder_type": "oxide-instance",
+	}, config)
+
+	return b, sourceImage
+}
+
+// commandHook is a [packer.Hook] that runs a command with the communicator
+// during provisioning, like a shell provisioner.
+type commandHook struct {
+	command string
+	stdout  bytes.Buffer
+}
+
+func (h *commandHook) Run(
+	ctx context.Context,
+	name string,
+	ui packer.Ui,
+	comm packer.Communicator,
+	_ any,
+) error {
+	if name != packer.HookProvision {
+		return nil
+	}
+
+	cmd := &packer.RemoteCmd{Command: h.command, Stdout: &h.stdout}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return err
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		return fmt.Errorf("command exited with status %d", status)
+	}
+
+	return nil
+}
+
+// TestBuilder_Run tests the full builder pipeline against a fake Oxide API.
+func TestBuilder_Run(t *testing.T) {
+	t.Run("CreatesImage", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"artifact_name": "artifact",
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if artifact == nil {
+			t.Fatal("expected artifact")
+		}
+
+		if artifact.String() != fmt.Sprintf("artifact (%s)", artifact.Id()) {
+			t.Errorf("unexpected artifact: %s", artifact.String())
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("WaitsForSerialPattern", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.SerialConsoleOutput = "Cloud-init v. 24.1 finished\r\n"
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"wait_for_serial_pattern": "Cloud-init .* finished",
+			"poll_interval":           "1ms",
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := server.Calls("InstanceSerialConsole"); n == 0 {
+			t.Error("expected serial console to be read")
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("TypesBootCommand", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"boot_command":           []string{"root<enter>"},
+			"boot_wait":              "-1s",
+			"boot_keygroup_interval": "1ms",
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := server.Calls("InstanceSerialConsoleStream"); n != 1 {
+			t.Errorf("expected 1 serial console connection, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("ProvisionsOverSerialConsole", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.SerialConsoleGuest = oxidetest.ShellGuest("packer", "hunter2")
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"communicator":    "oxide-serial",
+			"serial_username": "packer",
+			"serial_password": "hunter2",
+		})
+		if got := packer.LogSecretFilter.FilterString("hunter2"); got == "hunter2" {
+			t.Error("expected serial_password to be filtered from logs")
+		}
+
+		hook := &commandHook{command: "echo provisioned"}
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), hook)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := strings.TrimSpace(hook.stdout.String()); got != "provisioned" {
+			t.Errorf("expected provisioner output %q, got %q", "provisioned", got)
+		}
+		for _, operation := range []string{"CurrentUserSshKeyCreate", "InstanceExternalIpList"} {
+			if n := server.Calls(operation); n != 0 {
+				t.Errorf("expected no %s calls, got %d", operation, n)
+			}
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("LooksUpPrivateIP", func(t *testing.T) {
+		// Fail the lookup so the build stops before connecting over SSH, which
+		// the fake can't serve.
+		server := oxidetest.NewServer(t)
+		server.Fail("InstanceNetworkInterfaceList", 1, oxidetest.Fault{})
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"communicator":  "ssh",
+			"ssh_username":  "ubuntu",
+			"ssh_interface": "private",
+		})
+
+		if _, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{}); err == nil {
+			t.Fatal("expected error")
+		}
+		if n := server.Calls("InstanceNetworkInterfaceList"); n != 1 {
+			t.Errorf("expected 1 network interface list, got %d", n)
+		}
+		if n := server.Calls("InstanceExternalIpList"); n != 0 {
+			t.Errorf("expected no external IP lists, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id)
+	})
+
+	t.Run("RejectsInvalidSSHInterface", func(t *testing.T) {
+		var b instance.Builder
+		_, _, err := b.Prepare(map[string]any{
+			"project":            "test-project",
+			"boot_disk_image_id": "test-boot-disk-image-id",
+			"ssh_interface":      "public",
+		})
+		if err == nil || !strings.Contains(err.Error(), "ssh_interface must be one of") {
+			t.Errorf("expected ssh_interface error, got %v", err)
+		}
+	})
+
+	t.Run("RequiresExternalIPForExternalInterface", func(t *testing.T) {
+		var b instance.Builder
+		_, _, err := b.Prepare(map[string]any{
+			"project":               "test-project",
+			"boot_disk_image_id":    "test-boot-disk-image-id",
+			"ssh_username":          "ubuntu",
+			"associate_external_ip": false,
+		})
+		if err == nil || !strings.Contains(err.Error(), "associate_external_ip must be true") {
+			t.Errorf("expected associate_external_ip error, got %v", err)
+		}
+	})
+
+	t.Run("AttachesFloatingIP", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateFloatingIP("test-project", oxide.FloatingIp{Name: "fixed"})
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"floating_ip": "fixed",
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		floatingIPs := server.FloatingIPs()
+		if len(floatingIPs) != 1 || floatingIPs[0].Id != existing.Id {
+			t.Fatalf("expected only the existing floating IP, got %v", floatingIPs)
+		}
+		if floatingIPs[0].InstanceId != "" {
+			t.Errorf("expected floating IP to be detached, got %s", floatingIPs[0].InstanceId)
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("CreatesFloatingIP", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"create_floating_ip": true,
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := server.Calls("FloatingIpCreate"); n != 1 {
+			t.Errorf("expected 1 floating IP to be created, got %d", n)
+		}
+		if n := len(server.FloatingIPs()); n != 0 {
+			t.Errorf("expected no floating IPs, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("CreatesTemporaryNetwork", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"temporary_network": true,
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := server.Calls("VpcCreate"); n != 1 {
+			t.Errorf("expected 1 VPC to be created, got %d", n)
+		}
+		if n := server.Calls("VpcSubnetCreate"); n != 1 {
+			t.Errorf("expected 1 VPC subnet to be created, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("RejectsInvalidTemporaryNetworkIPv4Block", func(t *testing.T) {
+		var b instance.Builder
+		_, _, err := b.Prepare(map[string]any{
+			"project":                      "test-project",
+			"boot_disk_image_id":           "test-boot-disk-image-id",
+			"temporary_network":            true,
+			"temporary_network_ipv4_block": "2001:db8::/64",
+		})
+		if err == nil || !strings.Contains(err.Error(), "temporary_network_ipv4_block") {
+			t.Errorf("expected temporary_network_ipv4_block error, got %v", err)
+		}
+	})
+
+	t.Run("AttachesDataDisks", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		dataImage := server.CreateImage("test-project", oxide.Image{Name: "data"})
+		seed := server.CreateDisk("test-project", oxide.Disk{Name: "seed", Size: 1024})
+		b, _ := newTestBuilder(t, server, map[string]any{
+			"disk": []map[string]any{
+				{"name": "scratch", "size": 1024},
+				{"name": "data", "size": 1024, "image_id": dataImage.Id},
+				{"name": "seed", "existing": true},
+			},
+		})
+
+		if _, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if n := len(server.Instances()); n != 0 {
+			t.Errorf("expected no instances, got %d", n)
+		}
+		disks := server.Disks()
+		if len(disks) != 1 || disks[0].Id != seed.Id {
+			t.Errorf("expected only existing disk %s to remain, got %v", seed.Name, disks)
+		}
+		if state := disks[0].State.State(); state != oxide.DiskStateStateDetached {
+			t.Errorf("expected existing disk to be detached, got %s", state)
+		}
+	})
+
+	t.Run("CreatesDiskImages", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"disk": []map[string]any{
+				{"name": "scratch", "size": 1024},
+				{
+					"name": "data",
+					"size": 1024,
+					"image": map[string]any{
+						"name":    "appliance-data",
+						"version": "2.0",
+					},
+				},
+			},
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		imageIDs, ok := artifact.State("image_ids").([]string)
+		if !ok || len(imageIDs) != 2 || imageIDs[0] != artifact.Id() {
+			t.Fatalf("expected image_ids with boot and data disk images, got %v", imageIDs)
+		}
+		diskImageIDs := artifact.State("disk_image_ids").(map[string]string)
+		if diskImageIDs["data"] != imageIDs[1] {
+			t.Errorf("expected disk_image_ids[data] %q, got %v", imageIDs[1], diskImageIDs)
+		}
+
+		var dataImage oxide.Image
+		for _, image := range server.Images() {
+			if image.Id == imageIDs[1] {
+				dataImage = image
+			}
+		}
+		if dataImage.Name != "appliance-data" || dataImage.Version != "2.0" ||
+			dataImage.Os != "ubuntu" {
+			t.Errorf("expected appliance-data image ubuntu 2.0, got %s %s %s",
+				dataImage.Name, dataImage.Os, dataImage.Version)
+		}
+
+		server.AssertNoLeftovers(t, append(imageIDs, sourceImage.Id)...)
+	})
+
+	t.Run("DiskImageNameConflict", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.CreateImage("test-project", oxide.Image{Name: "appliance-data"})
+		b, _ := newTestBuilder(t, server, map[string]any{
+			"disk": []map[string]any{
+				{"name": "data", "size": 1024, "image": map[string]any{"name": "appliance-data"}},
+			},
+		})
+
+		if _, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{}); err == nil {
+			t.Fatal("expected error")
+		}
+		if n := server.Calls("InstanceCreate"); n != 0 {
+			t.Errorf("expected no instance to be created, got %d", n)
+		}
+	})
+
+	t.Run("RejectsInvalidDisk", func(t *testing.T) {
+		var b instance.Builder
+		_, _, err := b.Prepare(map[string]any{
+			"project":            "test-project",
+			"boot_disk_image_id": "test-boot-disk-image-id",
+			"disk": []map[string]any{
+				{"name": "data", "size": 1024, "image_id": "a", "snapshot_id": "b"},
+				{"name": "seed", "existing": true, "delete_on_cleanup": true},
+				{"name": "other", "size": 1024, "image": map[string]any{"name": "artifact"}},
+			},
+			"artifact_name": "artifact",
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		for _, want := range []string{
+			"disk 0: image_id and snapshot_id are mutually exclusive",
+			"disk 1: delete_on_cleanup can't be set for existing disks",
+			`disk 2: image name "artifact" is already used`,
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected error containing %q, got %v", want, err)
+			}
+		}
+	})
+
+	t.Run("BuildsFromSnapshot", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		sourceImage := server.CreateImage("", oxide.Image{
+			Name:    "noble",
+			Os:      "ubuntu",
+			Version: "24.04",
+		})
+		layer := server.CreateDisk("test-project", oxide.Disk{
+			Name:    "layer",
+			ImageId: sourceImage.Id,
+		})
+		snapshot := server.CreateSnapshot("test-project", oxide.Snapshot{
+			Name:        "base-layer",
+			Description: "Base layer",
+			DiskId:      layer.Id,
+		})
+
+		var b instance.Builder
+		if _, _, err := b.Prepare(map[string]any{
+			"host":                  server.URL,
+			"token":                 oxidetest.Token,
+			"project":               "test-project",
+			"boot_disk_snapshot_id": snapshot.Id,
+			"communicator":          "none",
+		}); err != nil {
+			t.Fatalf("failed preparing builder: %v", err)
+		}
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(artifact.String(), "base-layer-") {
+			t.Errorf("expected artifact named after snapshot, got %s", artifact.String())
+		}
+
+		for _, image := range server.Images() {
+			if image.Id == artifact.Id() && (image.Os != "ubuntu" || image.Version != "24.04") {
+				t.Errorf("expected image ubuntu 24.04, got %s %s", image.Os, image.Version)
+			}
+		}
+	})
+
+	t.Run("BuildsFromDisk", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		sourceImage := server.CreateImage("", oxide.Image{
+			Name:    "noble",
+			Os:      "ubuntu",
+			Version: "24.04",
+		})
+		golden := server.CreateDisk("test-project", oxide.Disk{
+			Name:    "golden",
+			ImageId: sourceImage.Id,
+		})
+
+		var b instance.Builder
+		if _, _, err := b.Prepare(map[string]any{
+			"host":             server.URL,
+			"token":            oxidetest.Token,
+			"project":          "test-project",
+			"boot_disk_source": "golden",
+			"communicator":     "none",
+		}); err != nil {
+			t.Fatalf("failed preparing builder: %v", err)
+		}
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(artifact.String(), "golden-") {
+			t.Errorf("expected artifact named after disk, got %s", artifact.String())
+		}
+		if n := server.Calls("SnapshotDelete"); n != 2 {
+			t.Errorf("expected 2 snapshots to be deleted, got %d", n)
+		}
+		if n := len(server.Snapshots()); n != 0 {
+			t.Errorf("expected no snapshots, got %d", n)
+		}
+		disks := server.Disks()
+		if len(disks) != 1 || disks[0].Id != golden.Id {
+			t.Errorf("expected only source disk %s to remain, got %v", golden.Name, disks)
+		}
+	})
+
+	t.Run("RequiresArtifactOSWithoutSourceImage", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		snapshot := server.CreateSnapshot("test-project", oxide.Snapshot{Name: "orphan"})
+
+		var b instance.Builder
+		if _, _, err := b.Prepare(map[string]any{
+			"host":                  server.URL,
+			"token":                 oxidetest.Token,
+			"project":               "test-project",
+			"boot_disk_snapshot_id": snapshot.Id,
+			"communicator":          "none",
+		}); err != nil {
+			t.Fatalf("failed preparing builder: %v", err)
+		}
+
+		_, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err == nil || !strings.Contains(err.Error(), "artifact_os and artifact_version") {
+			t.Errorf("expected artifact_os error, got %v", err)
+		}
+	})
+
+	t.Run("RejectsMultipleBootDiskSources", func(t *testing.T) {
+		var b instance.Builder
+		_, _, err := b.Prepare(map[string]any{
+			"project":               "test-project",
+			"boot_disk_image_id":    "test-boot-disk-image-id",
+			"boot_disk_snapshot_id": "test-boot-disk-snapshot-id",
+		})
+		if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+			t.Errorf("expected boot disk source error, got %v", err)
+		}
+	})
+
+	t.Run("RejectsMultipleFloatingIPs", func(t *testing.T) {
+		var b instance.Builder
+		_, _, err := b.Prepare(map[string]any{
+			"project":            "test-project",
+			"boot_disk_image_id": "test-boot-disk-image-id",
+			"floating_ip":        "fixed",
+			"create_floating_ip": true,
+		})
+		if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+			t.Errorf("expected floating IP error, got %v", err)
+		}
+	})
+
+	t.Run("RejectsInvalidIPVersion", func(t *testing.T) {
+		var b instance.Builder
+		_, _, err := b.Prepare(map[string]any{
+			"project":            "test-project",
+			"boot_disk_image_id": "test-boot-disk-image-id",
+			"ip_version":         "v5",
+		})
+		if err == nil || !strings.Contains(err.Error(), "ip_version must be one of") {
+			t.Errorf("expected ip_version error, got %v", err)
+		}
+	})
+
+	t.Run("RejectsTemporaryFirewallRuleWithoutNetworkCommunicator", func(t *testing.T) {
+		var b instance.Builder
+		_, _, err := b.Prepare(map[string]any{
+			"project":                 "test-project",
+			"boot_disk_image_id":      "test-boot-disk-image-id",
+			"communicator":            "none",
+			"temporary_firewall_rule": true,
+		})
+		if err == nil || !strings.Contains(err.Error(), "requires the ssh or winrm communicator") {
+			t.Errorf("expected temporary_firewall_rule error, got %v", err)
+		}
+	})
+
+	t.Run("RejectsInvalidTemporaryFirewallRuleSourceCIDR", func(t *testing.T) {
+		var b instance.Builder
+		_, _, err := b.Prepare(map[string]any{
+			"project":                              "test-project",
+			"boot_disk_image_id":                   "test-boot-disk-image-id",
+			"ssh_username":                         "ubuntu",
+			"temporary_firewall_rule":              true,
+			"temporary_firewall_rule_source_cidrs": []string{"203.0.113.1"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "invalid CIDR") {
+			t.Errorf("expected source CIDR error, got %v", err)
+		}
+	})
+
+	t.Run("SkipCreateImage", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"skip_create_image": true,
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if artifact != nil {
+			t.Errorf("expected no artifact, got %s", artifact.String())
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id)
+	})
+
+	t.Run("ArtifactNameConflict", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage("test-project", oxide.Image{Name: "artifact"})
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"artifact_name": "artifact",
+		})
+
+		if _, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{}); err == nil {
+			t.Fatal("expected error")
+		}
+
+		if n := server.Calls("InstanceCreate"); n != 0 {
+			t.Errorf("expected no instance create calls, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, existing.Id)
+	})
+
+	t.Run("ForceReplacesArtifact", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage("test-project", oxide.Image{Name: "artifact"})
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"artifact_name": "artifact",
+			"packer_force":  true,
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if artifact.Id() == existing.Id {
+			t.Error("expected existing image to be replaced")
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("PromotesToSilo", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"artifact_name":   "artifact",
+			"promote_to_silo": true,
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if artifact.String() != fmt.Sprintf("artifact (%s) in silo", artifact.Id()) {
+			t.Errorf("unexpected artifact: %s", artifact.String())
+		}
+		for _, v := range server.Images() {
+			if v.Id == artifact.Id() && v.ProjectId != "" {
+				t.Errorf("expected silo image, got project %q", v.ProjectId)
+			}
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("SiloArtifactNameConflict", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage("", oxide.Image{Name: "artifact"})
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"artifact_name":   "artifact",
+			"promote_to_silo": true,
+		})
+
+		if _, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{}); err == nil {
+			t.Fatal("expected error")
+		}
+
+		if n := server.Calls("InstanceCreate"); n != 0 {
+			t.Errorf("expected no instance create calls, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, existing.Id)
+	})
+
+	t.Run("ForceReplacesSiloArtifact", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage("", oxide.Image{Name: "artifact"})
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"artifact_name":   "artifact",
+			"promote_to_silo": true,
+			"packer_force":    true,
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if artifact.Id() == existing.Id {
+			t.Error("expected existing silo image to be replaced")
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("ForceKeepsSiloArtifactOnPromoteFailure", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage("", oxide.Image{Name: "artifact"})
+		server.Fail("ImagePromote", 1, oxidetest.Fault{})
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"artifact_name":   "artifact",
+			"promote_to_silo": true,
+			"packer_force":    true,
+		})
+
+		if _, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{}); err == nil {
+			t.Fatal("expected error")
+		}
+
+		// The project image is kept for the promotion to be retried.
+		var projectImageID string
+		for _, v := range server.Images() {
+			if v.ProjectId == "test-project" {
+				projectImageID = v.Id
+			}
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, existing.Id, projectImageID)
+	})
+
+	// Each case fails a single API operation and checks that the build halts and
+	// cleans up every resource it created before the failure.
+	for _, operation := range []string{
+		"ImageView",
+		"CurrentUserSshKeyCreate",
+		"InstanceCreate",
+		"InstanceView",
+		"InstanceStop",
+		"SnapshotCreate",
+		"ImageCreate",
+	} {
+		t.Run("HaltsOn"+operation, func(t *testing.T) {
+			server := oxidetest.NewServer(t)
+			server.Fail(operation, 1, oxidetest.Fault{})
+			b, sourceImage := newTestBuilder(t, server, nil)
+
+			artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if artifact != nil {
+				t.Errorf("expected no artifact, got %s", artifact.String())
+			}
+			if n := server.Calls(operation); n == 0 {
+				t.Errorf("expected %s to be called", operation)
+			}
+
+			server.AssertNoLeftovers(t, sourceImage.Id)
+		})
+	}
+
+	t.Run("HaltsOnInstanceExternalIpList", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("InstanceExternalIpList", 1, oxidetest.Fault{})
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"communicator": "ssh",
+			"ssh_username": "ubuntu",
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if artifact != nil {
+			t.Errorf("expected no artifact, got %s", artifact.String())
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id)
+	})
+
+	t.Run("SkipsIPLookupWithoutCommunicator", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b, sourceImage := newTestBuilder(t, server, map[string]any{
+			"artifact_name":         "artifact",
+			"associate_external_ip": false,
+		})
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if artifact == nil {
+			t.Fatal("expected artifact")
+		}
+		if n := server.Calls("InstanceExternalIpList"); n != 0 {
+			t.Errorf("expected no external IP lookups, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id, artifact.Id())
+	})
+
+	t.Run("HaltsOnProvisionerError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b, sourceImage := newTestBuilder(t, server, nil)
+
+		hook := &packer.MockHook{
+			RunFunc: func(context.Context) error {
+				return errors.New("provisioner failed")
+			},
+		}
+
+		if _, err := b.Run(t.Context(), packer.TestUi(t), hook); err == nil {
+			t.Fatal("expected error")
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b, sourceImage := newTestBuilder(t, server, nil)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		hook := &packer.MockHook{
+			RunFunc: func(context.Context) error {
+				cancel()
+				return nil
+			},
+		}
+
+		artifact, err := b.Run(ctx, packer.TestUi(t), hook)
+		if err == nil && artifact != nil {
+			t.Fatalf("expected cancelled build to produce no artifact, got %s", artifact.String())
+		}
+
+		server.AssertNoLeftovers(t, sourceImage.Id)
+	})
+}
+
 func assertFileContains(t *testing.T, filename string, expected string) {
 	b, err := os.ReadFile(filename)
 	if err != nil {
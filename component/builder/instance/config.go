@@ -2,23 +2,43 @@
 // License, v. 2.0. If a copy of the MPL was not distributed with this
 // file, You can obtain one at https://mozilla.org/MPL/2.0/.
 
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,DiskConfig,DiskImageConfig
 //go:generate packer-sdc struct-markdown
 
 package instance
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/packer-plugin-sdk/bootcommand"
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/uuid"
 	"github.com/mitchellh/mapstructure"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxideclient"
+)
+
+// Interfaces Packer can connect to the instance through.
+const (
+	sshInterfaceExternal = "external"
+	sshInterfacePrivate  = "private"
+)
+
+// IP versions the instance's networking can be configured with.
+const (
+	ipVersionV4   = "v4"
+	ipVersionV6   = "v6"
+	ipVersionDual = "dual"
 )
 
 // The configuration arguments for the builder. Arguments can either be required or optional.
@@ -29,6 +49,10 @@ type Config struct {
 	// instance for provisioning.
 	Comm communicator.Config `mapstructure:",squash"`
 
+	// Keys to type into the temporary instance's serial console once it's
+	// started, such as those needed to drive an interactive installer.
+	bootcommand.BootConfig `mapstructure:",squash"`
+
 	// Oxide API URL (e.g., `https://oxide.sys.example.com`). If not specified,
 	// this defaults to the value of the `OXIDE_HOST` environment variable. When
 	// specified, `token` must be specified. Conflicts with `profile`.
@@ -48,8 +72,18 @@ type Config struct {
 	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify" required:"false"`
 
 	// Image ID to use for the instance's boot disk. This can be obtained from the
-	// `oxide-image` data source.
-	BootDiskImageID string `mapstructure:"boot_disk_image_id" required:"true"`
+	// `oxide-image` data source. Exactly one of `boot_disk_image_id`,
+	// `boot_disk_snapshot_id`, or `boot_disk_source` must be set.
+	BootDiskImageID string `mapstructure:"boot_disk_image_id"`
+
+	// Snapshot ID to use for the instance's boot disk, such as a snapshot of an
+	// earlier build to layer changes on.
+	BootDiskSnapshotID string `mapstructure:"boot_disk_snapshot_id"`
+
+	// Name or ID of an existing disk in `project` to clone for the instance's
+	// boot disk. The disk is cloned through a temporary snapshot that's deleted
+	// once the build completes.
+	BootDiskSource string `mapstructure:"boot_disk_source"`
 
 	// Name or ID of the project where the temporary instance and resulting image
 	// will be created.
@@ -58,16 +92,80 @@ type Config struct {
 	// Size of the boot disk in bytes. Defaults to `21474836480`, or 20 GiB.
 	BootDiskSize uint64 `mapstructure:"boot_disk_size"`
 
-	// IP pool to allocate the instance's external IP from. If not specified, the
-	// silo's default IP pool will be used.
+	// Additional disks to attach to the temporary instance, such as scratch
+	// space or a disk with data to provision from. Repeat the block to attach
+	// multiple disks. See [Disk Configuration](#disk-configuration).
+	Disks []DiskConfig `mapstructure:"disk"`
+
+	// IP pool to allocate the instance's ephemeral external IP and floating IP
+	// from. If not specified, the silo's default IP pool will be used.
 	IPPool string `mapstructure:"ip_pool"`
 
-	// VPC to create the instance within. Defaults to `default`.
+	// IP version of the instance's network interface and external IPs. Set to
+	// `v4`, `v6`, or `dual` for a dual-stack network interface. Packer connects
+	// to an address of the configured version, preferring IPv4 with `dual`.
+	// External IPs are allocated from IPv6 pools with `v6` and from IPv4 pools
+	// otherwise. Defaults to `v4`.
+	IPVersion string `mapstructure:"ip_version"`
+
+	// Name or ID of an existing floating IP in `project` to attach to the
+	// instance, giving it a fixed external IP. The floating IP must not be
+	// attached to another instance. It's detached when the instance is deleted.
+	FloatingIP string `mapstructure:"floating_ip"`
+
+	// Allocate a floating IP from `ip_pool` and attach it to the instance. The
+	// floating IP is deleted once the build completes.
+	CreateFloatingIP bool `mapstructure:"create_floating_ip"`
+
+	// VPC to create the instance within. Defaults to `default`, or `name` when
+	// `temporary_network` is set.
 	VPC string `mapstructure:"vpc"`
 
-	// Subnet to create the instance within. Defaults to `default`.
+	// Subnet to create the instance within. Defaults to `default`, or `name`
+	// when `temporary_network` is set.
 	Subnet string `mapstructure:"subnet"`
 
+	// Create a dedicated VPC named `vpc` and subnet named `subnet` for the
+	// build, rather than using existing ones. The VPC's firewall only allows
+	// inbound connections to the communicator port from
+	// `temporary_firewall_rule_source_cidrs`. The VPC and subnet are deleted
+	// once the build completes.
+	TemporaryNetwork bool `mapstructure:"temporary_network"`
+
+	// IPv4 block of the subnet created with `temporary_network`, in CIDR
+	// notation. Defaults to `172.30.0.0/22`.
+	TemporaryNetworkIPv4Block string `mapstructure:"temporary_network_ipv4_block"`
+
+	// Interface of the instance that Packer connects to. Set to `external` to
+	// connect to the instance's external IP or `private` to connect to the
+	// private IP of its network interface, such as from within the same VPC or
+	// through a bastion host configured with `ssh_bastion_host`. Defaults to
+	// `external`.
+	SSHInterface string `mapstructure:"ssh_interface"`
+
+	// Allocate an ephemeral external IP for the instance. Defaults to `true`
+	// when `ssh_interface` is `external` and to `false` when `ssh_interface` is
+	// `private`, `communicator` is `oxide-serial`, or a floating IP is
+	// configured with `floating_ip` or `create_floating_ip`.
+	AssociateExternalIP *bool `mapstructure:"associate_external_ip"`
+
+	// Add a temporary inbound rule to the firewall of `vpc` that allows the
+	// communicator port to the instance from
+	// `temporary_firewall_rule_source_cidrs`. Existing rules are kept, and the
+	// rule is removed once the build completes. The Oxide API replaces the rules
+	// of a VPC firewall as a whole, so the rules are checked after each update
+	// and the update is retried when a concurrent update overwrote it. Rules
+	// changed by others in the moment between reading and updating the rules
+	// can still be lost, so prefer `temporary_network` for builds that run at
+	// the same time in one VPC.
+	TemporaryFirewallRule bool `mapstructure:"temporary_firewall_rule"`
+
+	// CIDRs allowed to connect through the temporary firewall rule or the
+	// firewall of the VPC created with `temporary_network`. Defaults to the
+	// address Packer uses to reach the Oxide API, which suits build hosts that
+	// connect to the instance without NAT, such as from within the same VPC.
+	TemporaryFirewallRuleSourceCIDRs []string `mapstructure:"temporary_firewall_rule_source_cidrs"`
+
 	// Name of the temporary instance. Defaults to `packer-BUILD_NAME-RUN_ID` where
 	// `BUILD_NAME` is the Packer source name and `RUN_ID` is a short prefix of the
 	// unique ID Packer assigns to the current run. This must be unique to prevent
@@ -115,6 +213,12 @@ type Config struct {
 	// Defaults to `false`.
 	SkipCreateImage bool `mapstructure:"skip_create_image" required:"false"`
 
+	// Promote the resulting image to a silo image once it's created, making it
+	// available to every project in the silo. With `-force`, an existing silo
+	// image with the artifact name is replaced. Images created from additional
+	// disks stay project images. Defaults to `false`.
+	PromoteToSilo bool `mapstructure:"promote_to_silo" required:"false"`
+
 	// User data for instance initialization systems such as cloud-init. The
 	// value is a UTF-8 string and will be Base64-encoded by the plugin before
 	// transmission. The maximum size is 32 KiB, measured before encoding. Use
@@ -122,8 +226,171 @@ type Config struct {
 	// Packer does not wait for user data to finish executing before shutting
 	// down the instance. If your user data must complete before the image is
 	// created, run `cloud-init status --wait` or an equivalent in a
-	// provisioner.
+	// provisioner, or use `wait_for_serial_pattern`.
 	UserData string `mapstructure:"user_data" required:"false"`
+
+	// Regular expression to wait for in the temporary instance's serial console
+	// output after provisioning and before the instance is stopped. Use this to
+	// wait for the guest to signal that it's ready to be imaged, such as the
+	// message cloud-init prints when it finishes (e.g., `Cloud-init .* finished`).
+	// This makes builds with `communicator = "none"` practical. The expression
+	// uses [Go syntax](https://pkg.go.dev/regexp/syntax) and is matched against
+	// all output since the instance was created, with carriage returns removed.
+	WaitForSerialPattern string `mapstructure:"wait_for_serial_pattern" required:"false"`
+
+	// Maximum time to wait for `wait_for_serial_pattern` to appear on the serial
+	// console. Defaults to `10m`.
+	WaitForSerialPatternTimeout time.Duration `mapstructure:"wait_for_serial_pattern_timeout"`
+
+	// Maximum time to wait for the temporary instance to start after it's
+	// created. Defaults to `5m`.
+	InstanceStartTimeout time.Duration `mapstructure:"instance_start_timeout" required:"false"`
+
+	// Maximum time to wait for the temporary instance to stop once provisioning
+	// completes. Defaults to `5m`.
+	InstanceStopTimeout time.Duration `mapstructure:"instance_stop_timeout" required:"false"`
+
+	// Maximum time each cleanup operation, such as stopping the temporary
+	// instance or deleting a temporary resource, may take before the build gives
+	// up on it. Defaults to `5m`.
+	CleanupTimeout time.Duration `mapstructure:"cleanup_timeout" required:"false"`
+
+	// Initial interval between polls of the temporary instance's state. The
+	// interval doubles after every poll, up to 30 seconds. Defaults to `3s`.
+	PollInterval time.Duration `mapstructure:"poll_interval" required:"false"`
+
+	// Path to a local file to write the temporary instance's serial console
+	// output to. The output is captured for the whole build, from instance
+	// creation until the instance is deleted, which helps debug guests that
+	// fail to boot or never bring up the communicator. The file is truncated if
+	// it exists. When the build fails, the last lines of the output are also
+	// shown in the build log.
+	SerialConsoleLog string `mapstructure:"serial_console_log" required:"false"`
+
+	// Username to log in with when `communicator = "oxide-serial"` and the
+	// serial console presents a login prompt.
+	SerialUsername string `mapstructure:"serial_username" required:"false"`
+
+	// Password to log in with when `communicator = "oxide-serial"` and the
+	// serial console presents a password prompt.
+	SerialPassword string `mapstructure:"serial_password" required:"false"`
+
+	// Maximum time to wait for a shell on the serial console when
+	// `communicator = "oxide-serial"`, including logging in. Defaults to `5m`.
+	SerialLoginTimeout time.Duration `mapstructure:"serial_login_timeout" required:"false"`
+
+	// Regular expression matching the serial console login prompt. Defaults to
+	// `(?i)login:\s*$`.
+	SerialLoginPrompt string `mapstructure:"serial_login_prompt" required:"false"`
+
+	// Regular expression matching the serial console password prompt. Defaults
+	// to `(?i)password:\s*$`.
+	SerialPasswordPrompt string `mapstructure:"serial_password_prompt" required:"false"`
+
+	// Regular expression matching the serial console shell prompt, which
+	// signals that login is complete. Defaults to `[$#%]\s*$`.
+	SerialShellPrompt string `mapstructure:"serial_shell_prompt" required:"false"`
+}
+
+// DiskConfig configures an additional disk attached to the temporary instance.
+// A blank disk is created unless `image_id`, `snapshot_id`, or `existing` is
+// set.
+type DiskConfig struct {
+	// Name of the disk. Must be unique within the project.
+	Name string `mapstructure:"name" required:"true"`
+
+	// Size of the disk in bytes. Required unless `existing` is set.
+	Size uint64 `mapstructure:"size"`
+
+	// ID of the image to create the disk from.
+	ImageID string `mapstructure:"image_id"`
+
+	// ID of the snapshot to create the disk from.
+	SnapshotID string `mapstructure:"snapshot_id"`
+
+	// Attach the existing disk `name` rather than creating one. The disk must
+	// be detached and is left in place once the build completes.
+	Existing bool `mapstructure:"existing"`
+
+	// Delete the disk once the build completes. Defaults to `true` for disks
+	// created by the builder. Can't be set for `existing` disks.
+	DeleteOnCleanup *bool `mapstructure:"delete_on_cleanup"`
+
+	// Create an image from the disk alongside the image of the boot disk once
+	// provisioning completes. See [Disk Image Configuration](#disk-image-configuration).
+	Image *DiskImageConfig `mapstructure:"image"`
+}
+
+// DiskImageConfig configures the image created from an additional disk.
+type DiskImageConfig struct {
+	// Name of the image. Must differ from `artifact_name` and the names of other
+	// disk images.
+	Name string `mapstructure:"name" required:"true"`
+
+	// Description of the image. Defaults to `artifact_description`.
+	Description string `mapstructure:"description"`
+
+	// Operating system of the image. Defaults to `artifact_os`.
+	OS string `mapstructure:"os"`
+
+	// Version of the image. Defaults to `artifact_version`.
+	Version string `mapstructure:"version"`
+}
+
+// Prepare sets defaults for the disk configuration and validates it.
+func (d *DiskConfig) Prepare() []error {
+	var errs []error
+
+	if d.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+
+	if d.Image != nil && d.Image.Name == "" {
+		errs = append(errs, errors.New("image name is required"))
+	}
+
+	if d.Existing {
+		if d.Size != 0 || d.ImageID != "" || d.SnapshotID != "" {
+			errs = append(
+				errs,
+				errors.New("size, image_id, and snapshot_id can't be set for existing disks"),
+			)
+		}
+
+		if d.DeleteOnCleanup != nil && *d.DeleteOnCleanup {
+			errs = append(errs, errors.New("delete_on_cleanup can't be set for existing disks"))
+		}
+
+		d.DeleteOnCleanup = oxide.NewPointer(false)
+
+		return errs
+	}
+
+	if d.Size == 0 {
+		errs = append(errs, errors.New("size is required"))
+	}
+
+	if d.ImageID != "" && d.SnapshotID != "" {
+		errs = append(errs, errors.New("image_id and snapshot_id are mutually exclusive"))
+	}
+
+	if d.DeleteOnCleanup == nil {
+		d.DeleteOnCleanup = oxide.NewPointer(true)
+	}
+
+	return errs
+}
+
+// diskImages returns the additional disks that images are created from.
+func (c *Config) diskImages() []DiskConfig {
+	var disks []DiskConfig
+	for _, disk := range c.Disks {
+		if disk.Image != nil {
+			disks = append(disks, disk)
+		}
+	}
+
+	return disks
 }
 
 // Prepare decodes the configuration and validates it.
@@ -138,11 +405,63 @@ func (c *Config) Prepare(args ...any) ([]string, error) {
 		return nil, fmt.Errorf("failed decoding configuration: %w", err)
 	}
 
+	var multiErr *packer.MultiError
+
+	bootDiskSources := 0
+	for _, source := range []string{c.BootDiskImageID, c.BootDiskSnapshotID, c.BootDiskSource} {
+		if source != "" {
+			bootDiskSources++
+		}
+	}
+
+	switch bootDiskSources {
+	case 0:
+		multiErr = packer.MultiErrorAppend(
+			multiErr,
+			errors.New(
+				"boot_disk_image_id is required unless boot_disk_snapshot_id or boot_disk_source "+
+					"is set",
+			),
+		)
+	case 1:
+	default:
+		multiErr = packer.MultiErrorAppend(
+			multiErr,
+			errors.New(
+				"boot_disk_image_id, boot_disk_snapshot_id, "+
+					"and boot_disk_source are mutually exclusive",
+			),
+		)
+	}
+
+	warnings, err := c.Validate()
+	if err != nil {
+		multiErr = packer.MultiErrorAppend(multiErr, err)
+	}
+
+	if multiErr != nil && len(multiErr.Errors) > 0 {
+		return warnings, multiErr
+	}
+
+	return warnings, nil
+}
+
+// SetDefaultName names the temporary instance when its name isn't configured.
+// [Config.Validate] calls it, but builders that embed the configuration call it
+// first when they default other configuration to the name.
+func (c *Config) SetDefaultName() {
+	if c.Name == "" {
+		c.Name = fmt.Sprintf("packer-%s", c.uniqueSuffix())
+	}
+}
+
+// Validate sets defaults for the decoded configuration and validates it. The
+// boot disk source isn't validated, since builders that embed the configuration
+// may create the boot disk some other way.
+func (c *Config) Validate() ([]string, error) {
 	// Set defaults.
 	{
-		if c.Name == "" {
-			c.Name = fmt.Sprintf("packer-%s", c.uniqueSuffix())
-		}
+		c.SetDefaultName()
 
 		if c.Hostname == "" {
 			c.Hostname = fmt.Sprintf("packer-%s", c.uniqueSuffix())
@@ -160,12 +479,72 @@ func (c *Config) Prepare(args ...any) ([]string, error) {
 			c.BootDiskSize = 20 * 1024 * 1024 * 1024 // 20 GiB.
 		}
 
+		defaultNetwork := "default"
+		if c.TemporaryNetwork {
+			defaultNetwork = c.Name
+		}
+
 		if c.VPC == "" {
-			c.VPC = "default"
+			c.VPC = defaultNetwork
 		}
 
 		if c.Subnet == "" {
-			c.Subnet = "default"
+			c.Subnet = defaultNetwork
+		}
+
+		if c.TemporaryNetworkIPv4Block == "" {
+			c.TemporaryNetworkIPv4Block = "172.30.0.0/22"
+		}
+
+		if c.IPVersion == "" {
+			c.IPVersion = ipVersionV4
+		}
+
+		if c.SSHInterface == "" {
+			c.SSHInterface = sshInterfaceExternal
+		}
+
+		if c.AssociateExternalIP == nil {
+			associate := c.SSHInterface == sshInterfaceExternal &&
+				c.Comm.Type != serialCommunicatorType &&
+				!c.hasFloatingIP()
+			c.AssociateExternalIP = &associate
+		}
+
+		if c.InstanceStartTimeout == 0 {
+			c.InstanceStartTimeout = 5 * time.Minute
+		}
+
+		if c.InstanceStopTimeout == 0 {
+			c.InstanceStopTimeout = 5 * time.Minute
+		}
+
+		if c.CleanupTimeout == 0 {
+			c.CleanupTimeout = 5 * time.Minute
+		}
+
+		if c.PollInterval == 0 {
+			c.PollInterval = 3 * time.Second
+		}
+
+		if c.WaitForSerialPatternTimeout == 0 {
+			c.WaitForSerialPatternTimeout = 10 * time.Minute
+		}
+
+		if c.SerialLoginTimeout == 0 {
+			c.SerialLoginTimeout = 5 * time.Minute
+		}
+
+		if c.SerialLoginPrompt == "" {
+			c.SerialLoginPrompt = `(?i)login:\s*$`
+		}
+
+		if c.SerialPasswordPrompt == "" {
+			c.SerialPasswordPrompt = `(?i)password:\s*$`
+		}
+
+		if c.SerialShellPrompt == "" {
+			c.SerialShellPrompt = `[$#%]\s*$`
 		}
 	}
 
@@ -173,10 +552,25 @@ func (c *Config) Prepare(args ...any) ([]string, error) {
 	{
 		var multiErr *packer.MultiError
 
+		// The SDK rejects communicator types it doesn't know about, so prepare
+		// the serial communicator as if no communicator was configured.
+		serialCommunicator := c.Comm.Type == serialCommunicatorType
+		if serialCommunicator {
+			c.Comm.Type = "none"
+		}
+
 		if errs := c.Comm.Prepare(nil); len(errs) > 0 {
 			multiErr = packer.MultiErrorAppend(multiErr, errs...)
 		}
 
+		if serialCommunicator {
+			c.Comm.Type = serialCommunicatorType
+		}
+
+		if errs := c.BootConfig.Prepare(nil); len(errs) > 0 {
+			multiErr = packer.MultiErrorAppend(multiErr, errs...)
+		}
+
 		if c.Comm.SSHTemporaryKeyPairName == "" {
 			c.Comm.SSHTemporaryKeyPairName = fmt.Sprintf("packer-%s", c.uniqueSuffix())
 		}
@@ -187,10 +581,117 @@ func (c *Config) Prepare(args ...any) ([]string, error) {
 			multiErr = packer.MultiErrorAppend(multiErr, errors.New("project is required"))
 		}
 
-		if c.BootDiskImageID == "" {
+		if c.PromoteToSilo && c.SkipCreateImage {
 			multiErr = packer.MultiErrorAppend(
 				multiErr,
-				errors.New("boot_disk_image_id is required"),
+				errors.New("promote_to_silo and skip_create_image are mutually exclusive"),
+			)
+		}
+
+		switch c.SSHInterface {
+		case sshInterfaceExternal:
+			// Packer connects to the external IP unless it's told which host to
+			// connect to.
+			connects := c.Comm.Type == "ssh" || c.Comm.Type == "winrm"
+			if connects && c.Comm.Host() == "" && !*c.AssociateExternalIP && !c.hasFloatingIP() {
+				multiErr = packer.MultiErrorAppend(
+					multiErr,
+					errors.New(
+						"associate_external_ip must be true when ssh_interface is external and "+
+							"no floating IP is configured",
+					),
+				)
+			}
+		case sshInterfacePrivate:
+		default:
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				fmt.Errorf(
+					"ssh_interface must be one of %s or %s",
+					sshInterfaceExternal,
+					sshInterfacePrivate,
+				),
+			)
+		}
+
+		switch c.IPVersion {
+		case ipVersionV4, ipVersionV6, ipVersionDual:
+		default:
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				fmt.Errorf(
+					"ip_version must be one of %s, %s, or %s",
+					ipVersionV4,
+					ipVersionV6,
+					ipVersionDual,
+				),
+			)
+		}
+
+		if c.TemporaryFirewallRule && c.Comm.Type != "ssh" && c.Comm.Type != "winrm" {
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				errors.New("temporary_firewall_rule requires the ssh or winrm communicator"),
+			)
+		}
+
+		if c.TemporaryNetwork {
+			if prefix, err := netip.ParsePrefix(c.TemporaryNetworkIPv4Block); err != nil ||
+				!prefix.Addr().Is4() {
+				multiErr = packer.MultiErrorAppend(
+					multiErr,
+					fmt.Errorf(
+						"temporary_network_ipv4_block must be an IPv4 CIDR, got %q",
+						c.TemporaryNetworkIPv4Block,
+					),
+				)
+			}
+		}
+
+		for _, cidr := range c.TemporaryFirewallRuleSourceCIDRs {
+			if _, err := netip.ParsePrefix(cidr); err != nil {
+				multiErr = packer.MultiErrorAppend(
+					multiErr,
+					fmt.Errorf(
+						"temporary_firewall_rule_source_cidrs contains an invalid CIDR: %w",
+						err,
+					),
+				)
+			}
+		}
+
+		diskNames := make(map[string]bool, len(c.Disks))
+		imageNames := make(map[string]bool, len(c.Disks))
+		for i := range c.Disks {
+			for _, err := range c.Disks[i].Prepare() {
+				multiErr = packer.MultiErrorAppend(multiErr, fmt.Errorf("disk %d: %w", i, err))
+			}
+
+			if name := c.Disks[i].Name; name != "" {
+				if name == c.Name || diskNames[name] {
+					multiErr = packer.MultiErrorAppend(
+						multiErr,
+						fmt.Errorf("disk %d: name %q is already used", i, name),
+					)
+				}
+				diskNames[name] = true
+			}
+
+			if image := c.Disks[i].Image; image != nil && image.Name != "" {
+				if image.Name == c.ArtifactName || imageNames[image.Name] {
+					multiErr = packer.MultiErrorAppend(
+						multiErr,
+						fmt.Errorf("disk %d: image name %q is already used", i, image.Name),
+					)
+				}
+				imageNames[image.Name] = true
+			}
+		}
+
+		if c.FloatingIP != "" && c.CreateFloatingIP {
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				errors.New("floating_ip and create_floating_ip are mutually exclusive"),
 			)
 		}
 
@@ -201,16 +702,144 @@ func (c *Config) Prepare(args ...any) ([]string, error) {
 			)
 		}
 
+		for _, p := range []struct {
+			name  string
+			value string
+		}{
+			{"wait_for_serial_pattern", c.WaitForSerialPattern},
+			{"serial_login_prompt", c.SerialLoginPrompt},
+			{"serial_password_prompt", c.SerialPasswordPrompt},
+			{"serial_shell_prompt", c.SerialShellPrompt},
+		} {
+			if _, err := regexp.Compile(p.value); err != nil {
+				multiErr = packer.MultiErrorAppend(
+					multiErr,
+					fmt.Errorf("%s is not a valid regular expression: %w", p.name, err),
+				)
+			}
+		}
+
+		for _, d := range []struct {
+			name  string
+			value time.Duration
+		}{
+			{"instance_start_timeout", c.InstanceStartTimeout},
+			{"instance_stop_timeout", c.InstanceStopTimeout},
+			{"cleanup_timeout", c.CleanupTimeout},
+			{"poll_interval", c.PollInterval},
+			{"wait_for_serial_pattern_timeout", c.WaitForSerialPatternTimeout},
+			{"serial_login_timeout", c.SerialLoginTimeout},
+		} {
+			if d.value < 0 {
+				multiErr = packer.MultiErrorAppend(
+					multiErr,
+					fmt.Errorf("%s must not be negative", d.name),
+				)
+			}
+		}
+
 		if multiErr != nil && len(multiErr.Errors) > 0 {
 			return nil, multiErr
 		}
 	}
 
-	packer.LogSecretFilter.Set(c.Token)
+	packer.LogSecretFilter.Set(c.Token, c.SerialPassword)
 
 	return nil, nil
 }
 
+// hasFloatingIP reports whether a floating IP is attached to the instance.
+func (c *Config) hasFloatingIP() bool {
+	return c.FloatingIP != "" || c.CreateFloatingIP
+}
+
+// ipPoolSelector returns the selector for the IP pool external IPs are
+// allocated from.
+func (c *Config) ipPoolSelector() oxide.PoolSelector {
+	if c.IPPool == "" {
+		ipVersion := oxide.IpVersionV4
+		if c.IPVersion == ipVersionV6 {
+			ipVersion = oxide.IpVersionV6
+		}
+
+		return oxide.PoolSelector{
+			Value: &oxide.PoolSelectorAuto{
+				IpVersion: ipVersion,
+			},
+		}
+	}
+
+	return oxide.PoolSelector{
+		Value: &oxide.PoolSelectorExplicit{
+			Pool: oxide.NameOrId(c.IPPool),
+		},
+	}
+}
+
+// privateIPStack returns the IP stack configuration for the instance's network
+// interface.
+func (c *Config) privateIPStack() oxide.PrivateIpStackCreate {
+	v4 := oxide.PrivateIpv4StackCreate{
+		Ip: oxide.Ipv4Assignment{Value: &oxide.Ipv4AssignmentAuto{}},
+	}
+	v6 := oxide.PrivateIpv6StackCreate{
+		Ip: oxide.Ipv6Assignment{Value: &oxide.Ipv6AssignmentAuto{}},
+	}
+
+	switch c.IPVersion {
+	case ipVersionV6:
+		return oxide.PrivateIpStackCreate{
+			Value: &oxide.PrivateIpStackCreateV6{Value: v6},
+		}
+	case ipVersionDual:
+		return oxide.PrivateIpStackCreate{
+			Value: &oxide.PrivateIpStackCreateDualStack{
+				Value: oxide.PrivateIpStackCreateDualStackValue{V4: v4, V6: v6},
+			},
+		}
+	default:
+		return oxide.PrivateIpStackCreate{
+			Value: &oxide.PrivateIpStackCreateV4{Value: v4},
+		}
+	}
+}
+
+// selectIP returns the first address in ips of the configured IP version,
+// preferring IPv4 addresses for dual-stack networking. Addresses are returned
+// without brackets or zones, as the communicators expect.
+func (c *Config) selectIP(ips ...string) string {
+	var v4, v6 string
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+		if err != nil {
+			continue
+		}
+		addr = addr.Unmap().WithZone("")
+
+		switch {
+		case addr.Is4() && v4 == "":
+			v4 = addr.String()
+		case addr.Is6() && v6 == "":
+			v6 = addr.String()
+		}
+	}
+
+	switch c.IPVersion {
+	case ipVersionV6:
+		return v6
+	case ipVersionDual:
+		return cmp.Or(v4, v6)
+	default:
+		return v4
+	}
+}
+
+// clientOptions returns the options to create an Oxide client with the
+// configured credentials.
+func (c *Config) clientOptions() []oxide.ClientOption {
+	return oxideclient.Options(c.Host, c.Token, c.Profile, c.InsecureSkipVerify)
+}
+
 // uniqueSuffix returns an identifier, derived from Packer-provided values,
 // that is used to configure resource names that are unique and traceable to the
 // Packer build that created them.
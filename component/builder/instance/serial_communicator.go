@@ -0,0 +1,453 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// serialCommunicatorType is the communicator type that provisions instances
+// over their serial console.
+const serialCommunicatorType = "oxide-serial"
+
+const (
+	// serialUploadChunkBytes is the number of bytes uploaded per command. The
+	// base64 encoded chunk must fit comfortably within the 4 KiB line limit of
+	// canonical mode terminals.
+	serialUploadChunkBytes = 1536
+
+	// serialHoldBackBytes is the amount of unmatched command output held back
+	// while streaming so that a marker split across reads is not written out.
+	serialHoldBackBytes = 64
+)
+
+var _ packer.Communicator = (*serialCommunicator)(nil)
+
+// serialCommunicator is a [packer.Communicator] that runs commands in a shell on
+// an instance's serial console. The console carries a single stream of text,
+// so each command is wrapped in uniquely generated markers that delimit its
+// output and report its exit status. Files are transferred base64 encoded,
+// which requires a POSIX shell and `base64` on the guest.
+type serialCommunicator struct {
+	// ctx bounds operations that aren't given a context, such as uploads.
+	ctx     context.Context
+	conn    io.ReadWriteCloser
+	console *serialConsoleBuffer
+
+	// mu serializes operations since they share the console.
+	mu sync.Mutex
+}
+
+// serialLogin configures how [newSerialCommunicator] obtains a shell.
+type serialLogin struct {
+	Username       string
+	Password       string
+	LoginPrompt    *regexp.Regexp
+	PasswordPrompt *regexp.Regexp
+	ShellPrompt    *regexp.Regexp
+}
+
+// newSerialCommunicator logs in on the serial console available through conn
+// and prepares the shell for running commands. The communicator takes
+// ownership of conn.
+func newSerialCommunicator(
+	ctx context.Context,
+	loginCtx context.Context,
+	conn io.ReadWriteCloser,
+	login serialLogin,
+) (*serialCommunicator, error) {
+	c := &serialCommunicator{
+		ctx:     ctx,
+		conn:    conn,
+		console: newSerialConsoleBuffer(conn),
+	}
+
+	if err := c.login(loginCtx, login); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// login answers login and password prompts until a shell prompt appears. It
+// then disables echo and prompts, which would otherwise interleave with command
+// output, and waits for the shell to settle.
+func (c *serialCommunicator) login(ctx context.Context, login serialLogin) error {
+	// Prompt the guest to print whatever it's currently waiting for.
+	if err := c.write("\r"); err != nil {
+		return err
+	}
+
+	for loggedIn := false; !loggedIn; {
+		match, _, err := c.console.Expect(
+			ctx,
+			io.Discard,
+			login.LoginPrompt,
+			login.PasswordPrompt,
+			login.ShellPrompt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed waiting for serial console shell: %w", err)
+		}
+
+		switch match.Index {
+		case 0:
+			if login.Username == "" {
+				return errors.New("serial console requested a login but serial_username is not set")
+			}
+			err = c.write(login.Username + "\r")
+		case 1:
+			err = c.write(login.Password + "\r")
+		case 2:
+			loggedIn = true
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.run(ctx, "stty -echo 2>/dev/null; PS1=''; PS2=''", io.Discard); err != nil {
+		return fmt.Errorf("failed preparing serial console shell: %w", err)
+	}
+
+	return nil
+}
+
+// Start runs cmd in the background, calling [packer.RemoteCmd.SetExited] once
+// it finishes. Standard error is merged into standard output since the serial
+// console cannot tell them apart.
+func (c *serialCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	stdout := cmd.Stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	go func() {
+		status, err := c.run(ctx, cmd.Command, stdout)
+		if err != nil {
+			if cmd.Stderr != nil {
+				fmt.Fprintf(cmd.Stderr, "oxide-serial communicator: %v\n", err)
+			}
+			status = packer.CmdDisconnect
+		}
+		cmd.SetExited(status)
+	}()
+
+	return nil
+}
+
+// Upload writes the contents of src to dst on the guest.
+func (c *serialCommunicator) Upload(dst string, src io.Reader, fi *os.FileInfo) error {
+	if err := c.check(fmt.Sprintf(": > %s", shellQuote(dst)), io.Discard); err != nil {
+		return fmt.Errorf("failed creating %s: %w", dst, err)
+	}
+
+	buf := make([]byte, serialUploadChunkBytes)
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if err := c.check(fmt.Sprintf(
+				"printf '%%s' %s | base64 -d >> %s",
+				base64.StdEncoding.EncodeToString(buf[:n]),
+				shellQuote(dst),
+			), io.Discard); err != nil {
+				return fmt.Errorf("failed uploading %s: %w", dst, err)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed reading upload source for %s: %w", dst, err)
+		}
+	}
+
+	if fi != nil {
+		mode := (*fi).Mode().Perm()
+		if err := c.check(
+			fmt.Sprintf("chmod %o %s", mode, shellQuote(dst)),
+			io.Discard,
+		); err != nil {
+			return fmt.Errorf("failed setting mode of %s: %w", dst, err)
+		}
+	}
+
+	return nil
+}
+
+// UploadDir uploads the directory src to dst on the guest. As with other
+// communicators, the contents of src are uploaded into dst when src ends with a
+// slash and src itself is uploaded into dst otherwise. Paths matching a pattern
+// in exclude are skipped.
+func (c *serialCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	if !strings.HasSuffix(src, "/") {
+		dst = path.Join(dst, filepath.Base(src))
+	}
+
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		for _, pattern := range exclude {
+			if ok, _ := filepath.Match(pattern, rel); ok {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		target := path.Join(dst, filepath.ToSlash(rel))
+
+		if info.IsDir() {
+			mkdir := fmt.Sprintf("mkdir -p %s", shellQuote(target))
+			if err := c.check(mkdir, io.Discard); err != nil {
+				return fmt.Errorf("failed creating directory %s: %w", target, err)
+			}
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return c.Upload(target, f, &info)
+	})
+}
+
+// Download writes the contents of src on the guest to dst.
+func (c *serialCommunicator) Download(src string, dst io.Writer) error {
+	var out bytes.Buffer
+	if err := c.check(fmt.Sprintf("base64 < %s", shellQuote(src)), &out); err != nil {
+		return fmt.Errorf("failed downloading %s: %w", src, err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(out.String()), ""))
+	if err != nil {
+		return fmt.Errorf("failed decoding %s: %w", src, err)
+	}
+
+	if _, err := dst.Write(data); err != nil {
+		return fmt.Errorf("failed writing %s: %w", src, err)
+	}
+
+	return nil
+}
+
+// DownloadDir is not supported.
+func (c *serialCommunicator) DownloadDir(string, string, []string) error {
+	return fmt.Errorf("downloading directories is not supported by the %s communicator",
+		serialCommunicatorType)
+}
+
+// Close closes the serial console connection.
+func (c *serialCommunicator) Close() error {
+	return c.conn.Close()
+}
+
+// check runs command and returns an error when it exits with a non-zero
+// status.
+func (c *serialCommunicator) check(command string, stdout io.Writer) error {
+	status, err := c.run(c.ctx, command, stdout)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("command exited with status %d", status)
+	}
+
+	return nil
+}
+
+// run runs command in the guest shell, streaming its output to stdout, and
+// returns its exit status.
+func (c *serialCommunicator) run(
+	ctx context.Context,
+	command string,
+	stdout io.Writer,
+) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return 0, err
+	}
+	marker := hex.EncodeToString(id)
+
+	// The markers are printed from separate arguments so they never appear
+	// verbatim in the echoed command line.
+	line := fmt.Sprintf(
+		"printf '%%s%%s\\n' PKRBEGIN_ %[1]s; { %[2]s\n} 2>&1; "+
+			"printf '%%s%%s %%d\\n' PKREND_ %[1]s $?\r",
+		marker,
+		command,
+	)
+	if err := c.write(line); err != nil {
+		return 0, err
+	}
+
+	begin := regexp.MustCompile(`PKRBEGIN_` + marker + `\n`)
+	end := regexp.MustCompile(`\n?PKREND_` + marker + ` (\d+)\n`)
+
+	if _, _, err := c.console.Expect(ctx, io.Discard, begin); err != nil {
+		return 0, err
+	}
+
+	match, _, err := c.console.Expect(ctx, stdout, end)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(match.Groups[1])
+}
+
+// write sends s to the serial console.
+func (c *serialCommunicator) write(s string) error {
+	if _, err := io.WriteString(c.conn, s); err != nil {
+		return fmt.Errorf("failed writing to serial console: %w", err)
+	}
+
+	return nil
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// serialConsoleBuffer buffers the output read from a serial console so it can
+// be matched against patterns.
+type serialConsoleBuffer struct {
+	mu      sync.Mutex
+	buf     []byte
+	err     error
+	updated chan struct{}
+}
+
+// serialConsoleMatch describes the pattern matched by
+// [serialConsoleBuffer.Expect].
+type serialConsoleMatch struct {
+	// Index of the pattern that matched.
+	Index int
+
+	// Text of the match and its capture groups.
+	Groups []string
+}
+
+// newSerialConsoleBuffer starts reading r into a new buffer until r returns an
+// error.
+func newSerialConsoleBuffer(r io.Reader) *serialConsoleBuffer {
+	b := &serialConsoleBuffer{updated: make(chan struct{})}
+
+	go func() {
+		chunk := make([]byte, 4096)
+		for {
+			n, err := r.Read(chunk)
+
+			b.mu.Lock()
+			b.buf = append(b.buf, bytes.ReplaceAll(chunk[:n], []byte("\r"), nil)...)
+			if err != nil {
+				b.err = err
+			}
+			close(b.updated)
+			b.updated = make(chan struct{})
+			b.mu.Unlock()
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return b
+}
+
+// Expect waits until the buffered output matches one of patterns, consuming
+// the output through the earliest match. Output preceding the match is written
+// to w as it arrives, except for a small trailing window that may hold the
+// start of a match.
+func (b *serialConsoleBuffer) Expect(
+	ctx context.Context,
+	w io.Writer,
+	patterns ...*regexp.Regexp,
+) (serialConsoleMatch, string, error) {
+	for {
+		b.mu.Lock()
+
+		match, start, end := serialConsoleMatch{Index: -1}, 0, 0
+		for i, pattern := range patterns {
+			loc := pattern.FindSubmatchIndex(b.buf)
+			if loc == nil || (match.Index >= 0 && loc[0] >= start) {
+				continue
+			}
+
+			match.Index, start, end = i, loc[0], loc[1]
+			match.Groups = make([]string, len(loc)/2)
+			for g := range match.Groups {
+				if loc[2*g] >= 0 {
+					match.Groups[g] = string(b.buf[loc[2*g]:loc[2*g+1]])
+				}
+			}
+		}
+
+		if match.Index >= 0 {
+			before := string(b.buf[:start])
+			b.buf = b.buf[end:]
+			b.mu.Unlock()
+
+			if _, err := io.WriteString(w, before); err != nil {
+				return match, before, err
+			}
+			return match, before, nil
+		}
+
+		if n := len(b.buf) - serialHoldBackBytes; n > 0 {
+			if _, err := w.Write(b.buf[:n]); err != nil {
+				b.mu.Unlock()
+				return match, "", err
+			}
+			b.buf = b.buf[n:]
+		}
+
+		err, updated := b.err, b.updated
+		b.mu.Unlock()
+
+		if err != nil {
+			return match, "", err
+		}
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return match, "", ctx.Err()
+		}
+	}
+}
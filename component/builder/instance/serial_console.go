@@ -0,0 +1,229 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+const (
+	// serialConsoleTailBytes is the amount of recent serial console output
+	// fetched when showing its tail.
+	serialConsoleTailBytes = 16 * 1024
+
+	// serialConsoleTailLines is the number of serial console lines included in
+	// diagnostics.
+	serialConsoleTailLines = 20
+
+	// serialConsoleChunkBytes is the maximum amount of serial console output
+	// requested at once.
+	serialConsoleChunkBytes = 64 * 1024
+
+	// serialConsoleTailTimeout bounds the time spent fetching serial console
+	// output for diagnostics.
+	serialConsoleTailTimeout = 10 * time.Second
+)
+
+// serialConsoleTail returns up to the last n lines of an instance's serial
+// console output. It's used for diagnostics so an empty string is returned when
+// the output cannot be retrieved.
+func serialConsoleTail(
+	ctx context.Context,
+	oxideClient *oxide.Client,
+	instanceID string,
+	n int,
+) string {
+	ctx, cancel := context.WithTimeout(ctx, serialConsoleTailTimeout)
+	defer cancel()
+
+	mostRecent := uint64(serialConsoleTailBytes)
+	data, err := oxideClient.InstanceSerialConsole(ctx, oxide.InstanceSerialConsoleParams{
+		Instance:   oxide.NameOrId(instanceID),
+		MostRecent: &mostRecent,
+	})
+	if err != nil {
+		return ""
+	}
+
+	b := make([]byte, len(data.Data))
+	for i, v := range data.Data {
+		b[i] = byte(v)
+	}
+
+	return tailLines(serialConsoleText(b), n)
+}
+
+// readSerialConsole returns the serial console output of an instance starting
+// at offset, requesting it in chunks until no more is available. Output read
+// before an error is returned along with the error.
+func readSerialConsole(
+	ctx context.Context,
+	oxideClient *oxide.Client,
+	instanceID string,
+	offset uint64,
+) ([]byte, error) {
+	var res []byte
+
+	for {
+		fromStart := offset + uint64(len(res))
+		maxBytes := uint64(serialConsoleChunkBytes)
+		data, err := oxideClient.InstanceSerialConsole(ctx, oxide.InstanceSerialConsoleParams{
+			Instance:  oxide.NameOrId(instanceID),
+			FromStart: &fromStart,
+			MaxBytes:  &maxBytes,
+		})
+		if err != nil {
+			return res, err
+		}
+
+		for _, v := range data.Data {
+			res = append(res, byte(v))
+		}
+
+		if len(data.Data) < serialConsoleChunkBytes {
+			return res, nil
+		}
+	}
+}
+
+// serialConsoleText converts serial console output to text with carriage
+// returns removed.
+func serialConsoleText(b []byte) string {
+	return strings.ReplaceAll(string(b), "\r", "")
+}
+
+// tailLines returns up to the last n lines of s, ignoring trailing newlines.
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+const (
+	// serialConsoleLogInterval is the interval between fetches of serial
+	// console output by [serialConsoleLogger].
+	serialConsoleLogInterval = 2 * time.Second
+)
+
+// serialConsoleLogger continuously copies an instance's serial console output
+// to a file. It keeps the most recent output in memory so the tail can be
+// shown without reading the file back.
+type serialConsoleLogger struct {
+	oxideClient *oxide.Client
+	instanceID  string
+	file        *os.File
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// mu guards the fields below, which are shared between the background
+	// fetches and the final fetch in Close.
+	mu     sync.Mutex
+	offset uint64
+	recent []byte
+}
+
+// newSerialConsoleLogger creates or truncates the file at path. Output is not
+// captured until [serialConsoleLogger.Start] is called.
+func newSerialConsoleLogger(oxideClient *oxide.Client, path string) (*serialConsoleLogger, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating serial console log: %w", err)
+	}
+
+	return &serialConsoleLogger{
+		oxideClient: oxideClient,
+		file:        file,
+	}, nil
+}
+
+// Start begins copying the serial console output of an instance to the file in
+// the background until [serialConsoleLogger.Close] is called.
+func (l *serialConsoleLogger) Start(ctx context.Context, instanceID string) {
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.instanceID = instanceID
+	l.done = make(chan struct{})
+
+	go func() {
+		defer close(l.done)
+
+		ticker := time.NewTicker(serialConsoleLogInterval)
+		defer ticker.Stop()
+
+		for {
+			// Errors are expected while the instance is not running, so they're
+			// only logged.
+			if err := l.fetch(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("[DEBUG] failed fetching serial console output: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// fetch copies any serial console output produced since the last fetch to the
+// file.
+func (l *serialConsoleLogger) fetch(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, err := readSerialConsole(ctx, l.oxideClient, l.instanceID, l.offset)
+	if len(b) > 0 {
+		if _, err := l.file.Write(b); err != nil {
+			return fmt.Errorf("failed writing serial console log: %w", err)
+		}
+
+		l.offset += uint64(len(b))
+		l.recent = append(l.recent, b...)
+		if len(l.recent) > serialConsoleTailBytes {
+			l.recent = l.recent[len(l.recent)-serialConsoleTailBytes:]
+		}
+	}
+
+	return err
+}
+
+// Tail returns up to the last n lines of the captured serial console output.
+func (l *serialConsoleLogger) Tail(n int) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return tailLines(serialConsoleText(l.recent), n)
+}
+
+// Close stops the background copy, fetches any remaining output, and closes the
+// file.
+func (l *serialConsoleLogger) Close(ctx context.Context) error {
+	if l.cancel != nil {
+		l.cancel()
+		<-l.done
+
+		if err := l.fetch(ctx); err != nil {
+			log.Printf("[DEBUG] failed fetching serial console output: %v", err)
+		}
+	}
+
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed closing serial console log: %w", err)
+	}
+
+	return nil
+}
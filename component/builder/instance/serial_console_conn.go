@@ -0,0 +1,195 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"golang.org/x/net/websocket"
+)
+
+// serialConsoleDialer opens interactive connections to the serial consoles of
+// Oxide instances.
+//
+// The serial console stream is a websocket, which the Oxide Go SDK cannot
+// connect to. Rather than duplicating the SDK's credential handling, the dialer
+// uses a dedicated client whose transport performs the websocket handshake
+// for the authenticated request the SDK builds.
+type serialConsoleDialer struct {
+	oxideClient *oxide.Client
+}
+
+// serialConsoleDial carries the result of a websocket handshake from
+// [serialConsoleTransport] back to [serialConsoleDialer.Dial].
+type serialConsoleDial struct {
+	conn *websocket.Conn
+}
+
+// serialConsoleDialKey is the context key for a [*serialConsoleDial].
+type serialConsoleDialKey struct{}
+
+// newSerialConsoleDialer creates a dialer that authenticates using the
+// credentials in config.
+func newSerialConsoleDialer(config *Config) (*serialConsoleDialer, error) {
+	transport := &serialConsoleTransport{}
+	if config.InsecureSkipVerify {
+		transport.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	opts := append(
+		config.clientOptions(),
+		oxide.WithHTTPClient(&http.Client{Transport: transport}),
+	)
+
+	oxideClient, err := oxide.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating oxide client: %w", err)
+	}
+
+	return &serialConsoleDialer{oxideClient: oxideClient}, nil
+}
+
+// Dial connects to the serial console of an instance. The connection first
+// replays up to mostRecent bytes of past output.
+func (d *serialConsoleDialer) Dial(
+	ctx context.Context,
+	instanceID string,
+	mostRecent uint64,
+) (*serialConsoleConn, error) {
+	var dial serialConsoleDial
+
+	if err := d.oxideClient.InstanceSerialConsoleStream(
+		context.WithValue(ctx, serialConsoleDialKey{}, &dial),
+		oxide.InstanceSerialConsoleStreamParams{
+			Instance:   oxide.NameOrId(instanceID),
+			MostRecent: &mostRecent,
+		},
+	); err != nil {
+		return nil, fmt.Errorf("failed connecting to oxide instance serial console: %w", err)
+	}
+
+	if dial.conn == nil {
+		return nil, errors.New("failed connecting to oxide instance serial console")
+	}
+
+	return &serialConsoleConn{ws: dial.conn}, nil
+}
+
+// serialConsoleTransport is an [http.RoundTripper] that turns serial console
+// stream requests into websocket connections.
+type serialConsoleTransport struct {
+	tlsConfig *tls.Config
+}
+
+// RoundTrip performs a websocket handshake using the URL and headers of req and
+// stores the connection in the [*serialConsoleDial] carried by its context.
+func (t *serialConsoleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	dial, ok := req.Context().Value(serialConsoleDialKey{}).(*serialConsoleDial)
+	if !ok {
+		return nil, fmt.Errorf("unsupported serial console request: %s %s", req.Method, req.URL)
+	}
+
+	origin := *req.URL
+	origin.Path, origin.RawQuery = "", ""
+
+	location := *req.URL
+	switch location.Scheme {
+	case "https":
+		location.Scheme = "wss"
+	default:
+		location.Scheme = "ws"
+	}
+
+	config, err := websocket.NewConfig(location.String(), origin.String())
+	if err != nil {
+		return nil, err
+	}
+	config.TlsConfig = t.tlsConfig
+	config.Header = req.Header.Clone()
+	config.Header.Del("Content-Type")
+
+	conn, err := config.DialContext(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	dial.conn = conn
+
+	return &http.Response{
+		Status:     http.StatusText(http.StatusOK),
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+// serialConsoleCodec receives serial console messages, recording whether each
+// carries console output.
+var serialConsoleCodec = websocket.Codec{
+	Unmarshal: func(data []byte, payloadType byte, v any) error {
+		msg := v.(*serialConsoleMessage)
+		msg.data = data
+		msg.output = payloadType == websocket.BinaryFrame
+		return nil
+	},
+}
+
+// serialConsoleMessage is a message received from the serial console stream.
+// Binary messages carry console output while text messages carry control
+// messages, such as migration notices, that are ignored.
+type serialConsoleMessage struct {
+	data   []byte
+	output bool
+}
+
+// serialConsoleConn is an interactive connection to an instance's serial
+// console. Reads return console output and writes are sent as console input.
+type serialConsoleConn struct {
+	ws *websocket.Conn
+
+	readMu sync.Mutex
+	unread []byte
+}
+
+// Read reads console output into p.
+func (c *serialConsoleConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for len(c.unread) == 0 {
+		var msg serialConsoleMessage
+		if err := serialConsoleCodec.Receive(c.ws, &msg); err != nil {
+			return 0, err
+		}
+		if msg.output {
+			c.unread = msg.data
+		}
+	}
+
+	n := copy(p, c.unread)
+	c.unread = c.unread[n:]
+
+	return n, nil
+}
+
+// Write sends p as console input.
+func (c *serialConsoleConn) Write(p []byte) (int, error) {
+	if err := websocket.Message.Send(c.ws, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (c *serialConsoleConn) Close() error {
+	return c.ws.Close()
+}
@@ -20,8 +20,8 @@ var _ multistep.Step = (*stepArtifactValidate)(nil)
 // existing image that will conflict with the specified artifact name.
 type stepArtifactValidate struct{}
 
-// Run validates the artifact name has no conflicts, honoring Packer's `-force`
-// flag to replace an existing image.
+// Run validates the artifact name and the names of any disk images have no
+// conflicts, honoring Packer's `-force` flag to replace existing images.
 func (s *stepArtifactValidate) Run(
 	ctx context.Context,
 	stateBag multistep.StateBag,
@@ -32,21 +32,79 @@ func (s *stepArtifactValidate) Run(
 
 	ui.Sayf("Validating artifact name: %s", config.ArtifactName)
 
-	image, err := oxideClient.ImageView(ctx, oxide.ImageViewParams{
-		Project: oxide.NameOrId(config.Project),
-		Image:   oxide.NameOrId(config.ArtifactName),
-	})
+	image, err := existingImage(ctx, oxideClient, config.Project, config.ArtifactName)
 	if err != nil {
-		if !errors.Is(err, oxide.ErrObjectNotFound) {
+		ui.Error("Failed validating artifact name.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	if image != nil {
+		if !s.conflict(ui, stateBag, config, image) {
+			return multistep.ActionHalt
+		}
+
+		// `-force` was set so we record the existing image information to
+		// overwrite the existing image later in the build.
+		stateBag.Put("existing_image_id", string(image.Id))
+		stateBag.Put("existing_image_name", string(image.Name))
+	}
+
+	// The image keeps its name when it's promoted, so it also mustn't conflict
+	// with a silo image.
+	if config.PromoteToSilo {
+		image, err := existingImage(ctx, oxideClient, "", config.ArtifactName)
+		if err != nil {
 			ui.Error("Failed validating artifact name.")
 			stateBag.Put("error", err)
 			return multistep.ActionHalt
 		}
 
-		// The artifact name has no conflicts.
-		return multistep.ActionContinue
+		if image != nil {
+			if !s.conflict(ui, stateBag, config, image) {
+				return multistep.ActionHalt
+			}
+
+			stateBag.Put("existing_silo_image_id", string(image.Id))
+			stateBag.Put("existing_silo_image_name", string(image.Name))
+		}
 	}
 
+	var existingDiskImageNames []string
+	for _, disk := range config.diskImages() {
+		ui.Sayf("Validating disk image name: %s", disk.Image.Name)
+
+		image, err := existingImage(ctx, oxideClient, config.Project, disk.Image.Name)
+		if err != nil {
+			ui.Error("Failed validating disk image name.")
+			stateBag.Put("error", err)
+			return multistep.ActionHalt
+		}
+
+		if image != nil {
+			if !s.conflict(ui, stateBag, config, image) {
+				return multistep.ActionHalt
+			}
+
+			existingDiskImageNames = append(existingDiskImageNames, string(image.Name))
+		}
+	}
+
+	if len(existingDiskImageNames) > 0 {
+		stateBag.Put("existing_disk_image_names", existingDiskImageNames)
+	}
+
+	return multistep.ActionContinue
+}
+
+// conflict reports whether the build can continue with a name that conflicts
+// with image, which it can when `-force` is set.
+func (s *stepArtifactValidate) conflict(
+	ui packer.Ui,
+	stateBag multistep.StateBag,
+	config *Config,
+	image *oxide.Image,
+) bool {
 	// The artifact name conflicts with an existing image and `-force` was not
 	// set. Bail so the user can decide what to do.
 	if !config.PackerForce {
@@ -55,24 +113,42 @@ func (s *stepArtifactValidate) Run(
 			"error",
 			fmt.Errorf(
 				"Artifact name conflicts with existing image: %s (%s): use -force to overwrite",
-				config.ArtifactName,
+				image.Name,
 				image.Id,
 			),
 		)
+		return false
 	}
 
-	// `-force` was set so we record the existing image information and tell the
-	// user we'll overwrite the existing image later in the build.
-	stateBag.Put("existing_image_id", string(image.Id))
-	stateBag.Put("existing_image_name", string(image.Name))
-
 	ui.Sayf(
 		"Existing image will be overwritten (-force): %s (%s)",
 		image.Name,
 		image.Id,
 	)
 
-	return multistep.ActionContinue
+	return true
+}
+
+// existingImage returns the image named name in project, or the silo image
+// named name when project is empty, or nil when there's no such image.
+func existingImage(
+	ctx context.Context,
+	oxideClient *oxide.Client,
+	project string,
+	name string,
+) (*oxide.Image, error) {
+	image, err := oxideClient.ImageView(ctx, oxide.ImageViewParams{
+		Project: oxide.NameOrId(project),
+		Image:   oxide.NameOrId(name),
+	})
+	if err != nil {
+		if errors.Is(err, oxide.ErrObjectNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return image, nil
 }
 
 // Cleanup does nothing as [stepArtifactValidate.Run] creates no resources.
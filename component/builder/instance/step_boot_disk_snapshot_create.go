@@ -0,0 +1,87 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+var _ multistep.Step = (*stepBootDiskSnapshotCreate)(nil)
+
+// stepBootDiskSnapshotCreate is a Packer plugin step to create a snapshot of an
+// existing Oxide disk that the instance's boot disk is cloned from.
+type stepBootDiskSnapshotCreate struct{}
+
+// Run creates an Oxide snapshot of the `boot_disk_source` disk and stores its
+// information in stateBag.
+func (s *stepBootDiskSnapshotCreate) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	sourceDiskIDRaw, ok := stateBag.GetOk("source_disk_id")
+	if !ok {
+		ui.Error("State does not contain source disk ID. Cannot proceed!")
+		return multistep.ActionHalt
+	}
+	sourceDiskID := sourceDiskIDRaw.(string)
+
+	ui.Sayf("Creating Oxide snapshot of boot disk source: %s", sourceDiskID)
+
+	snapshot, err := oxideClient.SnapshotCreate(ctx, oxide.SnapshotCreateParams{
+		Project: oxide.NameOrId(config.Project),
+		Body: &oxide.SnapshotCreate{
+			Name:        oxide.Name(fmt.Sprintf("%s-source", config.Name)),
+			Description: "Created by Packer.",
+			Disk:        oxide.NameOrId(sourceDiskID),
+		},
+	})
+	if err != nil {
+		ui.Error("Failed creating Oxide snapshot of boot disk source.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Sayf("Created Oxide snapshot: %s", snapshot.Id)
+
+	stateBag.Put("boot_disk_snapshot_id", snapshot.Id)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the resources created by [stepBootDiskSnapshotCreate.Run].
+func (s *stepBootDiskSnapshotCreate) Cleanup(stateBag multistep.StateBag) {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	snapshotIDRaw, ok := stateBag.GetOk("boot_disk_snapshot_id")
+	if !ok {
+		return
+	}
+	snapshotID := snapshotIDRaw.(string)
+
+	ui.Sayf("Deleting Oxide snapshot: %s", snapshotID)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), config.CleanupTimeout)
+	defer cancel()
+
+	if err := oxideClient.SnapshotDelete(ctx, oxide.SnapshotDeleteParams{
+		Snapshot: oxide.NameOrId(snapshotID),
+	}); err != nil {
+		ui.Errorf(
+			"Failed deleting Oxide snapshot during cleanup. Please delete it manually: %v",
+			err,
+		)
+	}
+}
@@ -0,0 +1,93 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+var _ multistep.Step = (*stepConnectSerial)(nil)
+
+// stepConnectSerial is a Packer plugin step to connect the `oxide-serial`
+// communicator to an Oxide instance's serial console. It runs as a custom
+// connect step of [communicator.StepConnect].
+type stepConnectSerial struct {
+	comm *serialCommunicator
+}
+
+// Run logs in on the serial console of an Oxide instance and stores the
+// resulting communicator in the state bag.
+func (s *stepConnectSerial) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	instanceIDRaw, ok := stateBag.GetOk("instance_id")
+	if !ok {
+		ui.Error("State does not contain instance ID. Cannot proceed!")
+		return multistep.ActionHalt
+	}
+	instanceID := instanceIDRaw.(string)
+
+	// The step runs again after pause_before_connect.
+	if s.comm != nil {
+		s.comm.Close()
+		s.comm = nil
+	}
+
+	dialer, err := newSerialConsoleDialer(config)
+	if err != nil {
+		ui.Error("Failed connecting to Oxide instance serial console.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	conn, err := dialer.Dial(ctx, instanceID, 0)
+	if err != nil {
+		ui.Error("Failed connecting to Oxide instance serial console.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Logging in over the Oxide instance serial console...")
+
+	loginCtx, cancel := context.WithTimeout(ctx, config.SerialLoginTimeout)
+	defer cancel()
+
+	comm, err := newSerialCommunicator(ctx, loginCtx, conn, serialLogin{
+		Username:       config.SerialUsername,
+		Password:       config.SerialPassword,
+		LoginPrompt:    regexp.MustCompile(config.SerialLoginPrompt),
+		PasswordPrompt: regexp.MustCompile(config.SerialPasswordPrompt),
+		ShellPrompt:    regexp.MustCompile(config.SerialShellPrompt),
+	})
+	if err != nil {
+		ui.Error("Failed logging in over Oxide instance serial console.")
+		stateBag.Put("error", fmt.Errorf("failed logging in over serial console: %w", err))
+		return multistep.ActionHalt
+	}
+	s.comm = comm
+
+	ui.Say("Connected to Oxide instance serial console.")
+	stateBag.Put("communicator", comm)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup closes the serial console connection opened by
+// [stepConnectSerial.Run].
+func (s *stepConnectSerial) Cleanup(multistep.StateBag) {
+	if s.comm != nil {
+		s.comm.Close()
+		s.comm = nil
+	}
+}
@@ -0,0 +1,303 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/localaddr"
+)
+
+var _ multistep.Step = (*stepFirewallRuleCreate)(nil)
+
+// stepFirewallRuleCreate is a Packer plugin step to add a temporary rule to an
+// Oxide VPC firewall that allows the communicator to connect to the instance.
+type stepFirewallRuleCreate struct{}
+
+// Run adds a firewall rule allowing inbound traffic to the communicator port of
+// the instance and stores its name in stateBag. The VPC firewall is updated as
+// a whole, so the existing rules are read and kept.
+func (s *stepFirewallRuleCreate) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	sourceCIDRs, err := firewallRuleSourceCIDRs(ctx, config, oxideClient.Host())
+	if err != nil {
+		ui.Error("Failed detecting the source address for the temporary firewall rule.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Sayf("Creating temporary Oxide VPC firewall rule for %v", sourceCIDRs)
+
+	name := oxide.Name(config.Name)
+	rule := oxide.VpcFirewallRuleUpdate{
+		Action:      oxide.VpcFirewallRuleActionAllow,
+		Description: "Created by Packer.",
+		Direction:   oxide.VpcFirewallRuleDirectionInbound,
+		Filters: oxide.VpcFirewallRuleFilter{
+			Hosts: hostFilters(sourceCIDRs),
+			Ports: []oxide.L4PortRange{oxide.L4PortRange(strconv.Itoa(config.Comm.Port()))},
+			Protocols: []oxide.VpcFirewallRuleProtocol{
+				{Value: &oxide.VpcFirewallRuleProtocolTcp{}},
+			},
+		},
+		Name:     name,
+		Priority: oxide.NewPointer(65534),
+		Status:   oxide.VpcFirewallRuleStatusEnabled,
+		Targets: []oxide.VpcFirewallRuleTarget{
+			{Value: &oxide.VpcFirewallRuleTargetInstance{Value: name}},
+		},
+	}
+
+	// A rule named like the temporary rule only fails the step when it exists
+	// before the first update. On retries, it's the rule of an earlier attempt.
+	retry := false
+	if err := updateFirewallRules(
+		ctx,
+		oxideClient,
+		config,
+		func(rules []oxide.VpcFirewallRule) ([]oxide.VpcFirewallRuleUpdate, error) {
+			exists := slices.ContainsFunc(rules, func(rule oxide.VpcFirewallRule) bool {
+				return rule.Name == name
+			})
+			if exists && !retry {
+				return nil, fmt.Errorf("oxide vpc firewall rule %s already exists", name)
+			}
+			retry = true
+
+			rules = slices.DeleteFunc(slices.Clone(rules), func(rule oxide.VpcFirewallRule) bool {
+				return rule.Name == name
+			})
+			return append(firewallRuleUpdates(rules), rule), nil
+		},
+	); err != nil {
+		ui.Error("Failed creating temporary Oxide VPC firewall rule.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Sayf("Created temporary Oxide VPC firewall rule: %s", name)
+
+	stateBag.Put("firewall_rule_name", name)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the resources created by [stepFirewallRuleCreate.Run].
+func (s *stepFirewallRuleCreate) Cleanup(stateBag multistep.StateBag) {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	nameRaw, ok := stateBag.GetOk("firewall_rule_name")
+	if !ok {
+		return
+	}
+	name := nameRaw.(oxide.Name)
+
+	ui.Sayf("Deleting temporary Oxide VPC firewall rule: %s", name)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), config.CleanupTimeout)
+	defer cancel()
+
+	// Rules may have changed during the build, so only the temporary rule is
+	// removed from the current rules.
+	err := updateFirewallRules(
+		ctx,
+		oxideClient,
+		config,
+		func(rules []oxide.VpcFirewallRule) ([]oxide.VpcFirewallRuleUpdate, error) {
+			return firewallRuleUpdates(
+				slices.DeleteFunc(slices.Clone(rules), func(rule oxide.VpcFirewallRule) bool {
+					return rule.Name == name
+				}),
+			), nil
+		},
+	)
+	if err != nil {
+		ui.Errorf(
+			"Failed deleting temporary Oxide VPC firewall rule %s during cleanup. "+
+				"Please delete it manually: %v",
+			name,
+			err,
+		)
+	}
+}
+
+// firewallRuleAttempts is the number of times the rules of a VPC firewall are
+// updated before concurrent changes to them fail the update.
+const firewallRuleAttempts = 3
+
+// updateFirewallRules replaces the rules of the VPC firewall with the updates
+// that update returns for its current rules. The Oxide API replaces the rules as
+// a whole without checking for concurrent changes, so the rules are viewed again
+// after each update. The update is retried when a rule it wrote is missing or a
+// rule it removed is back, which means a concurrent update overwrote it.
+// Concurrent changes that land between viewing the rules and updating them are
+// still lost.
+func updateFirewallRules(
+	ctx context.Context,
+	oxideClient *oxide.Client,
+	config *Config,
+	update func([]oxide.VpcFirewallRule) ([]oxide.VpcFirewallRuleUpdate, error),
+) error {
+	params := oxide.VpcFirewallRulesViewParams{
+		Project: oxide.NameOrId(config.Project),
+		Vpc:     oxide.NameOrId(config.VPC),
+	}
+
+	for range firewallRuleAttempts {
+		rules, err := oxideClient.VpcFirewallRulesView(ctx, params)
+		if err != nil {
+			return fmt.Errorf("failed viewing firewall rules: %w", err)
+		}
+
+		updates, err := update(rules.Rules)
+		if err != nil {
+			return err
+		}
+
+		if _, err := oxideClient.VpcFirewallRulesUpdate(ctx, oxide.VpcFirewallRulesUpdateParams{
+			Project: oxide.NameOrId(config.Project),
+			Vpc:     oxide.NameOrId(config.VPC),
+			Body:    &oxide.VpcFirewallRuleUpdateParams{Rules: updates},
+		}); err != nil {
+			return fmt.Errorf("failed updating firewall rules: %w", err)
+		}
+
+		updated, err := oxideClient.VpcFirewallRulesView(ctx, params)
+		if err != nil {
+			return fmt.Errorf("failed viewing updated firewall rules: %w", err)
+		}
+
+		if firewallRulesApplied(rules.Rules, updates, updated.Rules) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf(
+		"firewall rules of vpc %s were changed concurrently %d times while being updated",
+		config.VPC,
+		firewallRuleAttempts,
+	)
+}
+
+// firewallRulesApplied reports whether the updated rules hold every rule of
+// updates and none of the rules that updates removed from rules. Other rules
+// may have been added concurrently.
+func firewallRulesApplied(
+	rules []oxide.VpcFirewallRule,
+	updates []oxide.VpcFirewallRuleUpdate,
+	updated []oxide.VpcFirewallRule,
+) bool {
+	names := make(map[oxide.Name]bool, len(updated))
+	for _, rule := range updated {
+		names[rule.Name] = true
+	}
+
+	for _, rule := range updates {
+		if !names[rule.Name] {
+			return false
+		}
+	}
+
+	for _, rule := range rules {
+		if names[rule.Name] && !slices.ContainsFunc(
+			updates,
+			func(update oxide.VpcFirewallRuleUpdate) bool { return update.Name == rule.Name },
+		) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// firewallRuleUpdates converts firewall rules into the updates that recreate
+// them.
+func firewallRuleUpdates(rules []oxide.VpcFirewallRule) []oxide.VpcFirewallRuleUpdate {
+	updates := make([]oxide.VpcFirewallRuleUpdate, 0, len(rules)+1)
+	for _, rule := range rules {
+		updates = append(updates, oxide.VpcFirewallRuleUpdate{
+			Action:      rule.Action,
+			Description: rule.Description,
+			Direction:   rule.Direction,
+			Filters:     rule.Filters,
+			Name:        rule.Name,
+			Priority:    rule.Priority,
+			Status:      rule.Status,
+			Targets:     rule.Targets,
+		})
+	}
+
+	return updates
+}
+
+// firewallRuleSourceCIDRs returns the CIDRs allowed to connect to the
+// communicator port, which default to the address Packer uses to reach the
+// Oxide API at host.
+func firewallRuleSourceCIDRs(ctx context.Context, config *Config, host string) ([]string, error) {
+	if len(config.TemporaryFirewallRuleSourceCIDRs) > 0 {
+		return config.TemporaryFirewallRuleSourceCIDRs, nil
+	}
+
+	sourceCIDR, err := detectSourceCIDR(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed detecting source address, set temporary_firewall_rule_source_cidrs: %w",
+			err,
+		)
+	}
+
+	return []string{sourceCIDR}, nil
+}
+
+// hostFilters converts CIDRs into firewall rule host filters.
+func hostFilters(cidrs []string) []oxide.VpcFirewallRuleHostFilter {
+	hosts := make([]oxide.VpcFirewallRuleHostFilter, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		hosts = append(hosts, oxide.VpcFirewallRuleHostFilter{
+			Value: &oxide.VpcFirewallRuleHostFilterIpNet{
+				Value: ipNet(netip.MustParsePrefix(cidr)),
+			},
+		})
+	}
+
+	return hosts
+}
+
+// detectSourceCIDR returns a single address CIDR for the local address used to
+// reach the Oxide API at host.
+func detectSourceCIDR(ctx context.Context, host string) (string, error) {
+	addr, err := localaddr.Lookup(ctx, host)
+	if err != nil {
+		return "", err
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()).String(), nil
+}
+
+// ipNet converts a prefix into an Oxide IP network.
+func ipNet(prefix netip.Prefix) oxide.IpNet {
+	if prefix.Addr().Is4() {
+		v := oxide.Ipv4Net(prefix.String())
+		return oxide.IpNet{Value: &v}
+	}
+
+	v := oxide.Ipv6Net(prefix.String())
+	return oxide.IpNet{Value: &v}
+}
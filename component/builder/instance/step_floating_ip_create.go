@@ -0,0 +1,96 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+var _ multistep.Step = (*stepFloatingIPCreate)(nil)
+
+// stepFloatingIPCreate is a Packer plugin step to create an Oxide floating IP
+// for the temporary instance.
+type stepFloatingIPCreate struct{}
+
+// Run creates an Oxide floating IP and stores its information in stateBag.
+func (s *stepFloatingIPCreate) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	ui.Say("Creating Oxide floating IP")
+
+	floatingIP, err := oxideClient.FloatingIpCreate(ctx, oxide.FloatingIpCreateParams{
+		Project: oxide.NameOrId(config.Project),
+		Body: &oxide.FloatingIpCreate{
+			Name:        oxide.Name(config.Name),
+			Description: "Created by Packer.",
+			AddressAllocator: oxide.AddressAllocator{
+				Value: &oxide.AddressAllocatorAuto{
+					PoolSelector: config.ipPoolSelector(),
+				},
+			},
+		},
+	})
+	if err != nil {
+		ui.Error("Failed creating Oxide floating IP.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Sayf("Created Oxide floating IP: %s (%s)", floatingIP.Id, floatingIP.Ip)
+
+	stateBag.Put("floating_ip_id", floatingIP.Id)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the resources created by [stepFloatingIPCreate.Run].
+func (s *stepFloatingIPCreate) Cleanup(stateBag multistep.StateBag) {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	floatingIPIDRaw, ok := stateBag.GetOk("floating_ip_id")
+	if !ok {
+		return
+	}
+	floatingIPID := floatingIPIDRaw.(string)
+
+	ui.Sayf("Deleting Oxide floating IP: %s", floatingIPID)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), config.CleanupTimeout)
+	defer cancel()
+
+	// Deleting the instance detaches the floating IP, but it's still attached
+	// when the instance could not be deleted.
+	floatingIP, err := oxideClient.FloatingIpView(ctx, oxide.FloatingIpViewParams{
+		FloatingIp: oxide.NameOrId(floatingIPID),
+	})
+	if err == nil && floatingIP.InstanceId != "" {
+		_, err = oxideClient.FloatingIpDetach(ctx, oxide.FloatingIpDetachParams{
+			FloatingIp: oxide.NameOrId(floatingIPID),
+		})
+	}
+	if err == nil {
+		err = oxideClient.FloatingIpDelete(ctx, oxide.FloatingIpDeleteParams{
+			FloatingIp: oxide.NameOrId(floatingIPID),
+		})
+	}
+	if err != nil {
+		ui.Errorf(
+			"Failed deleting Oxide floating IP %s during cleanup. Please delete it manually: %v",
+			floatingIPID,
+			err,
+		)
+	}
+}
@@ -5,12 +5,14 @@
 package instance
 
 import (
+	"cmp"
 	"context"
-	"errors"
+	"slices"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/imagereplace"
 )
 
 var _ multistep.Step = (*stepImageCreate)(nil)
@@ -18,7 +20,9 @@ var _ multistep.Step = (*stepImageCreate)(nil)
 // stepImageCreate is a Packer plugin step to create an Oxide image.
 type stepImageCreate struct{}
 
-// Run creates an Oxide image and stores its information in stateBag.
+// Run creates an Oxide image from the boot disk snapshot, and one from the
+// snapshot of each additional disk with an image, and stores their information
+// in stateBag.
 func (s *stepImageCreate) Run(
 	ctx context.Context,
 	stateBag multistep.StateBag,
@@ -29,44 +33,16 @@ func (s *stepImageCreate) Run(
 
 	snapshotID := stateBag.Get("snapshot_id").(string)
 
-	// `-force` is set so we'll delete the existing image before creating a new one.
-	if config.PackerForce {
-		existingImageID := stateBag.Get("existing_image_id").(string)
-		existingImageName := stateBag.Get("existing_image_name").(string)
-
-		ui.Sayf(
-			"Deleting existing Oxide image %s (%s) because -force is set",
-			existingImageName,
-			existingImageID,
-		)
-
-		err := oxideClient.ImageDelete(ctx, oxide.ImageDeleteParams{
-			Project: oxide.NameOrId(config.Project),
-			Image:   oxide.NameOrId(existingImageName),
-		})
-		if err != nil && !errors.Is(err, oxide.ErrObjectNotFound) {
-			ui.Error("Failed deleting existing Oxide image.")
-			stateBag.Put("error", err)
-			return multistep.ActionHalt
-		}
-	}
+	// `-force` is set and an image with the artifact name exists so we'll
+	// replace the existing image with the new one.
+	_, replace := stateBag.GetOk("existing_image_id")
+	replace = replace && config.PackerForce
 
 	ui.Say("Creating Oxide image")
 
-	image, err := oxideClient.ImageCreate(ctx, oxide.ImageCreateParams{
-		Project: oxide.NameOrId(config.Project),
-		Body: &oxide.ImageCreate{
-			Name:        oxide.Name(config.ArtifactName),
-			Description: config.ArtifactDescription,
-			Os:          config.ArtifactOS,
-			Source: oxide.ImageSource{
-				Value: &oxide.ImageSourceSnapshot{
-					Id: snapshotID,
-				},
-			},
-			Version: config.ArtifactVersion,
-		},
-	})
+	body := artifactImageCreate(config, snapshotID)
+
+	image, err := s.createImage(ctx, ui, oxideClient, config, replace, body)
 	if err != nil {
 		ui.Error("Failed creating Oxide image.")
 		stateBag.Put("error", err)
@@ -78,8 +54,100 @@ func (s *stepImageCreate) Run(
 	stateBag.Put("image_id", string(image.Id))
 	stateBag.Put("image_name", string(image.Name))
 
+	if disks := config.diskImages(); len(disks) > 0 {
+		diskSnapshotIDs := stateBag.Get("disk_snapshot_ids").(map[string]string)
+
+		var existingDiskImageNames []string
+		if v, ok := stateBag.GetOk("existing_disk_image_names"); ok && config.PackerForce {
+			existingDiskImageNames = v.([]string)
+		}
+
+		diskImages := make([]DiskImage, 0, len(disks))
+		for _, disk := range disks {
+			ui.Sayf("Creating Oxide image of disk: %s", disk.Name)
+
+			image, err := s.createImage(
+				ctx,
+				ui,
+				oxideClient,
+				config,
+				slices.Contains(existingDiskImageNames, disk.Image.Name),
+				oxide.ImageCreate{
+					Name:        oxide.Name(disk.Image.Name),
+					Description: cmp.Or(disk.Image.Description, config.ArtifactDescription),
+					Os:          cmp.Or(disk.Image.OS, config.ArtifactOS),
+					Source: oxide.ImageSource{
+						Value: &oxide.ImageSourceSnapshot{
+							Id: diskSnapshotIDs[disk.Name],
+						},
+					},
+					Version: cmp.Or(disk.Image.Version, config.ArtifactVersion),
+				},
+			)
+			if err != nil {
+				ui.Error("Failed creating Oxide image of disk.")
+				stateBag.Put("error", err)
+				return multistep.ActionHalt
+			}
+
+			ui.Sayf("Created Oxide image: %s", image.Id)
+
+			diskImages = append(diskImages, DiskImage{
+				Disk:      disk.Name,
+				ImageID:   image.Id,
+				ImageName: string(image.Name),
+			})
+		}
+
+		stateBag.Put("disk_images", diskImages)
+	}
+
 	return multistep.ActionContinue
 }
 
+// createImage creates an image in the configured project. When replace is set,
+// the existing image with the same name is replaced through
+// [imagereplace.Replace].
+func (s *stepImageCreate) createImage(
+	ctx context.Context,
+	ui packer.Ui,
+	oxideClient *oxide.Client,
+	config *Config,
+	replace bool,
+	body oxide.ImageCreate,
+) (*oxide.Image, error) {
+	if replace {
+		return imagereplace.Replace(
+			ctx,
+			ui,
+			oxideClient,
+			config.Project,
+			config.CleanupTimeout,
+			body,
+		)
+	}
+
+	return oxideClient.ImageCreate(ctx, oxide.ImageCreateParams{
+		Project: oxide.NameOrId(config.Project),
+		Body:    &body,
+	})
+}
+
+// artifactImageCreate returns the request to create the artifact image from
+// the boot disk snapshot.
+func artifactImageCreate(config *Config, snapshotID string) oxide.ImageCreate {
+	return oxide.ImageCreate{
+		Name:        oxide.Name(config.ArtifactName),
+		Description: config.ArtifactDescription,
+		Os:          config.ArtifactOS,
+		Source: oxide.ImageSource{
+			Value: &oxide.ImageSourceSnapshot{
+				Id: snapshotID,
+			},
+		},
+		Version: config.ArtifactVersion,
+	}
+}
+
 // Cleanup deletes the resources created by [stepImageCreate.Run].
 func (s *stepImageCreate) Cleanup(stateBag multistep.StateBag) {}
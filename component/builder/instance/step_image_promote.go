@@ -0,0 +1,151 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/imagereplace"
+)
+
+var _ multistep.Step = (*stepImagePromote)(nil)
+
+// stepImagePromote is a Packer plugin step to promote the Oxide image to a silo
+// image.
+type stepImagePromote struct{}
+
+// Run promotes the image created by [stepImageCreate] to a silo image and
+// records the promotion in stateBag.
+func (s *stepImagePromote) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	imageID := stateBag.Get("image_id").(string)
+
+	// `-force` is set and a silo image with the artifact name exists so we'll
+	// replace the existing silo image with the new one.
+	var (
+		image *oxide.Image
+		err   error
+	)
+	if existingImageIDRaw, ok := stateBag.GetOk("existing_silo_image_id"); ok &&
+		config.PackerForce {
+		existingImage := &oxide.Image{
+			Id:   existingImageIDRaw.(string),
+			Name: oxide.Name(stateBag.Get("existing_silo_image_name").(string)),
+		}
+		body := artifactImageCreate(config, stateBag.Get("snapshot_id").(string))
+
+		image, err = s.replaceSiloImage(ctx, ui, oxideClient, config, imageID, existingImage, body)
+	} else {
+		ui.Sayf("Promoting Oxide image to silo image: %s", imageID)
+
+		image, err = oxideClient.ImagePromote(ctx, oxide.ImagePromoteParams{
+			Image: oxide.NameOrId(imageID),
+		})
+	}
+	if err != nil {
+		ui.Errorf("Failed promoting Oxide image. The project image %s is kept.", imageID)
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Sayf("Promoted Oxide image to silo image: %s", image.Id)
+
+	stateBag.Put("image_id", image.Id)
+	stateBag.Put("image_silo", true)
+
+	return multistep.ActionContinue
+}
+
+// replaceSiloImage promotes the image imageID in place of the existing silo
+// image with the same name, which is only deleted once a copy of the new image
+// could be promoted. Since images can't be renamed, the copy is created from
+// the snapshot in body under a temporary name and promoted, and then deleted
+// once the image is promoted under the final name. A failure at any stage rolls
+// back what it can and reports which images are left.
+func (s *stepImagePromote) replaceSiloImage(
+	ctx context.Context,
+	ui packer.Ui,
+	oxideClient *oxide.Client,
+	config *Config,
+	imageID string,
+	existingImage *oxide.Image,
+	body oxide.ImageCreate,
+) (*oxide.Image, error) {
+	body.Name = oxide.Name(imagereplace.TemporaryName())
+
+	ui.Sayf(
+		"Creating Oxide silo image under temporary name %s to replace %s",
+		body.Name,
+		existingImage.Name,
+	)
+
+	temporaryImage, err := oxideClient.ImageCreate(ctx, oxide.ImageCreateParams{
+		Project: oxide.NameOrId(config.Project),
+		Body:    &body,
+	})
+	if err != nil {
+		ui.Errorf("The existing Oxide silo image %s is unchanged.", existingImage.Name)
+		return nil, err
+	}
+
+	if _, err := oxideClient.ImagePromote(ctx, oxide.ImagePromoteParams{
+		Image: oxide.NameOrId(temporaryImage.Id),
+	}); err != nil {
+		imagereplace.DeleteTemporary(ui, oxideClient, config.CleanupTimeout, temporaryImage)
+		ui.Errorf("The existing Oxide silo image %s is unchanged.", existingImage.Name)
+		return nil, err
+	}
+
+	ui.Sayf(
+		"Deleting existing Oxide silo image %s (%s) because -force is set",
+		existingImage.Name,
+		existingImage.Id,
+	)
+
+	if err := oxideClient.ImageDelete(ctx, oxide.ImageDeleteParams{
+		Image: oxide.NameOrId(existingImage.Id),
+	}); err != nil && !errors.Is(err, oxide.ErrObjectNotFound) {
+		imagereplace.DeleteTemporary(ui, oxideClient, config.CleanupTimeout, temporaryImage)
+		ui.Errorf("The existing Oxide silo image %s is unchanged.", existingImage.Name)
+		return nil, fmt.Errorf(
+			"failed deleting existing silo image %s: %w",
+			existingImage.Name,
+			err,
+		)
+	}
+
+	ui.Sayf("Promoting Oxide image to silo image: %s", imageID)
+
+	image, err := oxideClient.ImagePromote(ctx, oxide.ImagePromoteParams{
+		Image: oxide.NameOrId(imageID),
+	})
+	if err != nil {
+		ui.Errorf(
+			"The existing Oxide silo image %s was deleted. The new image is kept as %s (%s).",
+			existingImage.Name,
+			temporaryImage.Name,
+			temporaryImage.Id,
+		)
+		return nil, err
+	}
+
+	imagereplace.DeleteTemporary(ui, oxideClient, config.CleanupTimeout, temporaryImage)
+
+	return image, nil
+}
+
+// Cleanup does nothing as [stepImagePromote.Run] creates no resources.
+func (s *stepImagePromote) Cleanup(stateBag multistep.StateBag) {}
@@ -6,7 +6,9 @@ package instance
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -15,44 +17,113 @@ import (
 
 var _ multistep.Step = (*stepImageView)(nil)
 
-// stepImageView is a Packer plugin step to fetch an Oxide image.
+// stepImageView is a Packer plugin step to fetch the source of an Oxide
+// instance's boot disk.
 type stepImageView struct{}
 
-// Run fetches an Oxide image and populate configuration arguments.
+// Run fetches the image, snapshot, or disk the boot disk is created from and
+// populates configuration arguments.
 func (s *stepImageView) Run(ctx context.Context, stateBag multistep.StateBag) multistep.StepAction {
 	oxideClient := stateBag.Get("client").(*oxide.Client)
 	ui := stateBag.Get("ui").(packer.Ui)
 	config := stateBag.Get("config").(*Config)
 
-	ui.Say("Fetching Oxide image metadata")
-
-	image, err := oxideClient.ImageView(ctx, oxide.ImageViewParams{
-		Image: oxide.NameOrId(config.BootDiskImageID),
-	})
+	var (
+		sourceName        oxide.Name
+		sourceDescription string
+		image             *oxide.Image
+		err               error
+	)
+
+	switch {
+	case config.BootDiskSnapshotID != "":
+		ui.Say("Fetching Oxide snapshot metadata")
+
+		snapshot, snapshotErr := oxideClient.SnapshotView(ctx, oxide.SnapshotViewParams{
+			Snapshot: oxide.NameOrId(config.BootDiskSnapshotID),
+		})
+		if snapshotErr != nil {
+			ui.Error("Failed fetching Oxide snapshot metadata.")
+			stateBag.Put("error", snapshotErr)
+			return multistep.ActionHalt
+		}
+
+		ui.Sayf("Fetched Oxide snapshot: %s", snapshot.Id)
+
+		sourceName, sourceDescription = snapshot.Name, snapshot.Description
+		image, err = diskSourceImage(ctx, oxideClient, "", snapshot.DiskId)
+	case config.BootDiskSource != "":
+		ui.Say("Fetching Oxide disk metadata")
+
+		disk, diskErr := oxideClient.DiskView(ctx, oxide.DiskViewParams{
+			Disk:    oxide.NameOrId(config.BootDiskSource),
+			Project: projectSelector(config.Project, config.BootDiskSource),
+		})
+		if diskErr != nil {
+			ui.Error("Failed fetching Oxide disk metadata.")
+			stateBag.Put("error", diskErr)
+			return multistep.ActionHalt
+		}
+
+		ui.Sayf("Fetched Oxide disk: %s", disk.Id)
+
+		stateBag.Put("source_disk_id", disk.Id)
+
+		sourceName, sourceDescription = disk.Name, disk.Description
+		image, err = diskSourceImage(ctx, oxideClient, disk.ImageId, "")
+	default:
+		ui.Say("Fetching Oxide image metadata")
+
+		image, err = oxideClient.ImageView(ctx, oxide.ImageViewParams{
+			Image: oxide.NameOrId(config.BootDiskImageID),
+		})
+		if err != nil {
+			ui.Error("Failed fetching Oxide image metadata.")
+			stateBag.Put("error", err)
+			return multistep.ActionHalt
+		}
+
+		ui.Sayf("Fetched Oxide image: %s", image.Id)
+
+		sourceName, sourceDescription = image.Name, image.Description
+	}
 	if err != nil {
-		ui.Error("Failed fetching Oxide image metadata.")
+		ui.Error("Failed fetching Oxide image metadata of boot disk source.")
 		stateBag.Put("error", err)
 		return multistep.ActionHalt
 	}
 
-	ui.Sayf("Fetched Oxide image: %s", image.Id)
+	// Snapshots and disks only provide the OS and version of the image they
+	// originate from, when it still exists.
+	sourceImageID := ""
+	if image != nil {
+		sourceImageID = image.Id
 
-	stateBag.Put("source_image_id", string(image.Id))
+		if config.ArtifactOS == "" {
+			config.ArtifactOS = image.Os
+		}
 
-	if config.ArtifactName == "" {
-		config.ArtifactName = fmt.Sprintf("%s-%s", image.Name, config.uniqueSuffix())
+		if config.ArtifactVersion == "" {
+			config.ArtifactVersion = image.Version
+		}
 	}
 
-	if config.ArtifactDescription == "" {
-		config.ArtifactDescription = image.Description
+	stateBag.Put("source_image_id", sourceImageID)
+
+	if config.ArtifactName == "" {
+		config.ArtifactName = fmt.Sprintf("%s-%s", sourceName, config.uniqueSuffix())
 	}
 
-	if config.ArtifactOS == "" {
-		config.ArtifactOS = image.Os
+	if config.ArtifactDescription == "" {
+		config.ArtifactDescription = sourceDescription
 	}
 
-	if config.ArtifactVersion == "" {
-		config.ArtifactVersion = image.Version
+	if !config.SkipCreateImage && (config.ArtifactOS == "" || config.ArtifactVersion == "") {
+		ui.Error("Failed deriving artifact OS and version from boot disk source.")
+		stateBag.Put("error", errors.New(
+			"artifact_os and artifact_version are required when the boot disk source has no image",
+		))
+		return multistep.ActionHalt
 	}
 
 	return multistep.ActionContinue
@@ -60,3 +131,57 @@ func (s *stepImageView) Run(ctx context.Context, stateBag multistep.StateBag) mu
 
 // Cleanup deletes the resources created by [stepImageView.Run].
 func (s *stepImageView) Cleanup(stateBag multistep.StateBag) {}
+
+// diskSourceImage returns the image a disk was created from, given either the
+// image ID or the disk ID. It returns nil when there's no such image, such as
+// when the disk was blank or the image or disk has since been deleted.
+func diskSourceImage(
+	ctx context.Context,
+	oxideClient *oxide.Client,
+	imageID string,
+	diskID string,
+) (*oxide.Image, error) {
+	if imageID == "" && diskID != "" {
+		disk, err := oxideClient.DiskView(ctx, oxide.DiskViewParams{
+			Disk: oxide.NameOrId(diskID),
+		})
+		if err != nil {
+			if errors.Is(err, oxide.ErrObjectNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		imageID = disk.ImageId
+	}
+
+	if imageID == "" {
+		return nil, nil
+	}
+
+	image, err := oxideClient.ImageView(ctx, oxide.ImageViewParams{
+		Image: oxide.NameOrId(imageID),
+	})
+	if err != nil {
+		if errors.Is(err, oxide.ErrObjectNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// uuidPattern matches the IDs of Oxide resources.
+var uuidPattern = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`,
+)
+
+// projectSelector returns the project to look up nameOrID within. Oxide rejects
+// a project alongside an ID, so it's only returned for names.
+func projectSelector(project string, nameOrID string) oxide.NameOrId {
+	if uuidPattern.MatchString(nameOrID) {
+		return ""
+	}
+
+	return oxide.NameOrId(project)
+}
@@ -7,8 +7,6 @@ package instance
 import (
 	"context"
 	"encoding/base64"
-	"fmt"
-	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -29,54 +27,75 @@ func (o *stepInstanceCreate) Run(
 	ui := stateBag.Get("ui").(packer.Ui)
 	config := stateBag.Get("config").(*Config)
 
+	if config.SerialConsoleLog != "" {
+		serialConsoleLog, err := newSerialConsoleLogger(oxideClient, config.SerialConsoleLog)
+		if err != nil {
+			ui.Error("Failed creating Oxide instance serial console log.")
+			stateBag.Put("error", err)
+			return multistep.ActionHalt
+		}
+
+		stateBag.Put("serial_console_log", serialConsoleLog)
+	}
+
+	externalIPs := []oxide.ExternalIpCreate{}
+	if *config.AssociateExternalIP {
+		externalIPs = append(externalIPs, oxide.ExternalIpCreate{
+			Value: &oxide.ExternalIpCreateEphemeral{
+				PoolSelector: config.ipPoolSelector(),
+			},
+		})
+	}
+
+	floatingIP := config.FloatingIP
+	if floatingIPID, ok := stateBag.GetOk("floating_ip_id"); ok {
+		floatingIP = floatingIPID.(string)
+	}
+	if floatingIP != "" {
+		externalIPs = append(externalIPs, oxide.ExternalIpCreate{
+			Value: &oxide.ExternalIpCreateFloating{
+				FloatingIp: oxide.NameOrId(floatingIP),
+			},
+		})
+	}
+
+	bootDisk := oxide.InstanceDiskAttachment{
+		Value: &oxide.InstanceDiskAttachmentCreate{
+			Name:        oxide.Name(config.Name),
+			Description: "Created by Packer.",
+			Size:        oxide.ByteCount(config.BootDiskSize),
+			DiskBackend: oxide.DiskBackend{
+				Value: &oxide.DiskBackendDistributed{
+					DiskSource: bootDiskSource(stateBag, config),
+				},
+			},
+		},
+	}
+	disks := diskAttachments(config.Disks)
+
+	// An instance installing from an ISO has no boot disk, so its firmware
+	// tries each disk in order. The blank disk the ISO installs to comes first
+	// and fails to boot until the installation completes.
+	_, bootISO := stateBag.GetOk("iso_image_id")
+	if bootISO {
+		bootDisk = oxide.InstanceDiskAttachment{}
+		disks = append(isoDiskAttachments(stateBag, config), disks...)
+	}
+
 	ui.Say("Creating Oxide instance")
 
 	instance, err := oxideClient.InstanceCreate(ctx, oxide.InstanceCreateParams{
 		Project: oxide.NameOrId(config.Project),
 		Body: &oxide.InstanceCreate{
 			AntiAffinityGroups: []oxide.NameOrId{},
-			BootDisk: oxide.InstanceDiskAttachment{
-				Value: &oxide.InstanceDiskAttachmentCreate{
-					Name:        oxide.Name(config.Name),
-					Description: "Created by Packer.",
-					Size:        oxide.ByteCount(config.BootDiskSize),
-					DiskBackend: oxide.DiskBackend{
-						Value: &oxide.DiskBackendDistributed{
-							DiskSource: oxide.DiskSource{
-								Value: &oxide.DiskSourceImage{
-									ImageId: config.BootDiskImageID,
-								},
-							},
-						},
-					},
-				},
-			},
-			Description: "Created by Packer.",
-			ExternalIps: []oxide.ExternalIpCreate{
-				{
-					Value: &oxide.ExternalIpCreateEphemeral{
-						PoolSelector: func() oxide.PoolSelector {
-							if config.IPPool == "" {
-								return oxide.PoolSelector{
-									Value: &oxide.PoolSelectorAuto{
-										IpVersion: oxide.IpVersionV4,
-									},
-								}
-							}
-
-							return oxide.PoolSelector{
-								Value: &oxide.PoolSelectorExplicit{
-									Pool: oxide.NameOrId(config.IPPool),
-								},
-							}
-						}(),
-					},
-				},
-			},
-			Hostname: oxide.Hostname(config.Hostname),
-			Memory:   oxide.ByteCount(config.Memory),
-			Name:     oxide.Name(config.Name),
-			Ncpus:    oxide.InstanceCpuCount(config.CPUs),
+			BootDisk:           bootDisk,
+			Description:        "Created by Packer.",
+			Disks:              disks,
+			ExternalIps:        externalIPs,
+			Hostname:           oxide.Hostname(config.Hostname),
+			Memory:             oxide.ByteCount(config.Memory),
+			Name:               oxide.Name(config.Name),
+			Ncpus:              oxide.InstanceCpuCount(config.CPUs),
 			NetworkInterfaces: oxide.InstanceNetworkInterfaceAttachment{
 				Value: &oxide.InstanceNetworkInterfaceAttachmentCreate{
 					Params: []oxide.InstanceNetworkInterfaceCreate{
@@ -85,15 +104,7 @@ func (o *stepInstanceCreate) Run(
 							Description: "Created by Packer.",
 							SubnetName:  oxide.Name(config.Subnet),
 							VpcName:     oxide.Name(config.VPC),
-							IpConfig: oxide.PrivateIpStackCreate{
-								Value: oxide.PrivateIpStackCreateV4{
-									Value: oxide.PrivateIpv4StackCreate{
-										Ip: oxide.Ipv4Assignment{
-											Value: &oxide.Ipv4AssignmentAuto{},
-										},
-									},
-								},
-							},
+							IpConfig:    config.privateIPStack(),
 						},
 					},
 				},
@@ -129,37 +140,56 @@ func (o *stepInstanceCreate) Run(
 	ui.Sayf("Created Oxide instance: %s", instance.Id)
 
 	stateBag.Put("instance_id", instance.Id)
-	stateBag.Put("boot_disk_id", instance.BootDiskId)
-
-	ui.Sayf("Waiting for Oxide instance to start: Currently %s.", instance.RunState)
 
-	startCtx, startCtxCancel := context.WithTimeout(ctx, 30*time.Second)
-	defer startCtxCancel()
-
-	for {
-		select {
-		case <-startCtx.Done():
-			ui.Error("Timed out waiting for Oxide instance to start.")
-			return multistep.ActionHalt
-		default:
+	var cleanupDisks []string
+	if bootISO {
+		cleanupDisks = append(cleanupDisks, isoDiskName(config))
+	}
+	for _, disk := range config.Disks {
+		if *disk.DeleteOnCleanup {
+			cleanupDisks = append(cleanupDisks, disk.Name)
 		}
+	}
+	stateBag.Put("cleanup_disks", cleanupDisks)
 
-		instance, err := oxideClient.InstanceView(startCtx, oxide.InstanceViewParams{
-			Instance: oxide.NameOrId(instance.Id),
+	bootDiskID := instance.BootDiskId
+	if bootISO {
+		disk, err := oxideClient.DiskView(ctx, oxide.DiskViewParams{
+			Disk:    oxide.NameOrId(config.Name),
+			Project: oxide.NameOrId(config.Project),
 		})
 		if err != nil {
-			ui.Error("Failed refreshing Oxide instance state.")
+			// Delete the boot disk by name since its ID is unknown.
+			stateBag.Put("cleanup_disks", append(cleanupDisks, config.Name))
+
+			ui.Error("Failed viewing Oxide instance boot disk.")
 			stateBag.Put("error", err)
 			return multistep.ActionHalt
 		}
+		bootDiskID = disk.Id
+	}
+	stateBag.Put("boot_disk_id", bootDiskID)
 
-		if instance.RunState == oxide.InstanceStateRunning {
-			ui.Say(fmt.Sprintf("Oxide instance is %s.", instance.RunState))
-			break
-		}
+	if serialConsoleLogRaw, ok := stateBag.GetOk("serial_console_log"); ok {
+		ui.Sayf("Writing Oxide instance serial console output to %s", config.SerialConsoleLog)
+		serialConsoleLogRaw.(*serialConsoleLogger).Start(ctx, instance.Id)
+	}
 
-		ui.Say(fmt.Sprintf("Waiting for Oxide instance to start: Currently %s.", instance.RunState))
-		time.Sleep(3 * time.Second)
+	ui.Sayf("Waiting for Oxide instance to start: Currently %s.", instance.RunState)
+
+	if err := waitForInstanceState(
+		ctx,
+		oxideClient,
+		ui,
+		waiter{Interval: config.PollInterval, Timeout: config.InstanceStartTimeout},
+		instance.Id,
+		oxide.InstanceStateRunning,
+		"Waiting for Oxide instance to start",
+		false,
+	); err != nil {
+		ui.Errorf("Failed waiting for Oxide instance to start: %v", err)
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
 	}
 
 	return multistep.ActionContinue
@@ -169,6 +199,26 @@ func (o *stepInstanceCreate) Run(
 func (o *stepInstanceCreate) Cleanup(stateBag multistep.StateBag) {
 	oxideClient := stateBag.Get("client").(*oxide.Client)
 	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	// Capture the remaining serial console output before the instance is
+	// deleted.
+	if serialConsoleLogRaw, ok := stateBag.GetOk("serial_console_log"); ok {
+		serialConsoleLog := serialConsoleLogRaw.(*serialConsoleLogger)
+
+		ctx, cancel := context.WithTimeout(context.TODO(), config.CleanupTimeout)
+		defer cancel()
+
+		if err := serialConsoleLog.Close(ctx); err != nil {
+			ui.Errorf("Failed writing Oxide instance serial console log: %v", err)
+		}
+
+		if _, halted := stateBag.GetOk(multistep.StateHalted); halted {
+			if tail := serialConsoleLog.Tail(serialConsoleTailLines); tail != "" {
+				ui.Sayf("Last lines of Oxide instance serial console output:\n%s", tail)
+			}
+		}
+	}
 
 	if instanceIDRaw, ok := stateBag.GetOk("instance_id"); ok {
 		instanceID := instanceIDRaw.(string)
@@ -177,7 +227,7 @@ func (o *stepInstanceCreate) Cleanup(stateBag multistep.StateBag) {
 
 		instanceStopCtx, instanceStopCtxCancel := context.WithTimeout(
 			context.TODO(),
-			30*time.Second,
+			config.CleanupTimeout,
 		)
 		defer instanceStopCtxCancel()
 
@@ -189,58 +239,45 @@ func (o *stepInstanceCreate) Cleanup(stateBag multistep.StateBag) {
 			return
 		}
 
-		if instance.RunState == oxide.InstanceStateStopped {
-			goto deleteInstance
-		}
-
-		ui.Sayf("Stopping Oxide instance: %s", instanceID)
-
-		if _, err := oxideClient.InstanceStop(instanceStopCtx, oxide.InstanceStopParams{
-			Instance: oxide.NameOrId(instanceID),
-		}); err != nil {
-			ui.Errorf(
-				"Failed stopping Oxide instance during cleanup. Please delete it manually: %v",
-				err,
-			)
-			return
-		}
-
-		for {
-			select {
-			case <-instanceStopCtx.Done():
-				ui.Error("Timed out waiting for Oxide instance to stop.")
-				return
-			default:
-			}
+		// Instances can be deleted once stopped or failed.
+		if instance.RunState != oxide.InstanceStateStopped &&
+			instance.RunState != oxide.InstanceStateFailed {
+			ui.Sayf("Stopping Oxide instance: %s", instanceID)
 
-			instance, err := oxideClient.InstanceView(instanceStopCtx, oxide.InstanceViewParams{
+			if _, err := oxideClient.InstanceStop(instanceStopCtx, oxide.InstanceStopParams{
 				Instance: oxide.NameOrId(instanceID),
-			})
-			if err != nil {
-				ui.Errorf("Failed refreshing Oxide instance state: %v", err)
-				time.Sleep(3 * time.Second)
-				continue
+			}); err != nil {
+				ui.Errorf(
+					"Failed stopping Oxide instance during cleanup. Please delete it manually: %v",
+					err,
+				)
+				return
 			}
 
-			if instance.RunState == oxide.InstanceStateStopped {
-				break
+			if err := waitForInstanceState(
+				instanceStopCtx,
+				oxideClient,
+				ui,
+				waiter{Interval: config.PollInterval, Timeout: config.CleanupTimeout},
+				instanceID,
+				oxide.InstanceStateStopped,
+				"Waiting for Oxide instance to stop",
+				true,
+			); err != nil && !isInstanceFailed(err) {
+				ui.Errorf(
+					"Failed waiting for Oxide instance to stop during cleanup. "+
+						"Please delete it manually: %v",
+					err,
+				)
+				return
 			}
-
-			ui.Say(
-				fmt.Sprintf(
-					"Waiting for instance to stop. Instance is currently %s.",
-					instance.RunState,
-				),
-			)
-			time.Sleep(3 * time.Second)
 		}
 
-	deleteInstance:
 		ui.Sayf("Deleting Oxide instance: %s", instanceID)
 
 		instanceDeleteCtx, instanceDeleteCtxCancel := context.WithTimeout(
 			context.TODO(),
-			30*time.Second,
+			config.CleanupTimeout,
 		)
 		defer instanceDeleteCtxCancel()
 
@@ -255,12 +292,38 @@ func (o *stepInstanceCreate) Cleanup(stateBag multistep.StateBag) {
 		}
 	}
 
+	if cleanupDisksRaw, ok := stateBag.GetOk("cleanup_disks"); ok {
+		diskDeleteCtx, diskDeleteCtxCancel := context.WithTimeout(
+			context.TODO(),
+			config.CleanupTimeout,
+		)
+		defer diskDeleteCtxCancel()
+
+		for _, diskName := range cleanupDisksRaw.([]string) {
+			ui.Sayf("Deleting Oxide disk: %s", diskName)
+
+			if err := oxideClient.DiskDelete(diskDeleteCtx, oxide.DiskDeleteParams{
+				Disk:    oxide.NameOrId(diskName),
+				Project: oxide.NameOrId(config.Project),
+			}); err != nil {
+				ui.Errorf(
+					"Failed deleting Oxide disk %s during cleanup. Please delete it manually: %v",
+					diskName,
+					err,
+				)
+			}
+		}
+	}
+
 	if bootDiskIDRaw, ok := stateBag.GetOk("boot_disk_id"); ok {
 		bootDiskID := bootDiskIDRaw.(string)
 
 		ui.Sayf("Deleting Oxide disk: %s", bootDiskID)
 
-		diskDeleteCtx, diskDeleteCtxCancel := context.WithTimeout(context.TODO(), 30*time.Second)
+		diskDeleteCtx, diskDeleteCtxCancel := context.WithTimeout(
+			context.TODO(),
+			config.CleanupTimeout,
+		)
 		defer diskDeleteCtxCancel()
 
 		if err := oxideClient.DiskDelete(diskDeleteCtx, oxide.DiskDeleteParams{
@@ -274,3 +337,106 @@ func (o *stepInstanceCreate) Cleanup(stateBag multistep.StateBag) {
 		}
 	}
 }
+
+// bootDiskSource returns the source the instance's boot disk is created from.
+func bootDiskSource(stateBag multistep.StateBag, config *Config) oxide.DiskSource {
+	switch {
+	case config.BootDiskSnapshotID != "":
+		return oxide.DiskSource{
+			Value: &oxide.DiskSourceSnapshot{SnapshotId: config.BootDiskSnapshotID},
+		}
+	case config.BootDiskSource != "":
+		return oxide.DiskSource{
+			Value: &oxide.DiskSourceSnapshot{
+				SnapshotId: stateBag.Get("boot_disk_snapshot_id").(string),
+			},
+		}
+	default:
+		return oxide.DiskSource{
+			Value: &oxide.DiskSourceImage{ImageId: config.BootDiskImageID},
+		}
+	}
+}
+
+// isoDiskName returns the name of the disk created from the ISO image.
+func isoDiskName(config *Config) string {
+	return config.Name + "-iso"
+}
+
+// isoDiskAttachments returns the attachments that create the blank disk an
+// ISO installs to and the disk with the ISO image stored in stateBag.
+func isoDiskAttachments(
+	stateBag multistep.StateBag,
+	config *Config,
+) []oxide.InstanceDiskAttachment {
+	return []oxide.InstanceDiskAttachment{
+		{
+			Value: &oxide.InstanceDiskAttachmentCreate{
+				Name:        oxide.Name(config.Name),
+				Description: "Created by Packer.",
+				Size:        oxide.ByteCount(config.BootDiskSize),
+				DiskBackend: oxide.DiskBackend{
+					Value: &oxide.DiskBackendDistributed{
+						DiskSource: oxide.DiskSource{
+							Value: &oxide.DiskSourceBlank{BlockSize: 512},
+						},
+					},
+				},
+			},
+		},
+		{
+			Value: &oxide.InstanceDiskAttachmentCreate{
+				Name:        oxide.Name(isoDiskName(config)),
+				Description: "Created by Packer.",
+				Size:        oxide.ByteCount(stateBag.Get("iso_disk_size").(uint64)),
+				DiskBackend: oxide.DiskBackend{
+					Value: &oxide.DiskBackendDistributed{
+						DiskSource: oxide.DiskSource{
+							Value: &oxide.DiskSourceImage{
+								ImageId: stateBag.Get("iso_image_id").(string),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// diskAttachments returns the attachments that create or attach the additional
+// disks of the instance.
+func diskAttachments(disks []DiskConfig) []oxide.InstanceDiskAttachment {
+	attachments := make([]oxide.InstanceDiskAttachment, 0, len(disks))
+
+	for _, disk := range disks {
+		if disk.Existing {
+			attachments = append(attachments, oxide.InstanceDiskAttachment{
+				Value: &oxide.InstanceDiskAttachmentAttach{Name: oxide.Name(disk.Name)},
+			})
+			continue
+		}
+
+		diskSource := oxide.DiskSource{Value: &oxide.DiskSourceBlank{BlockSize: 4096}}
+		switch {
+		case disk.ImageID != "":
+			diskSource = oxide.DiskSource{Value: &oxide.DiskSourceImage{ImageId: disk.ImageID}}
+		case disk.SnapshotID != "":
+			diskSource = oxide.DiskSource{
+				Value: &oxide.DiskSourceSnapshot{SnapshotId: disk.SnapshotID},
+			}
+		}
+
+		attachments = append(attachments, oxide.InstanceDiskAttachment{
+			Value: &oxide.InstanceDiskAttachmentCreate{
+				Name:        oxide.Name(disk.Name),
+				Description: "Created by Packer.",
+				Size:        oxide.ByteCount(disk.Size),
+				DiskBackend: oxide.DiskBackend{
+					Value: &oxide.DiskBackendDistributed{DiskSource: diskSource},
+				},
+			},
+		})
+	}
+
+	return attachments
+}
@@ -5,7 +5,9 @@
 package instance
 
 import (
+	"cmp"
 	"context"
+	"errors"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -26,6 +28,7 @@ func (s *stepInstanceExternalIPList) Run(
 ) multistep.StepAction {
 	oxideClient := stateBag.Get("client").(*oxide.Client)
 	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
 
 	ui.Say("Listing external IPs for Oxide instance")
 
@@ -45,27 +48,31 @@ func (s *stepInstanceExternalIPList) Run(
 		return multistep.ActionHalt
 	}
 
-	// Filter out invalid external IPs (e.g., SNAT) and extract the IP.
-	var externalIP string
+	// Filter out invalid external IPs (e.g., SNAT) and extract the IP. Floating
+	// IPs are preferred over ephemeral IPs since they're configured explicitly.
+	var ephemeralIPs, floatingIPs []string
 	for _, eip := range results.Items {
 		switch eip.Kind() {
 		case oxide.ExternalIpKindEphemeral:
 			if v, ok := eip.AsEphemeral(); ok {
-				externalIP = v.Ip
+				ephemeralIPs = append(ephemeralIPs, v.Ip)
 			}
 		case oxide.ExternalIpKindFloating:
 			if v, ok := eip.AsFloating(); ok {
-				externalIP = v.Ip
+				floatingIPs = append(floatingIPs, v.Ip)
 			}
 		}
-		if externalIP != "" {
-			break
-		}
 	}
+	externalIP := cmp.Or(config.selectIP(floatingIPs...), config.selectIP(ephemeralIPs...))
 
 	if externalIP == "" {
 		ui.Error(
-			"Instance does not have any valid external IPs. Packer will be unable to connect to this instance.",
+			"Instance does not have any valid external IPs of the configured IP version. " +
+				"Packer will be unable to connect to this instance.",
+		)
+		stateBag.Put(
+			"error",
+			errors.New("instance has no valid external IP of the configured IP version"),
 		)
 		return multistep.ActionHalt
 	}
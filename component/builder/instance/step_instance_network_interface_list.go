@@ -0,0 +1,94 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+var _ multistep.Step = (*stepInstanceNetworkInterfaceList)(nil)
+
+// stepInstanceNetworkInterfaceList is a Packer plugin step to list the network
+// interfaces for an Oxide instance.
+type stepInstanceNetworkInterfaceList struct{}
+
+// Run lists the network interfaces for an Oxide instance and stores the private
+// IP of its primary network interface in stateBag.
+func (s *stepInstanceNetworkInterfaceList) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	ui.Say("Listing network interfaces for Oxide instance")
+
+	instanceIDRaw, ok := stateBag.GetOk("instance_id")
+	if !ok {
+		ui.Error("State does not contain instance ID. Cannot proceed!")
+		return multistep.ActionHalt
+	}
+	instanceID := instanceIDRaw.(string)
+
+	nics, err := oxideClient.InstanceNetworkInterfaceListAllPages(
+		ctx,
+		oxide.InstanceNetworkInterfaceListParams{
+			Instance: oxide.NameOrId(instanceID),
+		},
+	)
+	if err != nil {
+		ui.Error("Failed listing network interfaces for Oxide instance.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	var privateIP string
+	for _, nic := range nics {
+		if nic.Primary != nil && *nic.Primary {
+			privateIP = config.selectIP(privateIPs(nic.IpStack)...)
+			break
+		}
+	}
+
+	if privateIP == "" {
+		ui.Error(
+			"Instance does not have a primary network interface with a private IP of the " +
+				"configured IP version. Packer will be unable to connect to this instance.",
+		)
+		stateBag.Put(
+			"error",
+			errors.New("instance has no private IP of the configured IP version"),
+		)
+		return multistep.ActionHalt
+	}
+
+	stateBag.Put("private_ip", privateIP)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the resources created by [stepInstanceNetworkInterfaceList.Run].
+func (s *stepInstanceNetworkInterfaceList) Cleanup(stateBag multistep.StateBag) {}
+
+// privateIPs returns the private IPs of a network interface's IP stack.
+func privateIPs(stack oxide.PrivateIpStack) []string {
+	if v, ok := stack.AsV4(); ok {
+		return []string{v.Value.Ip}
+	}
+	if v, ok := stack.AsV6(); ok {
+		return []string{v.Value.Ip}
+	}
+	if v, ok := stack.AsDualStack(); ok {
+		return []string{v.Value.V4.Ip, v.Value.V6.Ip}
+	}
+
+	return nil
+}
@@ -6,8 +6,6 @@ package instance
 
 import (
 	"context"
-	"fmt"
-	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -26,6 +24,7 @@ func (s *stepInstanceStop) Run(
 ) multistep.StepAction {
 	oxideClient := stateBag.Get("client").(*oxide.Client)
 	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
 
 	ui.Say("Stopping Oxide instance")
 
@@ -47,33 +46,19 @@ func (s *stepInstanceStop) Run(
 
 	ui.Sayf("Waiting for Oxide instance to stop: Currently %s.", instance.RunState)
 
-	timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	for {
-		select {
-		case <-timeoutCtx.Done():
-			ui.Error("Timed out waiting for Oxide instance to stop.")
-			return multistep.ActionHalt
-		default:
-		}
-
-		instance, err := oxideClient.InstanceView(timeoutCtx, oxide.InstanceViewParams{
-			Instance: oxide.NameOrId(instanceID),
-		})
-		if err != nil {
-			ui.Error("Failed refreshing Oxide instance state.")
-			stateBag.Put("error", err)
-			return multistep.ActionHalt
-		}
-
-		if instance.RunState == oxide.InstanceStateStopped {
-			ui.Say(fmt.Sprintf("Oxide instance is %s.", instance.RunState))
-			break
-		}
-
-		ui.Say(fmt.Sprintf("Waiting for Oxide instance to stop: Currently %s.", instance.RunState))
-		time.Sleep(3 * time.Second)
+	if err := waitForInstanceState(
+		ctx,
+		oxideClient,
+		ui,
+		waiter{Interval: config.PollInterval, Timeout: config.InstanceStopTimeout},
+		instanceID,
+		oxide.InstanceStateStopped,
+		"Waiting for Oxide instance to stop",
+		false,
+	); err != nil {
+		ui.Errorf("Failed waiting for Oxide instance to stop: %v", err)
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
 	}
 
 	return multistep.ActionContinue
@@ -0,0 +1,207 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+var _ multistep.Step = (*stepNetworkCreate)(nil)
+
+// stepNetworkCreate is a Packer plugin step to create a dedicated Oxide VPC and
+// subnet for the temporary instance.
+type stepNetworkCreate struct{}
+
+// Run creates an Oxide VPC, replaces its default subnet and firewall rules with
+// ones for the build, and stores the IDs of the VPC and subnet in stateBag.
+func (s *stepNetworkCreate) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	// The firewall rules are resolved before creating anything so that a
+	// failure to detect the source address leaves nothing to clean up.
+	var sourceCIDRs []string
+	if networkCommunicator(config) {
+		var err error
+		sourceCIDRs, err = firewallRuleSourceCIDRs(ctx, config, oxideClient.Host())
+		if err != nil {
+			ui.Error("Failed detecting the source address for the temporary Oxide VPC firewall.")
+			stateBag.Put("error", err)
+			return multistep.ActionHalt
+		}
+	}
+
+	ui.Say("Creating temporary Oxide VPC")
+
+	vpc, err := oxideClient.VpcCreate(ctx, oxide.VpcCreateParams{
+		Project: oxide.NameOrId(config.Project),
+		Body: &oxide.VpcCreate{
+			Name:        oxide.Name(config.VPC),
+			DnsName:     oxide.Name(config.VPC),
+			Description: "Created by Packer.",
+		},
+	})
+	if err != nil {
+		ui.Error("Failed creating temporary Oxide VPC.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Sayf("Created temporary Oxide VPC: %s", vpc.Id)
+
+	stateBag.Put("vpc_id", vpc.Id)
+
+	// New VPCs have a default subnet, which is removed so the VPC only contains
+	// the subnet configured for the build.
+	if err := oxideClient.VpcSubnetDelete(ctx, oxide.VpcSubnetDeleteParams{
+		Project: oxide.NameOrId(config.Project),
+		Vpc:     oxide.NameOrId(config.VPC),
+		Subnet:  oxide.NameOrId("default"),
+	}); err != nil {
+		ui.Error("Failed deleting default subnet of temporary Oxide VPC.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Creating temporary Oxide VPC subnet")
+
+	subnet, err := oxideClient.VpcSubnetCreate(ctx, oxide.VpcSubnetCreateParams{
+		Project: oxide.NameOrId(config.Project),
+		Vpc:     oxide.NameOrId(config.VPC),
+		Body: &oxide.VpcSubnetCreate{
+			Name:        oxide.Name(config.Subnet),
+			Description: "Created by Packer.",
+			Ipv4Block:   oxide.Ipv4Net(config.TemporaryNetworkIPv4Block),
+		},
+	})
+	if err != nil {
+		ui.Error("Failed creating temporary Oxide VPC subnet.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Sayf("Created temporary Oxide VPC subnet: %s (%s)", subnet.Id, subnet.Ipv4Block)
+
+	stateBag.Put("subnet_id", subnet.Id)
+
+	if _, err := oxideClient.VpcFirewallRulesUpdate(ctx, oxide.VpcFirewallRulesUpdateParams{
+		Project: oxide.NameOrId(config.Project),
+		Vpc:     oxide.NameOrId(config.VPC),
+		Body: &oxide.VpcFirewallRuleUpdateParams{
+			Rules: networkFirewallRules(config, sourceCIDRs),
+		},
+	}); err != nil {
+		ui.Error("Failed updating temporary Oxide VPC firewall rules.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the resources created by [stepNetworkCreate.Run].
+func (s *stepNetworkCreate) Cleanup(stateBag multistep.StateBag) {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	vpcIDRaw, ok := stateBag.GetOk("vpc_id")
+	if !ok {
+		return
+	}
+	vpcID := vpcIDRaw.(string)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), config.CleanupTimeout)
+	defer cancel()
+
+	// A VPC can't be deleted while it has subnets. Listing them also covers the
+	// default subnet when the build failed before it was deleted.
+	subnets, err := oxideClient.VpcSubnetListAllPages(ctx, oxide.VpcSubnetListParams{
+		Vpc: oxide.NameOrId(vpcID),
+	})
+	if err != nil {
+		ui.Errorf(
+			"Failed listing subnets of temporary Oxide VPC %s during cleanup. "+
+				"Please delete it manually: %v",
+			vpcID,
+			err,
+		)
+		return
+	}
+
+	for _, subnet := range subnets {
+		ui.Sayf("Deleting temporary Oxide VPC subnet: %s", subnet.Id)
+
+		if err := oxideClient.VpcSubnetDelete(ctx, oxide.VpcSubnetDeleteParams{
+			Subnet: oxide.NameOrId(subnet.Id),
+		}); err != nil {
+			ui.Errorf(
+				"Failed deleting temporary Oxide VPC subnet %s during cleanup. "+
+					"Please delete it and VPC %s manually: %v",
+				subnet.Id,
+				vpcID,
+				err,
+			)
+			return
+		}
+	}
+
+	ui.Sayf("Deleting temporary Oxide VPC: %s", vpcID)
+
+	if err := oxideClient.VpcDelete(ctx, oxide.VpcDeleteParams{
+		Vpc: oxide.NameOrId(vpcID),
+	}); err != nil {
+		ui.Errorf(
+			"Failed deleting temporary Oxide VPC %s during cleanup. Please delete it manually: %v",
+			vpcID,
+			err,
+		)
+	}
+}
+
+// networkFirewallRules returns the firewall rules of a VPC created with
+// `temporary_network`, which only allow inbound connections to the
+// communicator port from sourceCIDRs.
+func networkFirewallRules(config *Config, sourceCIDRs []string) []oxide.VpcFirewallRuleUpdate {
+	if !networkCommunicator(config) {
+		return []oxide.VpcFirewallRuleUpdate{}
+	}
+
+	return []oxide.VpcFirewallRuleUpdate{
+		{
+			Action:      oxide.VpcFirewallRuleActionAllow,
+			Description: "Created by Packer.",
+			Direction:   oxide.VpcFirewallRuleDirectionInbound,
+			Filters: oxide.VpcFirewallRuleFilter{
+				Hosts: hostFilters(sourceCIDRs),
+				Ports: []oxide.L4PortRange{oxide.L4PortRange(strconv.Itoa(config.Comm.Port()))},
+				Protocols: []oxide.VpcFirewallRuleProtocol{
+					{Value: &oxide.VpcFirewallRuleProtocolTcp{}},
+				},
+			},
+			Name:     oxide.Name("allow-" + config.Comm.Type),
+			Priority: oxide.NewPointer(65534),
+			Status:   oxide.VpcFirewallRuleStatusEnabled,
+			Targets: []oxide.VpcFirewallRuleTarget{
+				{Value: &oxide.VpcFirewallRuleTargetVpc{Value: oxide.Name(config.VPC)}},
+			},
+		},
+	}
+}
+
+// networkCommunicator reports whether the communicator connects to the
+// instance over the network through a port opened in the VPC firewall.
+func networkCommunicator(config *Config) bool {
+	return config.Comm.Type == "ssh" || config.Comm.Type == "winrm"
+}
@@ -6,7 +6,7 @@ package instance
 
 import (
 	"context"
-	"time"
+	"fmt"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -15,11 +15,11 @@ import (
 
 var _ multistep.Step = (*stepSnapshotCreate)(nil)
 
-// stepSnapshotCreate is a Packer plugin step to create a snapshot from an Oxide
-// instance's boot disk.
+// stepSnapshotCreate is a Packer plugin step to create snapshots from an Oxide
+// instance's boot disk and the additional disks that images are created from.
 type stepSnapshotCreate struct{}
 
-// Run creates an Oxide snapshot and stores its information in stateBag.
+// Run creates Oxide snapshots and stores their information in stateBag.
 func (s *stepSnapshotCreate) Run(
 	ctx context.Context,
 	stateBag multistep.StateBag,
@@ -55,6 +55,30 @@ func (s *stepSnapshotCreate) Run(
 
 	stateBag.Put("snapshot_id", snapshot.Id)
 
+	diskSnapshotIDs := make(map[string]string)
+	for i, disk := range config.diskImages() {
+		ui.Sayf("Creating Oxide snapshot of disk: %s", disk.Name)
+
+		snapshot, err := oxideClient.SnapshotCreate(ctx, oxide.SnapshotCreateParams{
+			Project: oxide.NameOrId(config.Project),
+			Body: &oxide.SnapshotCreate{
+				Name:        oxide.Name(fmt.Sprintf("%s-disk-%d", config.Name, i)),
+				Description: "Created by Packer.",
+				Disk:        oxide.NameOrId(disk.Name),
+			},
+		})
+		if err != nil {
+			ui.Error("Failed creating Oxide snapshot of disk.")
+			stateBag.Put("error", err)
+			return multistep.ActionHalt
+		}
+
+		ui.Sayf("Created Oxide snapshot: %s", snapshot.Id)
+
+		diskSnapshotIDs[disk.Name] = snapshot.Id
+		stateBag.Put("disk_snapshot_ids", diskSnapshotIDs)
+	}
+
 	return multistep.ActionContinue
 }
 
@@ -62,6 +86,30 @@ func (s *stepSnapshotCreate) Run(
 func (s *stepSnapshotCreate) Cleanup(stateBag multistep.StateBag) {
 	oxideClient := stateBag.Get("client").(*oxide.Client)
 	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	if diskSnapshotIDsRaw, ok := stateBag.GetOk("disk_snapshot_ids"); ok {
+		snapshotDeleteCtx, snapshotDeleteCtxCancel := context.WithTimeout(
+			context.TODO(),
+			config.CleanupTimeout,
+		)
+		defer snapshotDeleteCtxCancel()
+
+		for _, snapshotID := range diskSnapshotIDsRaw.(map[string]string) {
+			ui.Sayf("Deleting Oxide snapshot: %s", snapshotID)
+
+			if err := oxideClient.SnapshotDelete(snapshotDeleteCtx, oxide.SnapshotDeleteParams{
+				Snapshot: oxide.NameOrId(snapshotID),
+			}); err != nil {
+				ui.Errorf(
+					"Failed deleting Oxide snapshot %s during cleanup. "+
+						"Please delete it manually: %v",
+					snapshotID,
+					err,
+				)
+			}
+		}
+	}
 
 	if snapshotIDRaw, ok := stateBag.GetOk("snapshot_id"); ok {
 		snapshotID := snapshotIDRaw.(string)
@@ -70,7 +118,7 @@ func (s *stepSnapshotCreate) Cleanup(stateBag multistep.StateBag) {
 
 		snapshotDeleteCtx, snapshotDeletCtxCancel := context.WithTimeout(
 			context.TODO(),
-			30*time.Second,
+			config.CleanupTimeout,
 		)
 		defer snapshotDeletCtxCancel()
 
@@ -6,7 +6,6 @@ package instance
 
 import (
 	"context"
-	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -59,13 +58,14 @@ func (s *stepSSHKeyCreate) Run(
 func (s *stepSSHKeyCreate) Cleanup(stateBag multistep.StateBag) {
 	oxideClient := stateBag.Get("client").(*oxide.Client)
 	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
 
 	if sshPublicKeyIDRaw, ok := stateBag.GetOk("ssh_public_key_id"); ok {
 		sshPublicKeyID := sshPublicKeyIDRaw.(string)
 
 		ui.Sayf("Deleting Oxide SSH public key: %s", sshPublicKeyID)
 
-		ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(context.TODO(), config.CleanupTimeout)
 		defer cancel()
 
 		if err := oxideClient.CurrentUserSshKeyDelete(ctx, oxide.CurrentUserSshKeyDeleteParams{
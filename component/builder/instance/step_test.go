@@ -0,0 +1,1778 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxidetest"
+)
+
+const testProject = "test-project"
+
+// newTestStateBag returns a state bag populated the same way [Builder.Run]
+// populates it, using a client for server and a configuration that boots from
+// a freshly seeded source image.
+func newTestStateBag(t *testing.T, server *oxidetest.Server) *multistep.BasicStateBag {
+	t.Helper()
+
+	image := server.CreateImage("", oxide.Image{
+		Name:        "noble",
+		Description: "Ubuntu 24.04",
+		Os:          "ubuntu",
+		Version:     "24.04",
+		Size:        10 * 1024 * 1024 * 1024,
+	})
+
+	config := &Config{
+		Host:            server.URL,
+		Token:           oxidetest.Token,
+		Project:         testProject,
+		BootDiskImageID: image.Id,
+		BootDiskSize:    20 * 1024 * 1024 * 1024,
+		Name:            "packer-test",
+		Hostname:        "packer-test",
+		CPUs:            1,
+		Memory:          2 * 1024 * 1024 * 1024,
+		VPC:             "default",
+		Subnet:          "default",
+		SSHInterface:    sshInterfaceExternal,
+		IPVersion:       ipVersionV4,
+
+		AssociateExternalIP: oxide.NewPointer(true),
+
+		InstanceStartTimeout: time.Minute,
+		InstanceStopTimeout:  time.Minute,
+		CleanupTimeout:       time.Minute,
+		PollInterval:         time.Millisecond,
+
+		WaitForSerialPatternTimeout: time.Minute,
+
+		SerialLoginTimeout:   time.Minute,
+		SerialLoginPrompt:    `(?i)login:\s*$`,
+		SerialPasswordPrompt: `(?i)password:\s*$`,
+		SerialShellPrompt:    `[$#%]\s*$`,
+	}
+	config.PackerBuildName = "test"
+
+	stateBag := &multistep.BasicStateBag{}
+	stateBag.Put("ui", packer.TestUi(t))
+	stateBag.Put("client", server.Client(t))
+	stateBag.Put("config", config)
+
+	return stateBag
+}
+
+// runStep runs step and fails the test when the returned action differs from
+// want.
+func runStep(
+	t *testing.T,
+	step multistep.Step,
+	stateBag multistep.StateBag,
+	want multistep.StepAction,
+) {
+	t.Helper()
+
+	if got := step.Run(t.Context(), stateBag); got != want {
+		err, _ := stateBag.GetOk("error")
+		t.Fatalf("expected step action %v, got %v (error: %v)", want, got, err)
+	}
+}
+
+// assertStateError fails the test when the state bag does not contain an error.
+func assertStateError(t *testing.T, stateBag multistep.StateBag) {
+	t.Helper()
+
+	if _, ok := stateBag.GetOk("error"); !ok {
+		t.Fatal("expected error in state bag")
+	}
+}
+
+// assertNoInstanceResources fails the test when the fake still holds any of the
+// resources the builder creates around the temporary instance.
+func assertNoInstanceResources(t *testing.T, server *oxidetest.Server) {
+	t.Helper()
+
+	if n := len(server.Instances()); n != 0 {
+		t.Errorf("expected no instances, got %d", n)
+	}
+	if n := len(server.Disks()); n != 0 {
+		t.Errorf("expected no disks, got %d", n)
+	}
+	if n := len(server.Snapshots()); n != 0 {
+		t.Errorf("expected no snapshots, got %d", n)
+	}
+	if n := len(server.SSHKeys()); n != 0 {
+		t.Errorf("expected no SSH keys, got %d", n)
+	}
+}
+
+func TestStepImageView(t *testing.T) {
+	t.Run("PopulatesArtifactDefaults", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+
+		runStep(t, &stepImageView{}, stateBag, multistep.ActionContinue)
+
+		if got := stateBag.Get("source_image_id"); got != config.BootDiskImageID {
+			t.Errorf("expected source_image_id %q, got %q", config.BootDiskImageID, got)
+		}
+		if config.ArtifactOS != "ubuntu" || config.ArtifactVersion != "24.04" {
+			t.Errorf(
+				"unexpected artifact OS and version: %q %q",
+				config.ArtifactOS,
+				config.ArtifactVersion,
+			)
+		}
+		if config.ArtifactDescription != "Ubuntu 24.04" {
+			t.Errorf("unexpected artifact description: %q", config.ArtifactDescription)
+		}
+		if config.ArtifactName == "" {
+			t.Error("expected artifact name to be set")
+		}
+	})
+
+	t.Run("KeepsConfiguredArtifact", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.ArtifactName = "custom"
+		config.ArtifactOS = "custom-os"
+
+		runStep(t, &stepImageView{}, stateBag, multistep.ActionContinue)
+
+		if config.ArtifactName != "custom" || config.ArtifactOS != "custom-os" {
+			t.Errorf(
+				"configured artifact values were overwritten: %q %q",
+				config.ArtifactName,
+				config.ArtifactOS,
+			)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).BootDiskImageID = "missing"
+
+		runStep(t, &stepImageView{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+func TestStepArtifactValidate(t *testing.T) {
+	t.Run("NoConflict", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).ArtifactName = "artifact"
+
+		runStep(t, &stepArtifactValidate{}, stateBag, multistep.ActionContinue)
+
+		if _, ok := stateBag.GetOk("existing_image_id"); ok {
+			t.Error("expected no existing image")
+		}
+	})
+
+	t.Run("ConflictWithoutForce", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.CreateImage(testProject, oxide.Image{Name: "artifact"})
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).ArtifactName = "artifact"
+
+		runStep(t, &stepArtifactValidate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+
+	t.Run("ConflictWithForce", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage(testProject, oxide.Image{Name: "artifact"})
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.ArtifactName = "artifact"
+		config.PackerForce = true
+
+		runStep(t, &stepArtifactValidate{}, stateBag, multistep.ActionContinue)
+
+		if got := stateBag.Get("existing_image_id"); got != existing.Id {
+			t.Errorf("expected existing_image_id %q, got %v", existing.Id, got)
+		}
+	})
+
+	t.Run("SiloConflictWithForce", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage("", oxide.Image{Name: "artifact"})
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.ArtifactName = "artifact"
+		config.PromoteToSilo = true
+		config.PackerForce = true
+
+		runStep(t, &stepArtifactValidate{}, stateBag, multistep.ActionContinue)
+
+		if got := stateBag.Get("existing_silo_image_id"); got != existing.Id {
+			t.Errorf("expected existing_silo_image_id %q, got %v", existing.Id, got)
+		}
+		if _, ok := stateBag.GetOk("existing_image_id"); ok {
+			t.Error("expected no existing project image")
+		}
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("ImageView", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).ArtifactName = "artifact"
+
+		runStep(t, &stepArtifactValidate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+func TestStepImagePromote(t *testing.T) {
+	t.Run("PromotesImage", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		image := server.CreateImage(testProject, oxide.Image{Name: "artifact"})
+		stateBag := newTestStateBag(t, server)
+		stateBag.Put("image_id", image.Id)
+
+		runStep(t, &stepImagePromote{}, stateBag, multistep.ActionContinue)
+
+		if got := stateBag.Get("image_id"); got != image.Id {
+			t.Errorf("expected image_id %q, got %v", image.Id, got)
+		}
+		if _, ok := stateBag.GetOk("image_silo"); !ok {
+			t.Error("expected image_silo to be set")
+		}
+		for _, v := range server.Images() {
+			if v.Id == image.Id && v.ProjectId != "" {
+				t.Errorf("expected silo image, got project %q", v.ProjectId)
+			}
+		}
+	})
+
+	// setupForce returns a state bag to promote a new image in place of an
+	// existing silo image with the same name.
+	setupForce := func(
+		t *testing.T,
+		server *oxidetest.Server,
+	) (*multistep.BasicStateBag, oxide.Image, oxide.Image) {
+		t.Helper()
+
+		existing := server.CreateImage("", oxide.Image{Name: "artifact"})
+		snapshot := server.CreateSnapshot(testProject, oxide.Snapshot{Name: "snapshot"})
+		image := server.CreateImage(testProject, oxide.Image{Name: "artifact"})
+
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.ArtifactName = "artifact"
+		config.PackerForce = true
+		stateBag.Put("snapshot_id", snapshot.Id)
+		stateBag.Put("image_id", image.Id)
+		stateBag.Put("existing_silo_image_id", existing.Id)
+		stateBag.Put("existing_silo_image_name", string(existing.Name))
+
+		return stateBag, existing, image
+	}
+
+	// imageIDs returns the sorted IDs of the images server holds within project,
+	// other than the source image.
+	imageIDs := func(server *oxidetest.Server, project string) []string {
+		var ids []string
+		for _, image := range server.Images() {
+			if image.ProjectId == project && image.Name != "noble" {
+				ids = append(ids, image.Id)
+			}
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	t.Run("ForceReplacesExistingSiloImage", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag, _, image := setupForce(t, server)
+
+		runStep(t, &stepImagePromote{}, stateBag, multistep.ActionContinue)
+
+		if got := imageIDs(server, ""); !slices.Equal(got, []string{image.Id}) {
+			t.Errorf("expected only silo image %s, got %v", image.Id, got)
+		}
+		if got := imageIDs(server, testProject); len(got) != 0 {
+			t.Errorf("expected no project images, got %v", got)
+		}
+	})
+
+	t.Run("ForceKeepsExistingSiloImageOnFailure", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag, existing, image := setupForce(t, server)
+		server.Fail("ImagePromote", 1, oxidetest.Fault{})
+
+		runStep(t, &stepImagePromote{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		if got := imageIDs(server, ""); !slices.Equal(got, []string{existing.Id}) {
+			t.Errorf("expected only existing silo image %s, got %v", existing.Id, got)
+		}
+		if got := imageIDs(server, testProject); !slices.Equal(got, []string{image.Id}) {
+			t.Errorf("expected only project image %s, got %v", image.Id, got)
+		}
+	})
+
+	t.Run("ForceKeepsTemporarySiloImageOnFailure", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag, existing, image := setupForce(t, server)
+		server.Fail("ImagePromote", 1, oxidetest.Fault{After: 1})
+
+		runStep(t, &stepImagePromote{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		ids := imageIDs(server, "")
+		if len(ids) != 1 || ids[0] == existing.Id || ids[0] == image.Id {
+			t.Errorf("expected only the temporary silo image, got %v", ids)
+		}
+		if got := imageIDs(server, testProject); !slices.Equal(got, []string{image.Id}) {
+			t.Errorf("expected only project image %s, got %v", image.Id, got)
+		}
+	})
+
+	t.Run("ConflictWithoutForce", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.CreateImage("", oxide.Image{Name: "artifact"})
+		image := server.CreateImage(testProject, oxide.Image{Name: "artifact"})
+		stateBag := newTestStateBag(t, server)
+		stateBag.Put("image_id", image.Id)
+
+		runStep(t, &stepImagePromote{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+func TestStepSSHKeyCreate(t *testing.T) {
+	t.Run("CreatesAndDeletesKey", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.Comm.SSHPublicKey = []byte("ssh-ed25519 AAAA packer")
+		config.Comm.SSHTemporaryKeyPairName = "packer-test"
+
+		step := &stepSSHKeyCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		if n := len(server.SSHKeys()); n != 1 {
+			t.Fatalf("expected 1 SSH key, got %d", n)
+		}
+
+		step.Cleanup(stateBag)
+
+		assertNoInstanceResources(t, server)
+	})
+
+	t.Run("SkipsWithoutPublicKey", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepSSHKeyCreate{}, stateBag, multistep.ActionContinue)
+
+		if n := server.Calls("CurrentUserSshKeyCreate"); n != 0 {
+			t.Errorf("expected no SSH key create calls, got %d", n)
+		}
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("CurrentUserSshKeyCreate", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.Comm.SSHPublicKey = []byte("ssh-ed25519 AAAA packer")
+		config.Comm.SSHTemporaryKeyPairName = "packer-test"
+
+		step := &stepSSHKeyCreate{}
+		runStep(t, step, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		step.Cleanup(stateBag)
+
+		if n := server.Calls("CurrentUserSshKeyDelete"); n != 0 {
+			t.Errorf("expected no SSH key delete calls, got %d", n)
+		}
+	})
+}
+
+func TestStepInstanceCreate(t *testing.T) {
+	t.Run("CreatesAndDeletesInstance", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		instances := server.Instances()
+		if len(instances) != 1 {
+			t.Fatalf("expected 1 instance, got %d", len(instances))
+		}
+		if instances[0].RunState != oxide.InstanceStateRunning {
+			t.Errorf("expected instance to be running, got %s", instances[0].RunState)
+		}
+		if got := stateBag.Get("boot_disk_id"); got != instances[0].BootDiskId {
+			t.Errorf("expected boot_disk_id %q, got %v", instances[0].BootDiskId, got)
+		}
+
+		step.Cleanup(stateBag)
+
+		assertNoInstanceResources(t, server)
+		if n := server.Calls("InstanceStop"); n != 1 {
+			t.Errorf("expected running instance to be stopped once, got %d", n)
+		}
+	})
+
+	t.Run("AttachesAndDeletesDataDisks", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateDisk(testProject, oxide.Disk{Name: "seed", Size: 1024})
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.Disks = []DiskConfig{
+			{Name: "scratch", Size: 1024, DeleteOnCleanup: oxide.NewPointer(true)},
+			{Name: "kept", Size: 1024, DeleteOnCleanup: oxide.NewPointer(false)},
+			{Name: "seed", Existing: true, DeleteOnCleanup: oxide.NewPointer(false)},
+		}
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		instanceID := stateBag.Get("instance_id").(string)
+		var attached []string
+		for _, disk := range server.Disks() {
+			if v, ok := disk.State.Value.(*oxide.DiskStateAttached); ok &&
+				v.Instance == instanceID {
+				attached = append(attached, string(disk.Name))
+			}
+		}
+		slices.Sort(attached)
+		if want := []string{"kept", "packer-test", "scratch", "seed"}; !slices.Equal(
+			attached,
+			want,
+		) {
+			t.Errorf("expected attached disks %v, got %v", want, attached)
+		}
+
+		step.Cleanup(stateBag)
+
+		var remaining []string
+		for _, disk := range server.Disks() {
+			remaining = append(remaining, string(disk.Name))
+		}
+		slices.Sort(remaining)
+		if want := []string{"kept", string(existing.Name)}; !slices.Equal(remaining, want) {
+			t.Errorf("expected remaining disks %v, got %v", want, remaining)
+		}
+	})
+
+	t.Run("WaitsForSlowStart", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.StartStates = []oxide.InstanceState{
+			oxide.InstanceStateCreating,
+			oxide.InstanceStateStarting,
+			oxide.InstanceStateStarting,
+			oxide.InstanceStateStarting,
+			oxide.InstanceStateRunning,
+		}
+		stateBag := newTestStateBag(t, server)
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+		t.Cleanup(func() { step.Cleanup(stateBag) })
+
+		if n := server.Calls("InstanceView"); n != 4 {
+			t.Errorf("expected 4 instance views, got %d", n)
+		}
+	})
+
+	t.Run("StartTimeout", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.StartStates = []oxide.InstanceState{oxide.InstanceStateStarting}
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).InstanceStartTimeout = 20 * time.Millisecond
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionHalt)
+		err, _ := stateBag.Get("error").(error)
+		if !errors.Is(err, errWaitTimeout) {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "last observed state: starting") {
+			t.Errorf("expected error to include last observed state, got %v", err)
+		}
+
+		step.Cleanup(stateBag)
+
+		assertNoInstanceResources(t, server)
+	})
+
+	t.Run("FailsFastOnFailedState", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.StartStates = []oxide.InstanceState{
+			oxide.InstanceStateStarting,
+			oxide.InstanceStateFailed,
+		}
+		server.SerialConsoleOutput = "Booting\r\nKernel panic - not syncing\r\n"
+		stateBag := newTestStateBag(t, server)
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionHalt)
+
+		err, _ := stateBag.Get("error").(error)
+		if !errors.Is(err, errInstanceState) {
+			t.Fatalf("expected unexpected instance state error, got %v", err)
+		}
+		for _, want := range []string{
+			"last observed state: failed",
+			"Booting\nKernel panic - not syncing",
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected error to contain %q, got %v", want, err)
+			}
+		}
+		if n := server.Calls("InstanceView"); n != 1 {
+			t.Errorf("expected 1 instance view, got %d", n)
+		}
+
+		step.Cleanup(stateBag)
+
+		// Failed instances are deleted without being stopped first.
+		assertNoInstanceResources(t, server)
+		if n := server.Calls("InstanceStop"); n != 0 {
+			t.Errorf("expected no instance stop calls, got %d", n)
+		}
+	})
+
+	t.Run("FailsFastOnUnexpectedState", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.StartStates = []oxide.InstanceState{
+			oxide.InstanceStateStarting,
+			oxide.InstanceStateStopped,
+		}
+		stateBag := newTestStateBag(t, server)
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionHalt)
+
+		var stateErr *instanceStateError
+		if err, _ := stateBag.Get("error").(error); !errors.As(err, &stateErr) {
+			t.Fatalf("expected instance state error, got %v", err)
+		}
+		if stateErr.State != oxide.InstanceStateStopped {
+			t.Errorf("expected last observed state stopped, got %s", stateErr.State)
+		}
+		if stateErr.SerialConsole != "" {
+			t.Errorf("expected no serial console output, got %q", stateErr.SerialConsole)
+		}
+
+		step.Cleanup(stateBag)
+
+		assertNoInstanceResources(t, server)
+	})
+
+	t.Run("WritesSerialConsoleLog", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.SerialConsoleOutput = "Booting\r\n"
+		stateBag := newTestStateBag(t, server)
+
+		var out bytes.Buffer
+		stateBag.Put("ui", &packer.BasicUi{
+			Reader:      new(bytes.Buffer),
+			Writer:      &out,
+			ErrorWriter: io.Discard,
+		})
+
+		logPath := filepath.Join(t.TempDir(), "serial.log")
+		stateBag.Get("config").(*Config).SerialConsoleLog = logPath
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		server.WriteSerialConsole(stateBag.Get("instance_id").(string), "login: \r\n")
+		stateBag.Put(multistep.StateHalted, true)
+
+		step.Cleanup(stateBag)
+
+		got, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatalf("failed reading serial console log: %v", err)
+		}
+		if want := "Booting\r\nlogin: \r\n"; string(got) != want {
+			t.Errorf("expected serial console log %q, got %q", want, got)
+		}
+		if !strings.Contains(out.String(), "serial console output:\nBooting\nlogin: \n") {
+			t.Errorf("expected serial console tail in output, got %q", out.String())
+		}
+		assertNoInstanceResources(t, server)
+	})
+
+	t.Run("SerialConsoleLogError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).SerialConsoleLog = filepath.Join(
+			t.TempDir(),
+			"missing",
+			"serial.log",
+		)
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		step.Cleanup(stateBag)
+
+		if n := server.Calls("InstanceCreate"); n != 0 {
+			t.Errorf("expected no instance create calls, got %d", n)
+		}
+	})
+
+	t.Run("CleanupSkipsStopWhenStopped", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		server.SetInstanceState(stateBag.Get("instance_id").(string), oxide.InstanceStateStopped)
+
+		step.Cleanup(stateBag)
+
+		assertNoInstanceResources(t, server)
+		if n := server.Calls("InstanceStop"); n != 0 {
+			t.Errorf("expected no instance stop calls, got %d", n)
+		}
+	})
+
+	t.Run("CreateError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("InstanceCreate", 1, oxidetest.Fault{
+			StatusCode: http.StatusInsufficientStorage,
+			ErrorCode:  "InsufficientCapacity",
+		})
+		stateBag := newTestStateBag(t, server)
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		step.Cleanup(stateBag)
+
+		assertNoInstanceResources(t, server)
+	})
+
+	t.Run("ViewError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("InstanceView", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		step.Cleanup(stateBag)
+
+		assertNoInstanceResources(t, server)
+	})
+
+	t.Run("CleanupStopError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		step := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		server.Fail("InstanceStop", 1, oxidetest.Fault{})
+
+		step.Cleanup(stateBag)
+
+		// The instance and its disk are left behind for the user to delete.
+		if n := len(server.Instances()); n != 1 {
+			t.Errorf("expected 1 instance, got %d", n)
+		}
+		if n := server.Calls("InstanceDelete"); n != 0 {
+			t.Errorf("expected no instance delete calls, got %d", n)
+		}
+	})
+}
+
+func TestStepInstanceExternalIPList(t *testing.T) {
+	t.Run("StoresExternalIP", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceExternalIPList{}, stateBag, multistep.ActionContinue)
+
+		if ip, ok := stateBag.GetOk("external_ip"); !ok || ip == "" {
+			t.Errorf("expected external_ip to be set, got %v", ip)
+		}
+	})
+
+	t.Run("StoresIPv6ExternalIP", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).IPVersion = ipVersionV6
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceExternalIPList{}, stateBag, multistep.ActionContinue)
+
+		ip, _ := stateBag.Get("external_ip").(string)
+		if addr, err := netip.ParseAddr(ip); err != nil || !addr.Is6() {
+			t.Errorf("expected external_ip to be an unbracketed IPv6 address, got %q", ip)
+		}
+	})
+
+	t.Run("NoExternalIP", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).AssociateExternalIP = oxide.NewPointer(false)
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceExternalIPList{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+
+	t.Run("MissingInstanceID", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceExternalIPList{}, stateBag, multistep.ActionHalt)
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("InstanceExternalIpList", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceExternalIPList{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+func TestStepFloatingIPCreate(t *testing.T) {
+	t.Run("CreatesAndDeletesFloatingIP", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.AssociateExternalIP = oxide.NewPointer(false)
+
+		step := &stepFloatingIPCreate{}
+		instanceStep := &stepInstanceCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+		runStep(t, instanceStep, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceExternalIPList{}, stateBag, multistep.ActionContinue)
+
+		floatingIPs := server.FloatingIPs()
+		if len(floatingIPs) != 1 {
+			t.Fatalf("expected 1 floating IP, got %d", len(floatingIPs))
+		}
+		if got := stateBag.Get("external_ip"); got != floatingIPs[0].Ip {
+			t.Errorf("expected external_ip %q, got %v", floatingIPs[0].Ip, got)
+		}
+
+		instanceStep.Cleanup(stateBag)
+		step.Cleanup(stateBag)
+
+		if n := len(server.FloatingIPs()); n != 0 {
+			t.Errorf("expected no floating IPs, got %d", n)
+		}
+	})
+
+	t.Run("CleanupDetachesFloatingIP", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		step := &stepFloatingIPCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+
+		step.Cleanup(stateBag)
+
+		if n := len(server.FloatingIPs()); n != 0 {
+			t.Errorf("expected no floating IPs, got %d", n)
+		}
+		if n := server.Calls("FloatingIpDetach"); n != 1 {
+			t.Errorf("expected floating IP to be detached once, got %d", n)
+		}
+	})
+
+	t.Run("PrefersExistingFloatingIP", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		floatingIP := server.CreateFloatingIP(testProject, oxide.FloatingIp{Name: "fixed"})
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).FloatingIP = "fixed"
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceExternalIPList{}, stateBag, multistep.ActionContinue)
+
+		if got := stateBag.Get("external_ip"); got != floatingIP.Ip {
+			t.Errorf("expected external_ip %q, got %v", floatingIP.Ip, got)
+		}
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("FloatingIpCreate", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepFloatingIPCreate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+// firewallOverwriter is an [http.RoundTripper] that simulates another client
+// overwriting the rules of the `default` VPC firewall with rules right after
+// each of the next n firewall rule updates.
+type firewallOverwriter struct {
+	server *oxidetest.Server
+	rules  []oxide.VpcFirewallRuleUpdate
+	n      int
+}
+
+func (o *firewallOverwriter) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err == nil && r.Method == http.MethodPut && r.URL.Path == "/v1/vpc-firewall-rules" &&
+		o.n > 0 {
+		o.n--
+		o.server.SetFirewallRules(testProject, "default", o.rules)
+	}
+
+	return resp, err
+}
+
+func TestStepFirewallRuleCreate(t *testing.T) {
+	existing := oxide.VpcFirewallRuleUpdate{
+		Action:    oxide.VpcFirewallRuleActionAllow,
+		Direction: oxide.VpcFirewallRuleDirectionInbound,
+		Name:      "allow-icmp",
+		Status:    oxide.VpcFirewallRuleStatusEnabled,
+		Filters: oxide.VpcFirewallRuleFilter{
+			Protocols: []oxide.VpcFirewallRuleProtocol{
+				{Value: &oxide.VpcFirewallRuleProtocolIcmp{}},
+			},
+		},
+		Targets: []oxide.VpcFirewallRuleTarget{
+			{Value: &oxide.VpcFirewallRuleTargetVpc{Value: "default"}},
+		},
+	}
+
+	newStateBag := func(t *testing.T, server *oxidetest.Server) *multistep.BasicStateBag {
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.Comm.Type = "ssh"
+		config.Comm.SSHPort = 2222
+		return stateBag
+	}
+
+	t.Run("CreatesAndDeletesRule", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.SetFirewallRules(testProject, "default", []oxide.VpcFirewallRuleUpdate{existing})
+		stateBag := newStateBag(t, server)
+		stateBag.Get("config").(*Config).TemporaryFirewallRuleSourceCIDRs = []string{
+			"203.0.113.0/24",
+			"2001:db8::/64",
+		}
+
+		step := &stepFirewallRuleCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		rules := server.FirewallRules(testProject, "default")
+		if len(rules) != 2 {
+			t.Fatalf("expected 2 firewall rules, got %d", len(rules))
+		}
+		if rules[0].Name != existing.Name {
+			t.Errorf("expected existing rule %q to be kept, got %q", existing.Name, rules[0].Name)
+		}
+
+		rule := rules[1]
+		if rule.Name != "packer-test" {
+			t.Errorf("expected rule name %q, got %q", "packer-test", rule.Name)
+		}
+		if rule.Direction != oxide.VpcFirewallRuleDirectionInbound ||
+			rule.Action != oxide.VpcFirewallRuleActionAllow {
+			t.Errorf("expected inbound allow rule, got %s %s", rule.Direction, rule.Action)
+		}
+		if !slices.Equal(rule.Filters.Ports, []oxide.L4PortRange{"2222"}) {
+			t.Errorf("expected ports [2222], got %v", rule.Filters.Ports)
+		}
+		if len(rule.Filters.Hosts) != 2 {
+			t.Errorf("expected 2 host filters, got %d", len(rule.Filters.Hosts))
+		}
+		if len(rule.Targets) != 1 {
+			t.Fatalf("expected 1 target, got %d", len(rule.Targets))
+		}
+		target, ok := rule.Targets[0].Value.(*oxide.VpcFirewallRuleTargetInstance)
+		if !ok || target.Value != "packer-test" {
+			t.Errorf("expected instance target packer-test, got %#v", rule.Targets[0].Value)
+		}
+
+		step.Cleanup(stateBag)
+
+		rules = server.FirewallRules(testProject, "default")
+		if len(rules) != 1 || rules[0].Name != existing.Name {
+			t.Errorf("expected only rule %q to remain, got %v", existing.Name, rules)
+		}
+	})
+
+	t.Run("DetectsSourceAddress", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newStateBag(t, server)
+
+		runStep(t, &stepFirewallRuleCreate{}, stateBag, multistep.ActionContinue)
+
+		rules := server.FirewallRules(testProject, "default")
+		if len(rules) != 1 || len(rules[0].Filters.Hosts) != 1 {
+			t.Fatalf("expected 1 rule with 1 host filter, got %v", rules)
+		}
+		host, ok := rules[0].Filters.Hosts[0].Value.(*oxide.VpcFirewallRuleHostFilterIpNet)
+		if !ok {
+			t.Fatalf("expected IP network host filter, got %#v", rules[0].Filters.Hosts[0].Value)
+		}
+		if got, ok := host.Value.Value.(*oxide.Ipv4Net); !ok || *got != "127.0.0.1/32" {
+			t.Errorf("expected source 127.0.0.1/32, got %#v", host.Value.Value)
+		}
+	})
+
+	t.Run("RejectsExistingRule", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		conflicting := existing
+		conflicting.Name = "packer-test"
+		server.SetFirewallRules(testProject, "default", []oxide.VpcFirewallRuleUpdate{conflicting})
+		stateBag := newStateBag(t, server)
+
+		runStep(t, &stepFirewallRuleCreate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		if _, ok := stateBag.GetOk("firewall_rule_name"); ok {
+			t.Error("expected firewall_rule_name to be unset")
+		}
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("VpcFirewallRulesUpdate", 1, oxidetest.Fault{})
+		stateBag := newStateBag(t, server)
+
+		runStep(t, &stepFirewallRuleCreate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+
+	// Each case overwrites the firewall after the given number of updates, as
+	// a concurrent update that didn't see the temporary rule would, and checks
+	// that the step retries until the rules are applied.
+	for name, tc := range map[string]struct {
+		overwrites int
+		updates    int
+		want       multistep.StepAction
+	}{
+		"RetriesOverwrittenRule": {
+			overwrites: 1,
+			updates:    2,
+			want:       multistep.ActionContinue,
+		},
+		"HaltsOnRepeatedlyOverwrittenRule": {
+			overwrites: firewallRuleAttempts,
+			updates:    firewallRuleAttempts,
+			want:       multistep.ActionHalt,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := oxidetest.NewServer(t)
+			server.SetFirewallRules(testProject, "default", []oxide.VpcFirewallRuleUpdate{existing})
+			stateBag := newStateBag(t, server)
+			stateBag.Get("config").(*Config).TemporaryFirewallRuleSourceCIDRs = []string{
+				"203.0.113.0/24",
+			}
+
+			oxideClient, err := oxide.NewClient(
+				oxide.WithHost(server.URL),
+				oxide.WithToken(oxidetest.Token),
+				oxide.WithHTTPClient(&http.Client{Transport: &firewallOverwriter{
+					server: server,
+					rules:  []oxide.VpcFirewallRuleUpdate{existing},
+					n:      tc.overwrites,
+				}}),
+			)
+			if err != nil {
+				t.Fatalf("failed creating oxide client: %v", err)
+			}
+			stateBag.Put("client", oxideClient)
+
+			runStep(t, &stepFirewallRuleCreate{}, stateBag, tc.want)
+
+			if n := server.Calls("VpcFirewallRulesUpdate"); n != tc.updates {
+				t.Errorf("expected %d firewall rule updates, got %d", tc.updates, n)
+			}
+
+			var names []oxide.Name
+			for _, rule := range server.FirewallRules(testProject, "default") {
+				names = append(names, rule.Name)
+			}
+			want := []oxide.Name{existing.Name, "packer-test"}
+			if tc.want == multistep.ActionHalt {
+				want = want[:1]
+				assertStateError(t, stateBag)
+			}
+			if !slices.Equal(names, want) {
+				t.Errorf("expected firewall rules %v, got %v", want, names)
+			}
+		})
+	}
+
+	t.Run("CleanupRetriesRestoredRule", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.SetFirewallRules(testProject, "default", []oxide.VpcFirewallRuleUpdate{existing})
+		stateBag := newStateBag(t, server)
+		stateBag.Get("config").(*Config).TemporaryFirewallRuleSourceCIDRs = []string{
+			"203.0.113.0/24",
+		}
+
+		step := &stepFirewallRuleCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		// A concurrent update that still saw the temporary rule restores it.
+		restored := firewallRuleUpdates(server.FirewallRules(testProject, "default"))
+		oxideClient, err := oxide.NewClient(
+			oxide.WithHost(server.URL),
+			oxide.WithToken(oxidetest.Token),
+			oxide.WithHTTPClient(&http.Client{Transport: &firewallOverwriter{
+				server: server,
+				rules:  restored,
+				n:      1,
+			}}),
+		)
+		if err != nil {
+			t.Fatalf("failed creating oxide client: %v", err)
+		}
+		stateBag.Put("client", oxideClient)
+
+		step.Cleanup(stateBag)
+
+		rules := server.FirewallRules(testProject, "default")
+		if len(rules) != 1 || rules[0].Name != existing.Name {
+			t.Errorf("expected only rule %q to remain, got %v", existing.Name, rules)
+		}
+	})
+}
+
+func TestStepNetworkCreate(t *testing.T) {
+	t.Run("CreatesAndDeletesNetwork", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.VPC = "packer-test"
+		config.Subnet = "packer-test"
+		config.TemporaryNetworkIPv4Block = "10.0.0.0/24"
+		config.TemporaryFirewallRuleSourceCIDRs = []string{"203.0.113.0/24"}
+		config.Comm.Type = "ssh"
+		config.Comm.SSHPort = 22
+
+		step := &stepNetworkCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		subnets := server.Subnets()
+		if len(subnets) != 1 {
+			t.Fatalf("expected 1 VPC subnet, got %d", len(subnets))
+		}
+		if subnets[0].Name != "packer-test" || subnets[0].Ipv4Block != "10.0.0.0/24" {
+			t.Errorf("expected subnet packer-test (10.0.0.0/24), got %s (%s)",
+				subnets[0].Name, subnets[0].Ipv4Block)
+		}
+		if got := stateBag.Get("subnet_id"); got != subnets[0].Id {
+			t.Errorf("expected subnet_id %q, got %v", subnets[0].Id, got)
+		}
+
+		rules := server.FirewallRules(testProject, "packer-test")
+		if len(rules) != 1 {
+			t.Fatalf("expected 1 firewall rule, got %d", len(rules))
+		}
+		if rules[0].Name != "allow-ssh" || len(rules[0].Filters.Hosts) != 1 {
+			t.Errorf("expected allow-ssh rule with 1 host filter, got %#v", rules[0])
+		}
+		if !slices.Equal(rules[0].Filters.Ports, []oxide.L4PortRange{"22"}) {
+			t.Errorf("expected ports [22], got %v", rules[0].Filters.Ports)
+		}
+
+		step.Cleanup(stateBag)
+
+		if n := len(server.Subnets()); n != 0 {
+			t.Errorf("expected no VPC subnets, got %d", n)
+		}
+		if n := len(server.VPCs()); n != 0 {
+			t.Errorf("expected no VPCs, got %d", n)
+		}
+	})
+
+	t.Run("DetectsSourceAddress", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.VPC = "packer-test"
+		config.Subnet = "packer-test"
+		config.TemporaryNetworkIPv4Block = "10.0.0.0/24"
+		config.Comm.Type = "ssh"
+		config.Comm.SSHPort = 22
+
+		runStep(t, &stepNetworkCreate{}, stateBag, multistep.ActionContinue)
+
+		rules := server.FirewallRules(testProject, "packer-test")
+		if len(rules) != 1 || len(rules[0].Filters.Hosts) != 1 {
+			t.Fatalf("expected 1 rule with 1 host filter, got %v", rules)
+		}
+		host, ok := rules[0].Filters.Hosts[0].Value.(*oxide.VpcFirewallRuleHostFilterIpNet)
+		if !ok {
+			t.Fatalf("expected IP network host filter, got %#v", rules[0].Filters.Hosts[0].Value)
+		}
+		if got, ok := host.Value.Value.(*oxide.Ipv4Net); !ok || *got != "127.0.0.1/32" {
+			t.Errorf("expected source 127.0.0.1/32, got %#v", host.Value.Value)
+		}
+	})
+
+	t.Run("CleanupAfterSubnetError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("VpcSubnetDelete", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+
+		step := &stepNetworkCreate{}
+		runStep(t, step, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		step.Cleanup(stateBag)
+
+		if n := len(server.Subnets()); n != 0 {
+			t.Errorf("expected no VPC subnets, got %d", n)
+		}
+		if n := len(server.VPCs()); n != 0 {
+			t.Errorf("expected no VPCs, got %d", n)
+		}
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("VpcCreate", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepNetworkCreate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		if _, ok := stateBag.GetOk("vpc_id"); ok {
+			t.Error("expected vpc_id to be unset")
+		}
+	})
+}
+
+func TestStepInstanceNetworkInterfaceList(t *testing.T) {
+	for _, tc := range []struct {
+		ipVersion string
+		is6       bool
+	}{
+		{ipVersion: ipVersionV4, is6: false},
+		{ipVersion: ipVersionV6, is6: true},
+		{ipVersion: ipVersionDual, is6: false},
+	} {
+		t.Run("StoresPrivateIP_"+tc.ipVersion, func(t *testing.T) {
+			server := oxidetest.NewServer(t)
+			stateBag := newTestStateBag(t, server)
+			stateBag.Get("config").(*Config).IPVersion = tc.ipVersion
+
+			runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+			runStep(t, &stepInstanceNetworkInterfaceList{}, stateBag, multistep.ActionContinue)
+
+			ip, _ := stateBag.Get("private_ip").(string)
+			addr, err := netip.ParseAddr(ip)
+			if err != nil || addr.Is6() != tc.is6 {
+				t.Errorf("expected private_ip of version %s, got %q", tc.ipVersion, ip)
+			}
+		})
+	}
+
+	t.Run("MissingInstanceID", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceNetworkInterfaceList{}, stateBag, multistep.ActionHalt)
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("InstanceNetworkInterfaceList", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceNetworkInterfaceList{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+func TestStepInstanceStop(t *testing.T) {
+	t.Run("StopsInstance", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceStop{}, stateBag, multistep.ActionContinue)
+
+		if state := server.Instances()[0].RunState; state != oxide.InstanceStateStopped {
+			t.Errorf("expected instance to be stopped, got %s", state)
+		}
+	})
+
+	t.Run("FailsFastOnDestroyedState", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.StopStates = []oxide.InstanceState{
+			oxide.InstanceStateStopping,
+			oxide.InstanceStateDestroyed,
+		}
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceStop{}, stateBag, multistep.ActionHalt)
+
+		err, _ := stateBag.Get("error").(error)
+		if !errors.Is(err, errInstanceState) {
+			t.Fatalf("expected unexpected instance state error, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "last observed state: destroyed") {
+			t.Errorf("expected error to include last observed state, got %v", err)
+		}
+	})
+
+	t.Run("StopTimeout", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.StopStates = []oxide.InstanceState{oxide.InstanceStateStopping}
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).InstanceStopTimeout = 20 * time.Millisecond
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceStop{}, stateBag, multistep.ActionHalt)
+		if err, _ := stateBag.Get("error").(error); !errors.Is(err, errWaitTimeout) {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	})
+
+	t.Run("MissingInstanceID", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceStop{}, stateBag, multistep.ActionHalt)
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("InstanceStop", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceStop{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+func TestStepWaitForSerialPattern(t *testing.T) {
+	t.Run("MatchesLaterOutput", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.SerialConsoleOutput = "Booting\r\n"
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).WaitForSerialPattern = `Cloud-init v\. \S+ finished`
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+
+		instanceID := stateBag.Get("instance_id").(string)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			server.WriteSerialConsole(instanceID, "Cloud-init v. 24.1 fin")
+			time.Sleep(10 * time.Millisecond)
+			server.WriteSerialConsole(instanceID, "ished at Thu, 01 Jan 2026\r\n")
+		}()
+
+		runStep(t, &stepWaitForSerialPattern{}, stateBag, multistep.ActionContinue)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.SerialConsoleOutput = "Booting\r\nlogin: "
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.WaitForSerialPattern = "finished"
+		config.WaitForSerialPatternTimeout = 20 * time.Millisecond
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepWaitForSerialPattern{}, stateBag, multistep.ActionHalt)
+
+		err, _ := stateBag.Get("error").(error)
+		if !errors.Is(err, errWaitTimeout) {
+			t.Fatalf("expected timeout error, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "Serial console output:\nBooting\nlogin: ") {
+			t.Errorf("expected error to include serial console output, got %v", err)
+		}
+	})
+
+	t.Run("MissingInstanceID", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).WaitForSerialPattern = "finished"
+
+		runStep(t, &stepWaitForSerialPattern{}, stateBag, multistep.ActionHalt)
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("InstanceSerialConsole", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).WaitForSerialPattern = "finished"
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepWaitForSerialPattern{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+func TestStepTypeBootCommand(t *testing.T) {
+	t.Run("TypesBootCommand", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.BootWait = -1
+		config.BootGroupInterval = time.Millisecond
+		config.BootCommand = []string{
+			"<esc><wait10ms>",
+			"linux text<enter>",
+			"<leftCtrlOn>c<leftCtrlOff>",
+			"<leftAltOn>x<leftAltOff>",
+			"<leftShiftOn>a<leftShiftOff>",
+			"<f2><up><menu>",
+		}
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepTypeBootCommand{}, stateBag, multistep.ActionContinue)
+
+		want := "\x1blinux text\r\x03\x1bxA\x1bOQ\x1b[A"
+		instanceID := stateBag.Get("instance_id").(string)
+
+		// The fake records input asynchronously.
+		deadline := time.Now().Add(5 * time.Second)
+		for server.SerialConsoleInput(instanceID) != want && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if got := server.SerialConsoleInput(instanceID); got != want {
+			t.Errorf("expected serial console input %q, got %q", want, got)
+		}
+	})
+
+	t.Run("MissingInstanceID", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).BootCommand = []string{"<enter>"}
+
+		runStep(t, &stepTypeBootCommand{}, stateBag, multistep.ActionHalt)
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("InstanceSerialConsoleStream", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.BootWait = -1
+		config.BootCommand = []string{"<enter>"}
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepTypeBootCommand{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+func TestStepConnectSerial(t *testing.T) {
+	// connect logs in to a shell guest over the serial console and returns the
+	// resulting communicator.
+	connect := func(t *testing.T) packer.Communicator {
+		t.Helper()
+
+		server := oxidetest.NewServer(t)
+		server.SerialConsoleOutput = "Booting...\r\n"
+		server.SerialConsoleGuest = oxidetest.ShellGuest("packer", "hunter2")
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.SerialUsername = "packer"
+		config.SerialPassword = "hunter2"
+
+		step := &stepConnectSerial{}
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, step, stateBag, multistep.ActionContinue)
+		t.Cleanup(func() { step.Cleanup(stateBag) })
+
+		return stateBag.Get("communicator").(packer.Communicator)
+	}
+
+	t.Run("RunsCommands", func(t *testing.T) {
+		comm := connect(t)
+
+		for _, tc := range []struct {
+			command string
+			stdout  string
+			status  int
+		}{
+			{command: "echo hello", stdout: "hello", status: 0},
+			{command: "echo oops >&2; exit_code=3; (exit $exit_code)", stdout: "oops", status: 3},
+			{command: "printf 'a\\nb'", stdout: "a\nb", status: 0},
+		} {
+			var stdout bytes.Buffer
+			cmd := &packer.RemoteCmd{Command: tc.command, Stdout: &stdout}
+			if err := cmd.RunWithUi(t.Context(), comm, packer.TestUi(t)); err != nil {
+				t.Fatalf("failed running %q: %v", tc.command, err)
+			}
+
+			if got := cmd.ExitStatus(); got != tc.status {
+				t.Errorf("expected %q to exit with %d, got %d", tc.command, tc.status, got)
+			}
+			if got := strings.TrimSpace(stdout.String()); got != tc.stdout {
+				t.Errorf("expected %q to output %q, got %q", tc.command, tc.stdout, got)
+			}
+		}
+	})
+
+	t.Run("TransfersFiles", func(t *testing.T) {
+		comm := connect(t)
+
+		src := t.TempDir()
+		dst := t.TempDir()
+
+		data := bytes.Repeat([]byte("serial\x00\xff\n"), 1000)
+		if err := os.WriteFile(filepath.Join(src, "data.bin"), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(src, "dir", "skip"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		script := filepath.Join(src, "dir", "run.sh")
+		if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(filepath.Join(src, "data.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dst, "it's.bin")
+		if err := comm.Upload(file, bytes.NewReader(data), &fi); err != nil {
+			t.Fatalf("failed uploading file: %v", err)
+		}
+		if err := comm.UploadDir(dst, filepath.Join(src, "dir"), []string{"skip"}); err != nil {
+			t.Fatalf("failed uploading directory: %v", err)
+		}
+
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Error("uploaded file does not match source")
+		}
+
+		info, err := os.Stat(filepath.Join(dst, "dir", "run.sh"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o755 {
+			t.Errorf("expected uploaded file mode 0755, got %o", info.Mode().Perm())
+		}
+		if _, err := os.Stat(filepath.Join(dst, "dir", "skip")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected excluded directory not to be uploaded, got %v", err)
+		}
+
+		var downloaded bytes.Buffer
+		if err := comm.Download(filepath.Join(dst, "it's.bin"), &downloaded); err != nil {
+			t.Fatalf("failed downloading file: %v", err)
+		}
+		if !bytes.Equal(downloaded.Bytes(), data) {
+			t.Error("downloaded file does not match source")
+		}
+
+		if err := comm.Download(filepath.Join(dst, "missing"), io.Discard); err == nil {
+			t.Error("expected error downloading missing file")
+		}
+	})
+
+	t.Run("LoginTimeout", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.SerialConsoleGuest = oxidetest.ShellGuest("packer", "hunter2")
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.SerialUsername = "packer"
+		config.SerialPassword = "wrong"
+		config.SerialLoginTimeout = 100 * time.Millisecond
+
+		step := &stepConnectSerial{}
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, step, stateBag, multistep.ActionHalt)
+		step.Cleanup(stateBag)
+		assertStateError(t, stateBag)
+	})
+
+	t.Run("MissingInstanceID", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepConnectSerial{}, stateBag, multistep.ActionHalt)
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("InstanceSerialConsoleStream", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepConnectSerial{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+func TestStepSnapshotCreate(t *testing.T) {
+	t.Run("CreatesAndDeletesSnapshot", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+
+		step := &stepSnapshotCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		snapshots := server.Snapshots()
+		if len(snapshots) != 1 {
+			t.Fatalf("expected 1 snapshot, got %d", len(snapshots))
+		}
+		if got := stateBag.Get("boot_disk_id"); snapshots[0].DiskId != got {
+			t.Errorf("expected snapshot of boot disk %v, got %q", got, snapshots[0].DiskId)
+		}
+
+		step.Cleanup(stateBag)
+
+		if n := len(server.Snapshots()); n != 0 {
+			t.Errorf("expected no snapshots, got %d", n)
+		}
+	})
+
+	t.Run("CreatesDiskSnapshots", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		// A snapshot named after a data disk must not conflict with the build.
+		existing := server.CreateSnapshot(testProject, oxide.Snapshot{Name: "data"})
+		stateBag := newTestStateBag(t, server)
+		config := stateBag.Get("config").(*Config)
+		config.Disks = []DiskConfig{
+			{
+				Name:            "data",
+				Size:            1024,
+				DeleteOnCleanup: oxide.NewPointer(true),
+				Image:           &DiskImageConfig{Name: "data"},
+			},
+			{
+				Name:            "logs",
+				Size:            1024,
+				DeleteOnCleanup: oxide.NewPointer(true),
+				Image:           &DiskImageConfig{Name: "logs"},
+			},
+		}
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+
+		step := &stepSnapshotCreate{}
+		runStep(t, step, stateBag, multistep.ActionContinue)
+
+		snapshotNames := make(map[string]string)
+		for _, snapshot := range server.Snapshots() {
+			snapshotNames[snapshot.Id] = string(snapshot.Name)
+		}
+		var names []string
+		for _, id := range stateBag.Get("disk_snapshot_ids").(map[string]string) {
+			names = append(names, snapshotNames[id])
+		}
+		slices.Sort(names)
+		if want := []string{"packer-test-disk-0", "packer-test-disk-1"}; !slices.Equal(
+			names,
+			want,
+		) {
+			t.Errorf("expected disk snapshots %v, got %v", want, names)
+		}
+
+		step.Cleanup(stateBag)
+
+		snapshots := server.Snapshots()
+		if len(snapshots) != 1 || snapshots[0].Id != existing.Id {
+			t.Errorf("expected only existing snapshot %s, got %v", existing.Id, snapshots)
+		}
+	})
+
+	t.Run("MissingBootDiskID", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepSnapshotCreate{}, stateBag, multistep.ActionHalt)
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("SnapshotCreate", 1, oxidetest.Fault{})
+		stateBag := newTestStateBag(t, server)
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepSnapshotCreate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
+
+func TestStepImageCreate(t *testing.T) {
+	// setup runs the steps needed to produce a snapshot for the image.
+	setup := func(t *testing.T, server *oxidetest.Server) *multistep.BasicStateBag {
+		t.Helper()
+
+		stateBag := newTestStateBag(t, server)
+		stateBag.Get("config").(*Config).ArtifactName = "artifact"
+
+		runStep(t, &stepInstanceCreate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepInstanceStop{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepSnapshotCreate{}, stateBag, multistep.ActionContinue)
+
+		return stateBag
+	}
+
+	t.Run("CreatesImage", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := setup(t, server)
+
+		runStep(t, &stepImageCreate{}, stateBag, multistep.ActionContinue)
+
+		if got := stateBag.Get("image_name"); got != "artifact" {
+			t.Errorf("expected image_name artifact, got %v", got)
+		}
+	})
+
+	// imageNames returns the sorted names of the images server holds, other than
+	// the source image.
+	imageNames := func(server *oxidetest.Server) []string {
+		var names []string
+		for _, image := range server.Images() {
+			if image.Name != "noble" {
+				names = append(names, string(image.Name))
+			}
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	t.Run("ReplacesExistingImageWithForce", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage(testProject, oxide.Image{Name: "artifact"})
+		stateBag := setup(t, server)
+		stateBag.Get("config").(*Config).PackerForce = true
+
+		runStep(t, &stepArtifactValidate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepImageCreate{}, stateBag, multistep.ActionContinue)
+
+		if got := stateBag.Get("image_id"); got == existing.Id {
+			t.Error("expected existing image to be replaced")
+		}
+		if got := imageNames(server); !slices.Equal(got, []string{"artifact"}) {
+			t.Errorf("expected only the new image, got %v", got)
+		}
+		if n := server.Calls("ImageCreate"); n != 2 {
+			t.Errorf("expected 2 image create calls, got %d", n)
+		}
+	})
+
+	t.Run("ReplaceKeepsExistingImageOnCreateError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage(testProject, oxide.Image{Name: "artifact"})
+		server.Fail("ImageCreate", 1, oxidetest.Fault{})
+		stateBag := setup(t, server)
+		stateBag.Get("config").(*Config).PackerForce = true
+
+		runStep(t, &stepArtifactValidate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepImageCreate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		if n := server.Calls("ImageDelete"); n != 0 {
+			t.Errorf("expected no image delete calls, got %d", n)
+		}
+		if images := server.Images(); !slices.ContainsFunc(images, func(v oxide.Image) bool {
+			return v.Id == existing.Id
+		}) {
+			t.Error("expected existing image to be kept")
+		}
+	})
+
+	t.Run("ReplaceKeepsNewImageOnRecreateError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.CreateImage(testProject, oxide.Image{Name: "artifact"})
+		server.Fail("ImageCreate", 1, oxidetest.Fault{After: 1})
+		stateBag := setup(t, server)
+		stateBag.Get("config").(*Config).PackerForce = true
+
+		runStep(t, &stepArtifactValidate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepImageCreate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		// The existing image is gone, so the new image is kept under its
+		// temporary name rather than leaving nothing behind.
+		got := imageNames(server)
+		if len(got) != 1 || !strings.HasPrefix(got[0], "packer-replace-") {
+			t.Errorf("expected only the temporary image, got %v", got)
+		}
+	})
+
+	t.Run("ForceWithoutExistingImage", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		stateBag := setup(t, server)
+		stateBag.Get("config").(*Config).PackerForce = true
+
+		runStep(t, &stepArtifactValidate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepImageCreate{}, stateBag, multistep.ActionContinue)
+
+		if n := server.Calls("ImageDelete"); n != 0 {
+			t.Errorf("expected no image delete calls, got %d", n)
+		}
+	})
+
+	t.Run("DeleteExistingError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.CreateImage(testProject, oxide.Image{Name: "artifact"})
+		server.Fail("ImageDelete", 1, oxidetest.Fault{})
+		stateBag := setup(t, server)
+		stateBag.Get("config").(*Config).PackerForce = true
+
+		runStep(t, &stepArtifactValidate{}, stateBag, multistep.ActionContinue)
+		runStep(t, &stepImageCreate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+
+		// The temporary image is rolled back and the existing image is kept.
+		if got := imageNames(server); !slices.Equal(got, []string{"artifact"}) {
+			t.Errorf("expected only the existing image, got %v", got)
+		}
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("ImageCreate", 1, oxidetest.Fault{})
+		stateBag := setup(t, server)
+
+		runStep(t, &stepImageCreate{}, stateBag, multistep.ActionHalt)
+		assertStateError(t, stateBag)
+	})
+}
@@ -0,0 +1,288 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"unicode"
+
+	"github.com/hashicorp/packer-plugin-sdk/bootcommand"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+var _ multistep.Step = (*stepTypeBootCommand)(nil)
+
+// stepTypeBootCommand is a Packer plugin step to type the boot command into an
+// Oxide instance's serial console.
+type stepTypeBootCommand struct{}
+
+// Run waits for the configured boot wait and then types the boot command into
+// the serial console of an Oxide instance.
+func (s *stepTypeBootCommand) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	instanceIDRaw, ok := stateBag.GetOk("instance_id")
+	if !ok {
+		ui.Error("State does not contain instance ID. Cannot proceed!")
+		return multistep.ActionHalt
+	}
+	instanceID := instanceIDRaw.(string)
+
+	if config.BootWait > 0 {
+		ui.Sayf("Waiting %s for boot...", config.BootWait)
+
+		select {
+		case <-time.After(config.BootWait):
+		case <-ctx.Done():
+			return multistep.ActionHalt
+		}
+	}
+
+	command, err := interpolate.Render(config.FlatBootCommand(), &interpolate.Context{
+		Data: newBootCommandTemplateData(stateBag, config),
+	})
+	if err != nil {
+		ui.Error("Failed rendering boot command.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	seq, err := bootcommand.GenerateExpressionSequence(command)
+	if err != nil {
+		ui.Error("Failed parsing boot command.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	dialer, err := newSerialConsoleDialer(config)
+	if err != nil {
+		ui.Error("Failed connecting to Oxide instance serial console.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	conn, err := dialer.Dial(ctx, instanceID, 0)
+	if err != nil {
+		ui.Error("Failed connecting to Oxide instance serial console.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+	defer conn.Close()
+
+	ui.Say("Typing the boot command over the Oxide instance serial console...")
+
+	if err := seq.Do(ctx, newSerialConsoleDriver(ctx, conn, config.BootGroupInterval)); err != nil {
+		ui.Error("Failed typing boot command.")
+		stateBag.Put("error", fmt.Errorf("failed typing boot command: %w", err))
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the resources created by [stepTypeBootCommand.Run].
+func (s *stepTypeBootCommand) Cleanup(multistep.StateBag) {}
+
+// bootCommandTemplateData is the data available to templates in the boot
+// command.
+type bootCommandTemplateData struct {
+	// Address and port the instance reaches the HTTP server at, if one is
+	// running.
+	HTTPIP   string
+	HTTPPort int
+
+	// Name of the instance.
+	Name string
+}
+
+// newBootCommandTemplateData returns the boot command template data for the
+// build in stateBag.
+func newBootCommandTemplateData(
+	stateBag multistep.StateBag,
+	config *Config,
+) *bootCommandTemplateData {
+	data := &bootCommandTemplateData{Name: config.Name}
+
+	if httpIP, ok := stateBag.GetOk("http_ip"); ok {
+		data.HTTPIP = httpIP.(string)
+	}
+
+	if httpPort, ok := stateBag.GetOk("http_port"); ok {
+		data.HTTPPort = httpPort.(int)
+	}
+
+	return data
+}
+
+// serialConsoleKeyGroupSize is the number of bytes of typed input sent to the
+// serial console at once by [serialConsoleDriver].
+const serialConsoleKeyGroupSize = 16
+
+// serialConsoleSpecialKeys maps boot command special keys to the byte
+// sequences a terminal sends for them.
+var serialConsoleSpecialKeys = map[string]string{
+	"bs":       "\x7f",
+	"del":      "\x1b[3~",
+	"down":     "\x1b[B",
+	"end":      "\x1b[F",
+	"enter":    "\r",
+	"esc":      "\x1b",
+	"f1":       "\x1bOP",
+	"f2":       "\x1bOQ",
+	"f3":       "\x1bOR",
+	"f4":       "\x1bOS",
+	"f5":       "\x1b[15~",
+	"f6":       "\x1b[17~",
+	"f7":       "\x1b[18~",
+	"f8":       "\x1b[19~",
+	"f9":       "\x1b[20~",
+	"f10":      "\x1b[21~",
+	"f11":      "\x1b[23~",
+	"f12":      "\x1b[24~",
+	"home":     "\x1b[H",
+	"insert":   "\x1b[2~",
+	"left":     "\x1b[D",
+	"pagedown": "\x1b[6~",
+	"pageup":   "\x1b[5~",
+	"return":   "\r",
+	"right":    "\x1b[C",
+	"spacebar": " ",
+	"tab":      "\t",
+	"up":       "\x1b[A",
+}
+
+// serialConsoleDriver is a [bootcommand.BCDriver] that types into a serial
+// console. Serial consoles receive characters rather than key events, so
+// modifier keys change the characters typed while they're held: control
+// produces control characters, alt prefixes an escape, and shift produces
+// upper case letters. Super and menu keys have no serial equivalent and are
+// ignored.
+type serialConsoleDriver struct {
+	ctx      context.Context
+	w        io.Writer
+	interval time.Duration
+
+	buf   []byte
+	ctrl  bool
+	alt   bool
+	shift bool
+}
+
+// newSerialConsoleDriver creates a driver that types into w, waiting interval
+// between each group of typed bytes. When interval is not positive, the
+// `PACKER_KEY_INTERVAL` environment variable or a default is used instead.
+func newSerialConsoleDriver(
+	ctx context.Context,
+	w io.Writer,
+	interval time.Duration,
+) *serialConsoleDriver {
+	if interval <= 0 {
+		interval = bootcommand.PackerKeyDefault
+		if d, err := time.ParseDuration(os.Getenv(bootcommand.PackerKeyEnv)); err == nil {
+			interval = d
+		}
+	}
+
+	return &serialConsoleDriver{
+		ctx:      ctx,
+		w:        w,
+		interval: interval,
+	}
+}
+
+// SendKey types key, applying any held modifiers. Releasing a key types
+// nothing.
+func (d *serialConsoleDriver) SendKey(key rune, action bootcommand.KeyAction) error {
+	if action == bootcommand.KeyOff {
+		return nil
+	}
+
+	if d.shift {
+		key = unicode.ToUpper(key)
+	}
+
+	if d.ctrl {
+		switch {
+		case key >= '@' && key <= '_', key >= 'a' && key <= 'z':
+			key &= 0x1f
+		case key == '?':
+			key = 0x7f
+		}
+	}
+
+	d.send(string(key))
+
+	return nil
+}
+
+// SendSpecial types a special key or updates the held modifiers.
+func (d *serialConsoleDriver) SendSpecial(special string, action bootcommand.KeyAction) error {
+	switch special {
+	case "leftctrl", "rightctrl":
+		d.ctrl = action == bootcommand.KeyOn
+		return nil
+	case "leftalt", "rightalt":
+		d.alt = action == bootcommand.KeyOn
+		return nil
+	case "leftshift", "rightshift":
+		d.shift = action == bootcommand.KeyOn
+		return nil
+	case "leftsuper", "rightsuper", "menu":
+		return nil
+	}
+
+	seq, ok := serialConsoleSpecialKeys[special]
+	if !ok {
+		return fmt.Errorf("special key %s is not supported over the serial console", special)
+	}
+
+	if action != bootcommand.KeyOff {
+		d.send(seq)
+	}
+
+	return nil
+}
+
+// send buffers the bytes for a key, prefixed with an escape when alt is held.
+func (d *serialConsoleDriver) send(s string) {
+	if d.alt {
+		d.buf = append(d.buf, '\x1b')
+	}
+	d.buf = append(d.buf, s...)
+}
+
+// Flush writes the buffered bytes in groups, waiting between each group so the
+// guest can keep up.
+func (d *serialConsoleDriver) Flush() error {
+	defer func() {
+		d.buf = nil
+	}()
+
+	for len(d.buf) > 0 {
+		n := min(len(d.buf), serialConsoleKeyGroupSize)
+		if _, err := d.w.Write(d.buf[:n]); err != nil {
+			return err
+		}
+		d.buf = d.buf[n:]
+
+		select {
+		case <-time.After(d.interval):
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		}
+	}
+
+	return nil
+}
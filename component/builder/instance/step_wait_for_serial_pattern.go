@@ -0,0 +1,80 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+var _ multistep.Step = (*stepWaitForSerialPattern)(nil)
+
+// stepWaitForSerialPattern is a Packer plugin step to wait for a pattern to
+// appear on an Oxide instance's serial console.
+type stepWaitForSerialPattern struct{}
+
+// Run reads the serial console of an Oxide instance until the configured
+// pattern appears.
+func (s *stepWaitForSerialPattern) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	config := stateBag.Get("config").(*Config)
+
+	instanceIDRaw, ok := stateBag.GetOk("instance_id")
+	if !ok {
+		ui.Error("State does not contain instance ID. Cannot proceed!")
+		return multistep.ActionHalt
+	}
+	instanceID := instanceIDRaw.(string)
+
+	pattern, err := regexp.Compile(config.WaitForSerialPattern)
+	if err != nil {
+		ui.Error("Failed compiling serial console pattern.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Sayf("Waiting for Oxide instance serial console to match: %s", pattern)
+
+	var output []byte
+	if err := (waiter{
+		Interval: config.PollInterval,
+		Timeout:  config.WaitForSerialPatternTimeout,
+	}).Wait(ctx, func(ctx context.Context) (bool, error) {
+		b, err := readSerialConsole(ctx, oxideClient, instanceID, uint64(len(output)))
+		output = append(output, b...)
+		if err != nil {
+			return false, fmt.Errorf("failed reading oxide instance serial console: %w", err)
+		}
+
+		return pattern.MatchString(serialConsoleText(output)), nil
+	}); err != nil {
+		if ctx.Err() == nil {
+			err = fmt.Errorf("serial console did not match %q: %w", pattern, err)
+			if tail := tailLines(serialConsoleText(output), serialConsoleTailLines); tail != "" {
+				err = fmt.Errorf("%w\n\nSerial console output:\n%s", err, tail)
+			}
+		}
+
+		ui.Errorf("Failed waiting for Oxide instance serial console: %v", err)
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Oxide instance serial console matched.")
+
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the resources created by [stepWaitForSerialPattern.Run].
+func (s *stepWaitForSerialPattern) Cleanup(multistep.StateBag) {}
@@ -0,0 +1,202 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+// maxPollInterval is the upper bound the poll interval backs off to, unless the
+// configured poll interval is already larger.
+const maxPollInterval = 30 * time.Second
+
+// errWaitTimeout is returned by [waiter.Wait] when the condition is not met
+// before the timeout elapses.
+var errWaitTimeout = errors.New("timed out")
+
+// waiter polls a condition with exponential backoff.
+type waiter struct {
+	// Interval before the first retry. It doubles after every poll until it
+	// reaches [maxPollInterval].
+	Interval time.Duration
+
+	// Maximum time to wait for the condition to be met.
+	Timeout time.Duration
+}
+
+// Wait calls poll until it reports that the condition is met, it returns an
+// error, the timeout elapses, or ctx is cancelled. The context passed to poll
+// is bound by the timeout. Cancellation is honored while sleeping between
+// polls.
+func (w waiter) Wait(ctx context.Context, poll func(ctx context.Context) (bool, error)) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	interval := w.Interval
+	maxInterval := max(interval, maxPollInterval)
+
+	for {
+		done, err := poll(timeoutCtx)
+		if err != nil {
+			// Report a timeout rather than the request error it caused.
+			if ctx.Err() == nil && timeoutCtx.Err() != nil {
+				return fmt.Errorf("%w after %s", errWaitTimeout, w.Timeout)
+			}
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timeoutCtx.Done():
+			timer.Stop()
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("%w after %s", errWaitTimeout, w.Timeout)
+		case <-timer.C:
+		}
+
+		interval = min(interval*2, maxInterval)
+	}
+}
+
+// errInstanceState is returned by [waitForInstanceState] when an instance
+// enters a run state it's not expected to pass through on its way to the
+// target run state.
+var errInstanceState = errors.New("unexpected instance state")
+
+// transitionalInstanceStates lists the run states an instance may pass through
+// on its way to each target run state. Any other run state fails the wait
+// immediately rather than waiting for the timeout.
+var transitionalInstanceStates = map[oxide.InstanceState][]oxide.InstanceState{
+	oxide.InstanceStateRunning: {
+		oxide.InstanceStateCreating,
+		oxide.InstanceStateStarting,
+		oxide.InstanceStateRebooting,
+		oxide.InstanceStateMigrating,
+		oxide.InstanceStateRepairing,
+	},
+	oxide.InstanceStateStopped: {
+		oxide.InstanceStateCreating,
+		oxide.InstanceStateStarting,
+		oxide.InstanceStateRunning,
+		oxide.InstanceStateStopping,
+		oxide.InstanceStateRebooting,
+		oxide.InstanceStateMigrating,
+		oxide.InstanceStateRepairing,
+	},
+}
+
+// instanceStateError is returned by [waitForInstanceState] when an instance
+// does not reach the target run state. It carries diagnostics to help the user
+// understand why.
+type instanceStateError struct {
+	// Run state that was waited for.
+	Target oxide.InstanceState
+
+	// Last observed run state of the instance, if any.
+	State oxide.InstanceState
+
+	// Most recent serial console output of the instance, if available.
+	SerialConsole string
+
+	err error
+}
+
+func (e *instanceStateError) Error() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "oxide instance did not become %s: %v", e.Target, e.err)
+	if e.State != "" {
+		fmt.Fprintf(&b, " (last observed state: %s)", e.State)
+	}
+	if e.SerialConsole != "" {
+		fmt.Fprintf(&b, "\n\nSerial console output:\n%s", e.SerialConsole)
+	}
+
+	return b.String()
+}
+
+func (e *instanceStateError) Unwrap() error {
+	return e.err
+}
+
+// isInstanceFailed reports whether err is an [*instanceStateError] for an
+// instance last observed in the `failed` run state.
+func isInstanceFailed(err error) bool {
+	var stateErr *instanceStateError
+	return errors.As(err, &stateErr) && stateErr.State == oxide.InstanceStateFailed
+}
+
+// waitForInstanceState polls an instance until its run state is target,
+// reporting intermediate states to ui with the given waiting message. The wait
+// fails immediately when the instance enters a run state that's not expected
+// on the way to target, such as `failed` or `destroyed`. Errors refreshing the
+// instance abort the wait unless retryErrors is set, in which case they are
+// reported and polling continues.
+//
+// Unless ctx is cancelled, the returned error is an [*instanceStateError]
+// that includes the last observed run state and the tail of the instance's
+// serial console.
+func waitForInstanceState(
+	ctx context.Context,
+	oxideClient *oxide.Client,
+	ui packer.Ui,
+	w waiter,
+	instanceID string,
+	target oxide.InstanceState,
+	message string,
+	retryErrors bool,
+) error {
+	var lastState oxide.InstanceState
+
+	err := w.Wait(ctx, func(ctx context.Context) (bool, error) {
+		instance, err := oxideClient.InstanceView(ctx, oxide.InstanceViewParams{
+			Instance: oxide.NameOrId(instanceID),
+		})
+		if err != nil {
+			if retryErrors && ctx.Err() == nil {
+				ui.Errorf("Failed refreshing Oxide instance state: %v", err)
+				return false, nil
+			}
+			return false, fmt.Errorf("failed refreshing oxide instance state: %w", err)
+		}
+
+		lastState = instance.RunState
+
+		if instance.RunState == target {
+			ui.Sayf("Oxide instance is %s.", instance.RunState)
+			return true, nil
+		}
+
+		if !slices.Contains(transitionalInstanceStates[target], instance.RunState) {
+			return false, errInstanceState
+		}
+
+		ui.Sayf("%s: Currently %s.", message, instance.RunState)
+		return false, nil
+	})
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	return &instanceStateError{
+		Target:        target,
+		State:         lastState,
+		SerialConsole: serialConsoleTail(ctx, oxideClient, instanceID, serialConsoleTailLines),
+		err:           err,
+	}
+}
@@ -0,0 +1,106 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package instance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaiter_Wait(t *testing.T) {
+	t.Run("PollsUntilDone", func(t *testing.T) {
+		var polls int
+		err := waiter{Interval: time.Millisecond, Timeout: time.Minute}.Wait(
+			context.Background(),
+			func(context.Context) (bool, error) {
+				polls++
+				return polls == 3, nil
+			},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if polls != 3 {
+			t.Errorf("expected 3 polls, got %d", polls)
+		}
+	})
+
+	t.Run("BacksOff", func(t *testing.T) {
+		var times []time.Time
+		err := waiter{Interval: 5 * time.Millisecond, Timeout: time.Minute}.Wait(
+			context.Background(),
+			func(context.Context) (bool, error) {
+				times = append(times, time.Now())
+				return len(times) == 4, nil
+			},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Intervals of 5ms, 10ms, and 20ms are slept between the 4 polls.
+		if elapsed := times[3].Sub(times[0]); elapsed < 35*time.Millisecond {
+			t.Errorf("expected at least 35ms between first and last poll, got %s", elapsed)
+		}
+		if gap := times[3].Sub(times[2]); gap < 20*time.Millisecond {
+			t.Errorf("expected last interval of at least 20ms, got %s", gap)
+		}
+	})
+
+	t.Run("ReturnsPollError", func(t *testing.T) {
+		want := errors.New("poll failed")
+		err := waiter{Interval: time.Millisecond, Timeout: time.Minute}.Wait(
+			context.Background(),
+			func(context.Context) (bool, error) { return false, want },
+		)
+		if !errors.Is(err, want) {
+			t.Errorf("expected %v, got %v", want, err)
+		}
+	})
+
+	t.Run("TimesOut", func(t *testing.T) {
+		err := waiter{Interval: time.Millisecond, Timeout: 20 * time.Millisecond}.Wait(
+			context.Background(),
+			func(context.Context) (bool, error) { return false, nil },
+		)
+		if !errors.Is(err, errWaitTimeout) {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	})
+
+	t.Run("TimeoutCausesPollError", func(t *testing.T) {
+		err := waiter{Interval: time.Millisecond, Timeout: 20 * time.Millisecond}.Wait(
+			context.Background(),
+			func(ctx context.Context) (bool, error) {
+				<-ctx.Done()
+				return false, ctx.Err()
+			},
+		)
+		if !errors.Is(err, errWaitTimeout) {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	})
+
+	t.Run("CancelledWhileSleeping", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		start := time.Now()
+		err := waiter{Interval: time.Hour, Timeout: 2 * time.Hour}.Wait(
+			ctx,
+			func(context.Context) (bool, error) {
+				cancel()
+				return false, nil
+			},
+		)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected cancellation to interrupt sleep, took %s", elapsed)
+		}
+	})
+}
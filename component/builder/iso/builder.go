@@ -0,0 +1,79 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc struct-markdown
+
+// Package iso implements the `oxide-iso` builder, which installs an Oxide image
+// from an ISO.
+package iso
+
+import (
+	"context"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/builder/instance"
+)
+
+const BuilderID = "oxide.iso"
+
+var _ packer.Builder = (*Builder)(nil)
+
+// The `oxide-iso` builder creates custom images for use with [Oxide](https://oxide.computer)
+// by installing an operating system from an ISO. The builder uploads the ISO into a temporary
+// image, launches a temporary instance with a blank boot disk and the ISO attached, and types
+// the boot command over the instance's serial console to drive the installer. Once the
+// installation completes, the builder connects to the instance, provisions it, and then creates
+// a new image from the instance's boot disk.
+//
+// The builder does not manage images. Once it creates an image, it is up to you
+// to use it or delete it.
+type Builder struct {
+	config Config
+}
+
+// ConfigSpec returns the HCL configuration specification for the builder.
+func (b *Builder) ConfigSpec() hcldec.ObjectSpec {
+	return b.config.FlatMapstructure().HCL2Spec()
+}
+
+// Prepare configures the builder and validates its configuration.
+func (b *Builder) Prepare(args ...any) ([]string, []string, error) {
+	warnings, err := b.config.Prepare(args...)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	return nil, warnings, nil
+}
+
+// Run executes the builder steps to create an Oxide image.
+func (b *Builder) Run(
+	ctx context.Context,
+	ui packer.Ui,
+	hook packer.Hook,
+) (packer.Artifact, error) {
+	steps := instance.BuildSteps(
+		&b.config.Config,
+		[]multistep.Step{
+			&commonsteps.StepDownload{
+				Checksum:    b.config.ISOChecksum,
+				Description: "ISO",
+				Extension:   b.config.TargetExtension,
+				ResultKey:   "iso_path",
+				TargetPath:  b.config.TargetPath,
+				Url:         b.config.ISOUrls,
+			},
+		},
+		[]multistep.Step{
+			&stepISOImport{config: &b.config},
+			commonsteps.HTTPServerFromHTTPConfig(&b.config.HTTPConfig),
+			&stepHTTPIPDiscover{config: &b.config},
+		},
+	)
+
+	return instance.RunBuild(ctx, ui, hook, BuilderID, &b.config.Config, steps)
+}
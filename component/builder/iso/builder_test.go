@@ -0,0 +1,239 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package iso_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/builder/iso"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/diskimport"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxidetest"
+)
+
+// testISO is the content of the ISO used by the tests. Its second chunk is all
+// zeros and its last chunk isn't a multiple of the block size.
+var testISO = slices.Concat(
+	bytes.Repeat([]byte("a"), diskimport.ChunkSize),
+	make([]byte, diskimport.ChunkSize),
+	bytes.Repeat([]byte("b"), 100),
+)
+
+// newTestBuilder returns a builder prepared to run against server with an ISO
+// of [testISO]. The configuration is merged over the defaults.
+func newTestBuilder(
+	t *testing.T,
+	server *oxidetest.Server,
+	config map[string]any,
+) *iso.Builder {
+	t.Helper()
+
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+
+	isoPath := filepath.Join(t.TempDir(), "test.iso")
+	if err := os.WriteFile(isoPath, testISO, 0o644); err != nil {
+		t.Fatalf("failed writing iso: %v", err)
+	}
+
+	return oxidetest.Prepare[iso.Builder](t, server, map[string]any{
+		"project":             "test-project",
+		"name":                "packer-test",
+		"iso_url":             isoPath,
+		"iso_checksum":        "none",
+		"artifact_os":         "debian",
+		"artifact_version":    "13",
+		"communicator":        "none",
+		"packer_build_name":   "test",
+		"packer_builder_type": "oxide-iso",
+	}, config)
+}
+
+// TestBuilder_Prepare tests the validation of the builder configuration.
+func TestBuilder_Prepare(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config map[string]any
+		err    string
+	}{
+		"RejectsBootDiskImageID": {
+			config: map[string]any{"boot_disk_image_id": "feb2c8ee-5a1d-4d66-beeb-289b860561bf"},
+			err:    "not supported since the boot disk is installed from the ISO",
+		},
+		"RequiresArtifactOS": {
+			config: map[string]any{"artifact_os": ""},
+			err:    "artifact_os and artifact_version are required",
+		},
+		"RequiresISOURL": {
+			config: map[string]any{"iso_url": ""},
+			err:    "iso_url",
+		},
+		"RejectsInvalidISOBlockSize": {
+			config: map[string]any{"iso_block_size": 1024},
+			err:    "iso_block_size must be one of",
+		},
+		"RejectsDiskImageNamedAfterArtifact": {
+			config: map[string]any{
+				"name": "packer-test",
+				"disk": []map[string]any{
+					{"name": "data", "size": 1024, "image": map[string]any{"name": "packer-test"}},
+				},
+			},
+			err: `disk 0: image name "packer-test" is already used`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := map[string]any{
+				"project":          "test-project",
+				"iso_url":          "https://example.com/test.iso",
+				"iso_checksum":     "none",
+				"artifact_os":      "debian",
+				"artifact_version": "13",
+				"communicator":     "none",
+			}
+			for k, v := range tc.config {
+				raw[k] = v
+			}
+
+			var b iso.Builder
+			_, _, err := b.Prepare(raw)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+// TestBuilder_Run tests the full builder pipeline against a fake Oxide API.
+func TestBuilder_Run(t *testing.T) {
+	t.Run("CreatesImage", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b := newTestBuilder(t, server, nil)
+
+		// The ISO disk and the blank boot disk only exist while the instance is
+		// provisioned.
+		var isoContents []byte
+		var isoVersion string
+		var bootDiskBlockSize oxide.BlockSize
+		hook := &packer.MockHook{
+			RunFunc: func(context.Context) error {
+				for _, disk := range server.Disks() {
+					switch disk.Name {
+					case "packer-test-iso":
+						isoContents = server.Contents(disk.Id)
+					case "packer-test":
+						bootDiskBlockSize = disk.BlockSize
+					}
+				}
+				for _, image := range server.Images() {
+					if image.Name == "packer-test-iso" {
+						isoVersion = image.Version
+					}
+				}
+				return nil
+			},
+		}
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), hook)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if artifact == nil {
+			t.Fatal("expected artifact")
+		}
+
+		if artifact.BuilderId() != iso.BuilderID {
+			t.Errorf("expected builder ID %s, got %s", iso.BuilderID, artifact.BuilderId())
+		}
+		if artifact.String() != "packer-test ("+artifact.Id()+")" {
+			t.Errorf("unexpected artifact: %s", artifact.String())
+		}
+
+		// The ISO is padded to the block size and its zero chunk isn't written.
+		expected := slices.Concat(testISO, make([]byte, 512-100))
+		if !bytes.Equal(isoContents, expected) {
+			t.Errorf("unexpected ISO disk contents of %d bytes", len(isoContents))
+		}
+		if n := server.Calls("DiskBulkWriteImport"); n != 2 {
+			t.Errorf("expected 2 bulk writes, got %d", n)
+		}
+		if isoVersion != "13" {
+			t.Errorf("expected ISO image version 13, got %q", isoVersion)
+		}
+		if bootDiskBlockSize != 512 {
+			t.Errorf("expected boot disk block size 512, got %d", bootDiskBlockSize)
+		}
+
+		server.AssertNoLeftovers(t, artifact.Id())
+	})
+
+	t.Run("TypesBootCommandWithHTTPServer", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		b := newTestBuilder(t, server, map[string]any{
+			"http_content":      map[string]string{"/preseed.cfg": "d-i foo"},
+			"http_bind_address": "127.0.0.1",
+			"boot_command": []string{
+				"url=http://{{ .HTTPIP }}:{{ .HTTPPort }}/preseed.cfg<enter>",
+			},
+			"boot_wait":              "-1s",
+			"boot_keygroup_interval": "1ms",
+		})
+
+		var input string
+		hook := &packer.MockHook{
+			RunFunc: func(context.Context) error {
+				input = server.SerialConsoleInput(server.Instances()[0].Id)
+				return nil
+			},
+		}
+
+		artifact, err := b.Run(t.Context(), packer.TestUi(t), hook)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !strings.HasPrefix(input, "url=http://127.0.0.1:") ||
+			!strings.HasSuffix(input, "/preseed.cfg\r") {
+			t.Errorf("unexpected boot command input %q", input)
+		}
+
+		server.AssertNoLeftovers(t, artifact.Id())
+	})
+
+	// Each case fails a single API operation and checks that the build halts and
+	// cleans up every resource it created before the failure.
+	for _, operation := range []string{
+		"DiskCreate",
+		"DiskBulkWriteImport",
+		"DiskFinalizeImport",
+		"SnapshotView",
+		"ImageCreate",
+		"InstanceCreate",
+	} {
+		t.Run("HaltsOn"+operation, func(t *testing.T) {
+			server := oxidetest.NewServer(t)
+			server.Fail(operation, 1, oxidetest.Fault{})
+			b := newTestBuilder(t, server, nil)
+
+			artifact, err := b.Run(t.Context(), packer.TestUi(t), &packer.MockHook{})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if artifact != nil {
+				t.Errorf("expected no artifact, got %s", artifact.String())
+			}
+
+			server.AssertNoLeftovers(t)
+		})
+	}
+}
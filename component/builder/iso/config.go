@@ -0,0 +1,118 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc struct-markdown
+
+package iso
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/mitchellh/mapstructure"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/builder/instance"
+)
+
+// The configuration arguments for the builder. Arguments can either be required or optional.
+type Config struct {
+	// Arguments shared with the `oxide-instance` builder, except for the boot
+	// disk source arguments since the boot disk is installed from the ISO.
+	instance.Config `mapstructure:",squash"`
+
+	// ISO to download and install from.
+	commonsteps.ISOConfig `mapstructure:",squash"`
+
+	// HTTP server to serve files such as kickstart or preseed files to the
+	// installer.
+	commonsteps.HTTPConfig `mapstructure:",squash"`
+
+	// Block size of the disk the ISO is imported into. Must be `512`, `2048`,
+	// or `4096`. Defaults to `512`.
+	ISOBlockSize int `mapstructure:"iso_block_size"`
+
+	// Address the instance reaches the HTTP server at, available to the boot
+	// command as `{{ .HTTPIP }}`. Defaults to `http_bind_address` when it's set,
+	// or the local address Packer uses to reach the Oxide API.
+	HTTPIP string `mapstructure:"http_ip"`
+}
+
+// Prepare decodes the configuration and validates it.
+func (c *Config) Prepare(args ...any) ([]string, error) {
+	var metadata mapstructure.Metadata
+
+	if err := config.Decode(c, &config.DecodeOpts{
+		Metadata:    &metadata,
+		Interpolate: false,
+		PluginType:  BuilderID,
+	}, args...); err != nil {
+		return nil, fmt.Errorf("failed decoding configuration: %w", err)
+	}
+
+	// Set defaults.
+	{
+		if c.ISOBlockSize == 0 {
+			c.ISOBlockSize = 512
+		}
+
+		// The artifact is named after the temporary instance by default, since
+		// there's no source image to name it after. It's set before the
+		// configuration is validated so that names conflicting with it are
+		// caught.
+		c.SetDefaultName()
+		if c.ArtifactName == "" {
+			c.ArtifactName = c.Name
+		}
+	}
+
+	var multiErr *packer.MultiError
+
+	warnings, err := c.Config.Validate()
+	if err != nil {
+		multiErr = packer.MultiErrorAppend(multiErr, err)
+	}
+
+	isoWarnings, isoErrs := c.ISOConfig.Prepare(nil)
+	warnings = append(warnings, isoWarnings...)
+	multiErr = packer.MultiErrorAppend(multiErr, isoErrs...)
+
+	multiErr = packer.MultiErrorAppend(multiErr, c.HTTPConfig.Prepare(nil)...)
+
+	if c.BootDiskImageID != "" || c.BootDiskSnapshotID != "" || c.BootDiskSource != "" {
+		multiErr = packer.MultiErrorAppend(
+			multiErr,
+			errors.New(
+				"boot_disk_image_id, boot_disk_snapshot_id, and boot_disk_source are not "+
+					"supported since the boot disk is installed from the ISO",
+			),
+		)
+	}
+
+	switch c.ISOBlockSize {
+	case 512, 2048, 4096:
+	default:
+		multiErr = packer.MultiErrorAppend(
+			multiErr,
+			fmt.Errorf("iso_block_size must be one of 512, 2048, or 4096, got %d", c.ISOBlockSize),
+		)
+	}
+
+	if !c.SkipCreateImage && (c.ArtifactOS == "" || c.ArtifactVersion == "") {
+		multiErr = packer.MultiErrorAppend(
+			multiErr,
+			errors.New(
+				"artifact_os and artifact_version are required unless skip_create_image is set",
+			),
+		)
+	}
+
+	if multiErr != nil && len(multiErr.Errors) > 0 {
+		return warnings, multiErr
+	}
+
+	return warnings, nil
+}
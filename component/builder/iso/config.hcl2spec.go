@@ -0,0 +1,272 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package iso
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/builder/instance"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatConfig struct {
+	PackerBuildName                  *string                   `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType                *string                   `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion                *string                   `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug                      *bool                     `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce                      *bool                     `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError                    *string                   `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars                   map[string]string         `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars              []string                  `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	Type                             *string                   `mapstructure:"communicator" cty:"communicator" hcl:"communicator"`
+	PauseBeforeConnect               *string                   `mapstructure:"pause_before_connecting" cty:"pause_before_connecting" hcl:"pause_before_connecting"`
+	SSHHost                          *string                   `mapstructure:"ssh_host" cty:"ssh_host" hcl:"ssh_host"`
+	SSHPort                          *int                      `mapstructure:"ssh_port" cty:"ssh_port" hcl:"ssh_port"`
+	SSHUsername                      *string                   `mapstructure:"ssh_username" cty:"ssh_username" hcl:"ssh_username"`
+	SSHPassword                      *string                   `mapstructure:"ssh_password" cty:"ssh_password" hcl:"ssh_password"`
+	SSHKeyPairName                   *string                   `mapstructure:"ssh_keypair_name" undocumented:"true" cty:"ssh_keypair_name" hcl:"ssh_keypair_name"`
+	SSHTemporaryKeyPairName          *string                   `mapstructure:"temporary_key_pair_name" undocumented:"true" cty:"temporary_key_pair_name" hcl:"temporary_key_pair_name"`
+	SSHTemporaryKeyPairType          *string                   `mapstructure:"temporary_key_pair_type" cty:"temporary_key_pair_type" hcl:"temporary_key_pair_type"`
+	SSHTemporaryKeyPairBits          *int                      `mapstructure:"temporary_key_pair_bits" cty:"temporary_key_pair_bits" hcl:"temporary_key_pair_bits"`
+	SSHCiphers                       []string                  `mapstructure:"ssh_ciphers" cty:"ssh_ciphers" hcl:"ssh_ciphers"`
+	SSHClearAuthorizedKeys           *bool                     `mapstructure:"ssh_clear_authorized_keys" cty:"ssh_clear_authorized_keys" hcl:"ssh_clear_authorized_keys"`
+	SSHKEXAlgos                      []string                  `mapstructure:"ssh_key_exchange_algorithms" cty:"ssh_key_exchange_algorithms" hcl:"ssh_key_exchange_algorithms"`
+	SSHPrivateKeyFile                *string                   `mapstructure:"ssh_private_key_file" undocumented:"true" cty:"ssh_private_key_file" hcl:"ssh_private_key_file"`
+	SSHCertificateFile               *string                   `mapstructure:"ssh_certificate_file" cty:"ssh_certificate_file" hcl:"ssh_certificate_file"`
+	SSHPty                           *bool                     `mapstructure:"ssh_pty" cty:"ssh_pty" hcl:"ssh_pty"`
+	SSHTimeout                       *string                   `mapstructure:"ssh_timeout" cty:"ssh_timeout" hcl:"ssh_timeout"`
+	SSHWaitTimeout                   *string                   `mapstructure:"ssh_wait_timeout" undocumented:"true" cty:"ssh_wait_timeout" hcl:"ssh_wait_timeout"`
+	SSHAgentAuth                     *bool                     `mapstructure:"ssh_agent_auth" undocumented:"true" cty:"ssh_agent_auth" hcl:"ssh_agent_auth"`
+	SSHDisableAgentForwarding        *bool                     `mapstructure:"ssh_disable_agent_forwarding" cty:"ssh_disable_agent_forwarding" hcl:"ssh_disable_agent_forwarding"`
+	SSHHandshakeAttempts             *int                      `mapstructure:"ssh_handshake_attempts" cty:"ssh_handshake_attempts" hcl:"ssh_handshake_attempts"`
+	SSHBastionHost                   *string                   `mapstructure:"ssh_bastion_host" cty:"ssh_bastion_host" hcl:"ssh_bastion_host"`
+	SSHBastionPort                   *int                      `mapstructure:"ssh_bastion_port" cty:"ssh_bastion_port" hcl:"ssh_bastion_port"`
+	SSHBastionAgentAuth              *bool                     `mapstructure:"ssh_bastion_agent_auth" cty:"ssh_bastion_agent_auth" hcl:"ssh_bastion_agent_auth"`
+	SSHBastionUsername               *string                   `mapstructure:"ssh_bastion_username" cty:"ssh_bastion_username" hcl:"ssh_bastion_username"`
+	SSHBastionPassword               *string                   `mapstructure:"ssh_bastion_password" cty:"ssh_bastion_password" hcl:"ssh_bastion_password"`
+	SSHBastionInteractive            *bool                     `mapstructure:"ssh_bastion_interactive" cty:"ssh_bastion_interactive" hcl:"ssh_bastion_interactive"`
+	SSHBastionPrivateKeyFile         *string                   `mapstructure:"ssh_bastion_private_key_file" cty:"ssh_bastion_private_key_file" hcl:"ssh_bastion_private_key_file"`
+	SSHBastionCertificateFile        *string                   `mapstructure:"ssh_bastion_certificate_file" cty:"ssh_bastion_certificate_file" hcl:"ssh_bastion_certificate_file"`
+	SSHFileTransferMethod            *string                   `mapstructure:"ssh_file_transfer_method" cty:"ssh_file_transfer_method" hcl:"ssh_file_transfer_method"`
+	SSHProxyHost                     *string                   `mapstructure:"ssh_proxy_host" cty:"ssh_proxy_host" hcl:"ssh_proxy_host"`
+	SSHProxyPort                     *int                      `mapstructure:"ssh_proxy_port" cty:"ssh_proxy_port" hcl:"ssh_proxy_port"`
+	SSHProxyUsername                 *string                   `mapstructure:"ssh_proxy_username" cty:"ssh_proxy_username" hcl:"ssh_proxy_username"`
+	SSHProxyPassword                 *string                   `mapstructure:"ssh_proxy_password" cty:"ssh_proxy_password" hcl:"ssh_proxy_password"`
+	SSHKeepAliveInterval             *string                   `mapstructure:"ssh_keep_alive_interval" cty:"ssh_keep_alive_interval" hcl:"ssh_keep_alive_interval"`
+	SSHReadWriteTimeout              *string                   `mapstructure:"ssh_read_write_timeout" cty:"ssh_read_write_timeout" hcl:"ssh_read_write_timeout"`
+	SSHRemoteTunnels                 []string                  `mapstructure:"ssh_remote_tunnels" cty:"ssh_remote_tunnels" hcl:"ssh_remote_tunnels"`
+	SSHLocalTunnels                  []string                  `mapstructure:"ssh_local_tunnels" cty:"ssh_local_tunnels" hcl:"ssh_local_tunnels"`
+	SSHPublicKey                     []byte                    `mapstructure:"ssh_public_key" undocumented:"true" cty:"ssh_public_key" hcl:"ssh_public_key"`
+	SSHPrivateKey                    []byte                    `mapstructure:"ssh_private_key" undocumented:"true" cty:"ssh_private_key" hcl:"ssh_private_key"`
+	WinRMUser                        *string                   `mapstructure:"winrm_username" cty:"winrm_username" hcl:"winrm_username"`
+	WinRMPassword                    *string                   `mapstructure:"winrm_password" cty:"winrm_password" hcl:"winrm_password"`
+	WinRMHost                        *string                   `mapstructure:"winrm_host" cty:"winrm_host" hcl:"winrm_host"`
+	WinRMNoProxy                     *bool                     `mapstructure:"winrm_no_proxy" cty:"winrm_no_proxy" hcl:"winrm_no_proxy"`
+	WinRMPort                        *int                      `mapstructure:"winrm_port" cty:"winrm_port" hcl:"winrm_port"`
+	WinRMTimeout                     *string                   `mapstructure:"winrm_timeout" cty:"winrm_timeout" hcl:"winrm_timeout"`
+	WinRMUseSSL                      *bool                     `mapstructure:"winrm_use_ssl" cty:"winrm_use_ssl" hcl:"winrm_use_ssl"`
+	WinRMInsecure                    *bool                     `mapstructure:"winrm_insecure" cty:"winrm_insecure" hcl:"winrm_insecure"`
+	WinRMUseNTLM                     *bool                     `mapstructure:"winrm_use_ntlm" cty:"winrm_use_ntlm" hcl:"winrm_use_ntlm"`
+	BootGroupInterval                *string                   `mapstructure:"boot_keygroup_interval" cty:"boot_keygroup_interval" hcl:"boot_keygroup_interval"`
+	BootWait                         *string                   `mapstructure:"boot_wait" cty:"boot_wait" hcl:"boot_wait"`
+	BootCommand                      []string                  `mapstructure:"boot_command" cty:"boot_command" hcl:"boot_command"`
+	Host                             *string                   `mapstructure:"host" required:"false" cty:"host" hcl:"host"`
+	Token                            *string                   `mapstructure:"token" required:"false" cty:"token" hcl:"token"`
+	Profile                          *string                   `mapstructure:"profile" required:"false" cty:"profile" hcl:"profile"`
+	InsecureSkipVerify               *bool                     `mapstructure:"insecure_skip_verify" required:"false" cty:"insecure_skip_verify" hcl:"insecure_skip_verify"`
+	BootDiskImageID                  *string                   `mapstructure:"boot_disk_image_id" cty:"boot_disk_image_id" hcl:"boot_disk_image_id"`
+	BootDiskSnapshotID               *string                   `mapstructure:"boot_disk_snapshot_id" cty:"boot_disk_snapshot_id" hcl:"boot_disk_snapshot_id"`
+	BootDiskSource                   *string                   `mapstructure:"boot_disk_source" cty:"boot_disk_source" hcl:"boot_disk_source"`
+	Project                          *string                   `mapstructure:"project" required:"true" cty:"project" hcl:"project"`
+	BootDiskSize                     *uint64                   `mapstructure:"boot_disk_size" cty:"boot_disk_size" hcl:"boot_disk_size"`
+	Disks                            []instance.FlatDiskConfig `mapstructure:"disk" cty:"disk" hcl:"disk"`
+	IPPool                           *string                   `mapstructure:"ip_pool" cty:"ip_pool" hcl:"ip_pool"`
+	IPVersion                        *string                   `mapstructure:"ip_version" cty:"ip_version" hcl:"ip_version"`
+	FloatingIP                       *string                   `mapstructure:"floating_ip" cty:"floating_ip" hcl:"floating_ip"`
+	CreateFloatingIP                 *bool                     `mapstructure:"create_floating_ip" cty:"create_floating_ip" hcl:"create_floating_ip"`
+	VPC                              *string                   `mapstructure:"vpc" cty:"vpc" hcl:"vpc"`
+	Subnet                           *string                   `mapstructure:"subnet" cty:"subnet" hcl:"subnet"`
+	TemporaryNetwork                 *bool                     `mapstructure:"temporary_network" cty:"temporary_network" hcl:"temporary_network"`
+	TemporaryNetworkIPv4Block        *string                   `mapstructure:"temporary_network_ipv4_block" cty:"temporary_network_ipv4_block" hcl:"temporary_network_ipv4_block"`
+	SSHInterface                     *string                   `mapstructure:"ssh_interface" cty:"ssh_interface" hcl:"ssh_interface"`
+	AssociateExternalIP              *bool                     `mapstructure:"associate_external_ip" cty:"associate_external_ip" hcl:"associate_external_ip"`
+	TemporaryFirewallRule            *bool                     `mapstructure:"temporary_firewall_rule" cty:"temporary_firewall_rule" hcl:"temporary_firewall_rule"`
+	TemporaryFirewallRuleSourceCIDRs []string                  `mapstructure:"temporary_firewall_rule_source_cidrs" cty:"temporary_firewall_rule_source_cidrs" hcl:"temporary_firewall_rule_source_cidrs"`
+	Name                             *string                   `mapstructure:"name" cty:"name" hcl:"name"`
+	Hostname                         *string                   `mapstructure:"hostname" cty:"hostname" hcl:"hostname"`
+	CPUs                             *uint64                   `mapstructure:"cpus" cty:"cpus" hcl:"cpus"`
+	Memory                           *uint64                   `mapstructure:"memory" cty:"memory" hcl:"memory"`
+	SSHPublicKeys                    []string                  `mapstructure:"ssh_public_keys" cty:"ssh_public_keys" hcl:"ssh_public_keys"`
+	ArtifactName                     *string                   `mapstructure:"artifact_name" cty:"artifact_name" hcl:"artifact_name"`
+	ArtifactDescription              *string                   `mapstructure:"artifact_description" cty:"artifact_description" hcl:"artifact_description"`
+	ArtifactOS                       *string                   `mapstructure:"artifact_os" cty:"artifact_os" hcl:"artifact_os"`
+	ArtifactVersion                  *string                   `mapstructure:"artifact_version" cty:"artifact_version" hcl:"artifact_version"`
+	SkipCreateImage                  *bool                     `mapstructure:"skip_create_image" required:"false" cty:"skip_create_image" hcl:"skip_create_image"`
+	PromoteToSilo                    *bool                     `mapstructure:"promote_to_silo" required:"false" cty:"promote_to_silo" hcl:"promote_to_silo"`
+	UserData                         *string                   `mapstructure:"user_data" required:"false" cty:"user_data" hcl:"user_data"`
+	WaitForSerialPattern             *string                   `mapstructure:"wait_for_serial_pattern" required:"false" cty:"wait_for_serial_pattern" hcl:"wait_for_serial_pattern"`
+	WaitForSerialPatternTimeout      *string                   `mapstructure:"wait_for_serial_pattern_timeout" cty:"wait_for_serial_pattern_timeout" hcl:"wait_for_serial_pattern_timeout"`
+	InstanceStartTimeout             *string                   `mapstructure:"instance_start_timeout" required:"false" cty:"instance_start_timeout" hcl:"instance_start_timeout"`
+	InstanceStopTimeout              *string                   `mapstructure:"instance_stop_timeout" required:"false" cty:"instance_stop_timeout" hcl:"instance_stop_timeout"`
+	CleanupTimeout                   *string                   `mapstructure:"cleanup_timeout" required:"false" cty:"cleanup_timeout" hcl:"cleanup_timeout"`
+	PollInterval                     *string                   `mapstructure:"poll_interval" required:"false" cty:"poll_interval" hcl:"poll_interval"`
+	SerialConsoleLog                 *string                   `mapstructure:"serial_console_log" required:"false" cty:"serial_console_log" hcl:"serial_console_log"`
+	SerialUsername                   *string                   `mapstructure:"serial_username" required:"false" cty:"serial_username" hcl:"serial_username"`
+	SerialPassword                   *string                   `mapstructure:"serial_password" required:"false" cty:"serial_password" hcl:"serial_password"`
+	SerialLoginTimeout               *string                   `mapstructure:"serial_login_timeout" required:"false" cty:"serial_login_timeout" hcl:"serial_login_timeout"`
+	SerialLoginPrompt                *string                   `mapstructure:"serial_login_prompt" required:"false" cty:"serial_login_prompt" hcl:"serial_login_prompt"`
+	SerialPasswordPrompt             *string                   `mapstructure:"serial_password_prompt" required:"false" cty:"serial_password_prompt" hcl:"serial_password_prompt"`
+	SerialShellPrompt                *string                   `mapstructure:"serial_shell_prompt" required:"false" cty:"serial_shell_prompt" hcl:"serial_shell_prompt"`
+	ISOChecksum                      *string                   `mapstructure:"iso_checksum" required:"true" cty:"iso_checksum" hcl:"iso_checksum"`
+	RawSingleISOUrl                  *string                   `mapstructure:"iso_url" required:"true" cty:"iso_url" hcl:"iso_url"`
+	ISOUrls                          []string                  `mapstructure:"iso_urls" cty:"iso_urls" hcl:"iso_urls"`
+	TargetPath                       *string                   `mapstructure:"iso_target_path" cty:"iso_target_path" hcl:"iso_target_path"`
+	TargetExtension                  *string                   `mapstructure:"iso_target_extension" cty:"iso_target_extension" hcl:"iso_target_extension"`
+	HTTPDir                          *string                   `mapstructure:"http_directory" cty:"http_directory" hcl:"http_directory"`
+	HTTPContent                      map[string]string         `mapstructure:"http_content" cty:"http_content" hcl:"http_content"`
+	HTTPPortMin                      *int                      `mapstructure:"http_port_min" cty:"http_port_min" hcl:"http_port_min"`
+	HTTPPortMax                      *int                      `mapstructure:"http_port_max" cty:"http_port_max" hcl:"http_port_max"`
+	HTTPAddress                      *string                   `mapstructure:"http_bind_address" cty:"http_bind_address" hcl:"http_bind_address"`
+	HTTPInterface                    *string                   `mapstructure:"http_interface" undocumented:"true" cty:"http_interface" hcl:"http_interface"`
+	HTTPNetworkProtocol              *string                   `mapstructure:"http_network_protocol" cty:"http_network_protocol" hcl:"http_network_protocol"`
+	ISOBlockSize                     *int                      `mapstructure:"iso_block_size" cty:"iso_block_size" hcl:"iso_block_size"`
+	HTTPIP                           *string                   `mapstructure:"http_ip" cty:"http_ip" hcl:"http_ip"`
+}
+
+// FlatMapstructure returns a new FlatConfig.
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatConfig)
+}
+
+// HCL2Spec returns the hcl spec of a Config.
+// This spec is used by HCL to read the fields of Config.
+// The decoded values from this spec will then be applied to a FlatConfig.
+func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"packer_build_name":                    &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":                  &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":                  &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":                         &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":                         &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":                      &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":                &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables":           &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"communicator":                         &hcldec.AttrSpec{Name: "communicator", Type: cty.String, Required: false},
+		"pause_before_connecting":              &hcldec.AttrSpec{Name: "pause_before_connecting", Type: cty.String, Required: false},
+		"ssh_host":                             &hcldec.AttrSpec{Name: "ssh_host", Type: cty.String, Required: false},
+		"ssh_port":                             &hcldec.AttrSpec{Name: "ssh_port", Type: cty.Number, Required: false},
+		"ssh_username":                         &hcldec.AttrSpec{Name: "ssh_username", Type: cty.String, Required: false},
+		"ssh_password":                         &hcldec.AttrSpec{Name: "ssh_password", Type: cty.String, Required: false},
+		"ssh_keypair_name":                     &hcldec.AttrSpec{Name: "ssh_keypair_name", Type: cty.String, Required: false},
+		"temporary_key_pair_name":              &hcldec.AttrSpec{Name: "temporary_key_pair_name", Type: cty.String, Required: false},
+		"temporary_key_pair_type":              &hcldec.AttrSpec{Name: "temporary_key_pair_type", Type: cty.String, Required: false},
+		"temporary_key_pair_bits":              &hcldec.AttrSpec{Name: "temporary_key_pair_bits", Type: cty.Number, Required: false},
+		"ssh_ciphers":                          &hcldec.AttrSpec{Name: "ssh_ciphers", Type: cty.List(cty.String), Required: false},
+		"ssh_clear_authorized_keys":            &hcldec.AttrSpec{Name: "ssh_clear_authorized_keys", Type: cty.Bool, Required: false},
+		"ssh_key_exchange_algorithms":          &hcldec.AttrSpec{Name: "ssh_key_exchange_algorithms", Type: cty.List(cty.String), Required: false},
+		"ssh_private_key_file":                 &hcldec.AttrSpec{Name: "ssh_private_key_file", Type: cty.String, Required: false},
+		"ssh_certificate_file":                 &hcldec.AttrSpec{Name: "ssh_certificate_file", Type: cty.String, Required: false},
+		"ssh_pty":                              &hcldec.AttrSpec{Name: "ssh_pty", Type: cty.Bool, Required: false},
+		"ssh_timeout":                          &hcldec.AttrSpec{Name: "ssh_timeout", Type: cty.String, Required: false},
+		"ssh_wait_timeout":                     &hcldec.AttrSpec{Name: "ssh_wait_timeout", Type: cty.String, Required: false},
+		"ssh_agent_auth":                       &hcldec.AttrSpec{Name: "ssh_agent_auth", Type: cty.Bool, Required: false},
+		"ssh_disable_agent_forwarding":         &hcldec.AttrSpec{Name: "ssh_disable_agent_forwarding", Type: cty.Bool, Required: false},
+		"ssh_handshake_attempts":               &hcldec.AttrSpec{Name: "ssh_handshake_attempts", Type: cty.Number, Required: false},
+		"ssh_bastion_host":                     &hcldec.AttrSpec{Name: "ssh_bastion_host", Type: cty.String, Required: false},
+		"ssh_bastion_port":                     &hcldec.AttrSpec{Name: "ssh_bastion_port", Type: cty.Number, Required: false},
+		"ssh_bastion_agent_auth":               &hcldec.AttrSpec{Name: "ssh_bastion_agent_auth", Type: cty.Bool, Required: false},
+		"ssh_bastion_username":                 &hcldec.AttrSpec{Name: "ssh_bastion_username", Type: cty.String, Required: false},
+		"ssh_bastion_password":                 &hcldec.AttrSpec{Name: "ssh_bastion_password", Type: cty.String, Required: false},
+		"ssh_bastion_interactive":              &hcldec.AttrSpec{Name: "ssh_bastion_interactive", Type: cty.Bool, Required: false},
+		"ssh_bastion_private_key_file":         &hcldec.AttrSpec{Name: "ssh_bastion_private_key_file", Type: cty.String, Required: false},
+		"ssh_bastion_certificate_file":         &hcldec.AttrSpec{Name: "ssh_bastion_certificate_file", Type: cty.String, Required: false},
+		"ssh_file_transfer_method":             &hcldec.AttrSpec{Name: "ssh_file_transfer_method", Type: cty.String, Required: false},
+		"ssh_proxy_host":                       &hcldec.AttrSpec{Name: "ssh_proxy_host", Type: cty.String, Required: false},
+		"ssh_proxy_port":                       &hcldec.AttrSpec{Name: "ssh_proxy_port", Type: cty.Number, Required: false},
+		"ssh_proxy_username":                   &hcldec.AttrSpec{Name: "ssh_proxy_username", Type: cty.String, Required: false},
+		"ssh_proxy_password":                   &hcldec.AttrSpec{Name: "ssh_proxy_password", Type: cty.String, Required: false},
+		"ssh_keep_alive_interval":              &hcldec.AttrSpec{Name: "ssh_keep_alive_interval", Type: cty.String, Required: false},
+		"ssh_read_write_timeout":               &hcldec.AttrSpec{Name: "ssh_read_write_timeout", Type: cty.String, Required: false},
+		"ssh_remote_tunnels":                   &hcldec.AttrSpec{Name: "ssh_remote_tunnels", Type: cty.List(cty.String), Required: false},
+		"ssh_local_tunnels":                    &hcldec.AttrSpec{Name: "ssh_local_tunnels", Type: cty.List(cty.String), Required: false},
+		"ssh_public_key":                       &hcldec.AttrSpec{Name: "ssh_public_key", Type: cty.List(cty.Number), Required: false},
+		"ssh_private_key":                      &hcldec.AttrSpec{Name: "ssh_private_key", Type: cty.List(cty.Number), Required: false},
+		"winrm_username":                       &hcldec.AttrSpec{Name: "winrm_username", Type: cty.String, Required: false},
+		"winrm_password":                       &hcldec.AttrSpec{Name: "winrm_password", Type: cty.String, Required: false},
+		"winrm_host":                           &hcldec.AttrSpec{Name: "winrm_host", Type: cty.String, Required: false},
+		"winrm_no_proxy":                       &hcldec.AttrSpec{Name: "winrm_no_proxy", Type: cty.Bool, Required: false},
+		"winrm_port":                           &hcldec.AttrSpec{Name: "winrm_port", Type: cty.Number, Required: false},
+		"winrm_timeout":                        &hcldec.AttrSpec{Name: "winrm_timeout", Type: cty.String, Required: false},
+		"winrm_use_ssl":                        &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
+		"winrm_insecure":                       &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
+		"winrm_use_ntlm":                       &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
+		"boot_keygroup_interval":               &hcldec.AttrSpec{Name: "boot_keygroup_interval", Type: cty.String, Required: false},
+		"boot_wait":                            &hcldec.AttrSpec{Name: "boot_wait", Type: cty.String, Required: false},
+		"boot_command":                         &hcldec.AttrSpec{Name: "boot_command", Type: cty.List(cty.String), Required: false},
+		"host":                                 &hcldec.AttrSpec{Name: "host", Type: cty.String, Required: false},
+		"token":                                &hcldec.AttrSpec{Name: "token", Type: cty.String, Required: false},
+		"profile":                              &hcldec.AttrSpec{Name: "profile", Type: cty.String, Required: false},
+		"insecure_skip_verify":                 &hcldec.AttrSpec{Name: "insecure_skip_verify", Type: cty.Bool, Required: false},
+		"boot_disk_image_id":                   &hcldec.AttrSpec{Name: "boot_disk_image_id", Type: cty.String, Required: false},
+		"boot_disk_snapshot_id":                &hcldec.AttrSpec{Name: "boot_disk_snapshot_id", Type: cty.String, Required: false},
+		"boot_disk_source":                     &hcldec.AttrSpec{Name: "boot_disk_source", Type: cty.String, Required: false},
+		"project":                              &hcldec.AttrSpec{Name: "project", Type: cty.String, Required: false},
+		"boot_disk_size":                       &hcldec.AttrSpec{Name: "boot_disk_size", Type: cty.Number, Required: false},
+		"disk":                                 &hcldec.BlockListSpec{TypeName: "disk", Nested: hcldec.ObjectSpec((*instance.FlatDiskConfig)(nil).HCL2Spec())},
+		"ip_pool":                              &hcldec.AttrSpec{Name: "ip_pool", Type: cty.String, Required: false},
+		"ip_version":                           &hcldec.AttrSpec{Name: "ip_version", Type: cty.String, Required: false},
+		"floating_ip":                          &hcldec.AttrSpec{Name: "floating_ip", Type: cty.String, Required: false},
+		"create_floating_ip":                   &hcldec.AttrSpec{Name: "create_floating_ip", Type: cty.Bool, Required: false},
+		"vpc":                                  &hcldec.AttrSpec{Name: "vpc", Type: cty.String, Required: false},
+		"subnet":                               &hcldec.AttrSpec{Name: "subnet", Type: cty.String, Required: false},
+		"temporary_network":                    &hcldec.AttrSpec{Name: "temporary_network", Type: cty.Bool, Required: false},
+		"temporary_network_ipv4_block":         &hcldec.AttrSpec{Name: "temporary_network_ipv4_block", Type: cty.String, Required: false},
+		"ssh_interface":                        &hcldec.AttrSpec{Name: "ssh_interface", Type: cty.String, Required: false},
+		"associate_external_ip":                &hcldec.AttrSpec{Name: "associate_external_ip", Type: cty.Bool, Required: false},
+		"temporary_firewall_rule":              &hcldec.AttrSpec{Name: "temporary_firewall_rule", Type: cty.Bool, Required: false},
+		"temporary_firewall_rule_source_cidrs": &hcldec.AttrSpec{Name: "temporary_firewall_rule_source_cidrs", Type: cty.List(cty.String), Required: false},
+		"name":                                 &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"hostname":                             &hcldec.AttrSpec{Name: "hostname", Type: cty.String, Required: false},
+		"cpus":                                 &hcldec.AttrSpec{Name: "cpus", Type: cty.Number, Required: false},
+		"memory":                               &hcldec.AttrSpec{Name: "memory", Type: cty.Number, Required: false},
+		"ssh_public_keys":                      &hcldec.AttrSpec{Name: "ssh_public_keys", Type: cty.List(cty.String), Required: false},
+		"artifact_name":                        &hcldec.AttrSpec{Name: "artifact_name", Type: cty.String, Required: false},
+		"artifact_description":                 &hcldec.AttrSpec{Name: "artifact_description", Type: cty.String, Required: false},
+		"artifact_os":                          &hcldec.AttrSpec{Name: "artifact_os", Type: cty.String, Required: false},
+		"artifact_version":                     &hcldec.AttrSpec{Name: "artifact_version", Type: cty.String, Required: false},
+		"skip_create_image":                    &hcldec.AttrSpec{Name: "skip_create_image", Type: cty.Bool, Required: false},
+		"promote_to_silo":                      &hcldec.AttrSpec{Name: "promote_to_silo", Type: cty.Bool, Required: false},
+		"user_data":                            &hcldec.AttrSpec{Name: "user_data", Type: cty.String, Required: false},
+		"wait_for_serial_pattern":              &hcldec.AttrSpec{Name: "wait_for_serial_pattern", Type: cty.String, Required: false},
+		"wait_for_serial_pattern_timeout":      &hcldec.AttrSpec{Name: "wait_for_serial_pattern_timeout", Type: cty.String, Required: false},
+		"instance_start_timeout":               &hcldec.AttrSpec{Name: "instance_start_timeout", Type: cty.String, Required: false},
+		"instance_stop_timeout":                &hcldec.AttrSpec{Name: "instance_stop_timeout", Type: cty.String, Required: false},
+		"cleanup_timeout":                      &hcldec.AttrSpec{Name: "cleanup_timeout", Type: cty.String, Required: false},
+		"poll_interval":                        &hcldec.AttrSpec{Name: "poll_interval", Type: cty.String, Required: false},
+		"serial_console_log":                   &hcldec.AttrSpec{Name: "serial_console_log", Type: cty.String, Required: false},
+		"serial_username":                      &hcldec.AttrSpec{Name: "serial_username", Type: cty.String, Required: false},
+		"serial_password":                      &hcldec.AttrSpec{Name: "serial_password", Type: cty.String, Required: false},
+		"serial_login_timeout":                 &hcldec.AttrSpec{Name: "serial_login_timeout", Type: cty.String, Required: false},
+		"serial_login_prompt":                  &hcldec.AttrSpec{Name: "serial_login_prompt", Type: cty.String, Required: false},
+		"serial_password_prompt":               &hcldec.AttrSpec{Name: "serial_password_prompt", Type: cty.String, Required: false},
+		"serial_shell_prompt":                  &hcldec.AttrSpec{Name: "serial_shell_prompt", Type: cty.String, Required: false},
+		"iso_checksum":                         &hcldec.AttrSpec{Name: "iso_checksum", Type: cty.String, Required: false},
+		"iso_url":                              &hcldec.AttrSpec{Name: "iso_url", Type: cty.String, Required: false},
+		"iso_urls":                             &hcldec.AttrSpec{Name: "iso_urls", Type: cty.List(cty.String), Required: false},
+		"iso_target_path":                      &hcldec.AttrSpec{Name: "iso_target_path", Type: cty.String, Required: false},
+		"iso_target_extension":                 &hcldec.AttrSpec{Name: "iso_target_extension", Type: cty.String, Required: false},
+		"http_directory":                       &hcldec.AttrSpec{Name: "http_directory", Type: cty.String, Required: false},
+		"http_content":                         &hcldec.AttrSpec{Name: "http_content", Type: cty.Map(cty.String), Required: false},
+		"http_port_min":                        &hcldec.AttrSpec{Name: "http_port_min", Type: cty.Number, Required: false},
+		"http_port_max":                        &hcldec.AttrSpec{Name: "http_port_max", Type: cty.Number, Required: false},
+		"http_bind_address":                    &hcldec.AttrSpec{Name: "http_bind_address", Type: cty.String, Required: false},
+		"http_interface":                       &hcldec.AttrSpec{Name: "http_interface", Type: cty.String, Required: false},
+		"http_network_protocol":                &hcldec.AttrSpec{Name: "http_network_protocol", Type: cty.String, Required: false},
+		"iso_block_size":                       &hcldec.AttrSpec{Name: "iso_block_size", Type: cty.Number, Required: false},
+		"http_ip":                              &hcldec.AttrSpec{Name: "http_ip", Type: cty.String, Required: false},
+	}
+	return s
+}
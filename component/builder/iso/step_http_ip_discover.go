@@ -0,0 +1,59 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package iso
+
+import (
+	"context"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/localaddr"
+)
+
+var _ multistep.Step = (*stepHTTPIPDiscover)(nil)
+
+// stepHTTPIPDiscover is a Packer plugin step to find the address the instance
+// reaches the HTTP server at.
+type stepHTTPIPDiscover struct {
+	config *Config
+}
+
+// Run stores the address of the HTTP server in stateBag, if it's running.
+func (s *stepHTTPIPDiscover) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+
+	if port, ok := stateBag.GetOk("http_port"); !ok || port.(int) == 0 {
+		return multistep.ActionContinue
+	}
+
+	httpIP := s.config.HTTPIP
+	if httpIP == "" && s.config.HTTPAddress != "0.0.0.0" {
+		httpIP = s.config.HTTPAddress
+	}
+
+	if httpIP == "" {
+		addr, err := localaddr.Lookup(ctx, oxideClient.Host())
+		if err != nil {
+			ui.Error("Failed finding the address of the HTTP server. Please set http_ip.")
+			stateBag.Put("error", err)
+			return multistep.ActionHalt
+		}
+		httpIP = addr.String()
+	}
+
+	ui.Sayf("Using HTTP server address: %s", httpIP)
+
+	stateBag.Put("http_ip", httpIP)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the resources created by [stepHTTPIPDiscover.Run].
+func (s *stepHTTPIPDiscover) Cleanup(multistep.StateBag) {}
@@ -0,0 +1,164 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package iso
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/diskimport"
+)
+
+var _ multistep.Step = (*stepISOImport)(nil)
+
+// stepISOImport is a Packer plugin step to upload an ISO into a temporary Oxide
+// image that the instance's ISO disk is created from.
+type stepISOImport struct {
+	config *Config
+}
+
+// Run imports the downloaded ISO into a disk, finalizes the disk into a
+// snapshot, creates an image from the snapshot, and stores the IDs of the
+// resources in stateBag.
+func (s *stepISOImport) Run(
+	ctx context.Context,
+	stateBag multistep.StateBag,
+) multistep.StepAction {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+	isoPath := stateBag.Get("iso_path").(string)
+
+	f, err := os.Open(isoPath)
+	if err != nil {
+		ui.Error("Failed opening ISO.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		ui.Error("Failed opening ISO.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Uploading ISO to Oxide")
+
+	r := ui.TrackProgress(filepath.Base(isoPath), 0, info.Size(), f)
+	defer r.Close()
+
+	diskID, snapshot, err := diskimport.Import(ctx, oxideClient, diskimport.Params{
+		Project:     s.config.Project,
+		Name:        s.config.Name + "-iso-import",
+		Description: "Created by Packer.",
+		BlockSize:   s.config.ISOBlockSize,
+		Size:        info.Size(),
+	}, r)
+	if diskID != "" {
+		stateBag.Put("iso_import_disk_id", diskID)
+	}
+	if snapshot != nil {
+		stateBag.Put("iso_snapshot_id", snapshot.Id)
+	}
+	if err != nil {
+		ui.Error("Failed uploading ISO to Oxide.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Creating temporary Oxide image of ISO")
+
+	image, err := oxideClient.ImageCreate(ctx, oxide.ImageCreateParams{
+		Project: oxide.NameOrId(s.config.Project),
+		Body: &oxide.ImageCreate{
+			Name:        oxide.Name(s.config.Name + "-iso"),
+			Description: "Created by Packer.",
+			Os:          "iso",
+			Source: oxide.ImageSource{
+				Value: &oxide.ImageSourceSnapshot{
+					Id: snapshot.Id,
+				},
+			},
+			Version: s.config.ArtifactVersion,
+		},
+	})
+	if err != nil {
+		ui.Error("Failed creating temporary Oxide image of ISO.")
+		stateBag.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Sayf("Created temporary Oxide image of ISO: %s", image.Id)
+
+	stateBag.Put("iso_image_id", image.Id)
+	stateBag.Put("iso_disk_size", uint64(image.Size))
+
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the resources created by [stepISOImport.Run].
+func (s *stepISOImport) Cleanup(stateBag multistep.StateBag) {
+	oxideClient := stateBag.Get("client").(*oxide.Client)
+	ui := stateBag.Get("ui").(packer.Ui)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.config.CleanupTimeout)
+	defer cancel()
+
+	if imageIDRaw, ok := stateBag.GetOk("iso_image_id"); ok {
+		imageID := imageIDRaw.(string)
+
+		ui.Sayf("Deleting temporary Oxide image of ISO: %s", imageID)
+
+		if err := oxideClient.ImageDelete(ctx, oxide.ImageDeleteParams{
+			Image: oxide.NameOrId(imageID),
+		}); err != nil {
+			ui.Errorf(
+				"Failed deleting temporary Oxide image %s during cleanup. "+
+					"Please delete it manually: %v",
+				imageID,
+				err,
+			)
+		}
+	}
+
+	if snapshotIDRaw, ok := stateBag.GetOk("iso_snapshot_id"); ok {
+		snapshotID := snapshotIDRaw.(string)
+
+		ui.Sayf("Deleting temporary Oxide snapshot of ISO: %s", snapshotID)
+
+		if err := oxideClient.SnapshotDelete(ctx, oxide.SnapshotDeleteParams{
+			Snapshot: oxide.NameOrId(snapshotID),
+		}); err != nil {
+			ui.Errorf(
+				"Failed deleting temporary Oxide snapshot %s during cleanup. "+
+					"Please delete it manually: %v",
+				snapshotID,
+				err,
+			)
+		}
+	}
+
+	if diskIDRaw, ok := stateBag.GetOk("iso_import_disk_id"); ok {
+		diskID := diskIDRaw.(string)
+
+		ui.Sayf("Deleting temporary Oxide disk of ISO: %s", diskID)
+
+		if err := oxideClient.DiskDelete(ctx, oxide.DiskDeleteParams{
+			Disk: oxide.NameOrId(diskID),
+		}); err != nil {
+			ui.Errorf(
+				"Failed deleting temporary Oxide disk %s during cleanup. "+
+					"Please delete it manually: %v",
+				diskID,
+				err,
+			)
+		}
+	}
+}
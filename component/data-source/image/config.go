@@ -27,10 +27,35 @@ type Config struct {
 	// Defaults to `false`.
 	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify" required:"false"`
 
-	// Name of the image to fetch.
-	Name string `mapstructure:"name" required:"true"`
+	// Name of the image to fetch. At least one of `name`, `name_regex`, `os`,
+	// or `version` must be set, and the fetched image must match all that are
+	// set.
+	Name string `mapstructure:"name"`
 
 	// Name or ID of the project containing the image to fetch. Leave blank to fetch
 	// a silo image instead of a project image.
 	Project string `mapstructure:"project"`
+
+	// Fetch the image whose name matches this regular expression (e.g.,
+	// `^ubuntu-noble-nightly-[0-9]{8}$`).
+	NameRegex string `mapstructure:"name_regex"`
+
+	// Fetch the image with this operating system (e.g., `ubuntu`). Compared
+	// case-insensitively.
+	OS string `mapstructure:"os"`
+
+	// Fetch the image whose version satisfies this version constraint (e.g.,
+	// `>= 24.04, < 25`). A bare version such as `24.04` only matches that
+	// version. Images whose version isn't a valid version never match.
+	Version string `mapstructure:"version"`
+
+	// Fetch the most recently created image when more than one image matches.
+	// When `false`, the data source fails if more than one image matches,
+	// listing the matches. Defaults to `false`.
+	MostRecent bool `mapstructure:"most_recent"`
+
+	// Images to search. Set to `project` to search the images of `project`,
+	// `silo` to search silo images, or `both` to search both. Defaults to
+	// `project` when `project` is set and `silo` otherwise.
+	Scope string `mapstructure:"scope"`
 }
@@ -14,8 +14,13 @@ type FlatConfig struct {
 	Token              *string `mapstructure:"token" required:"false" cty:"token" hcl:"token"`
 	Profile            *string `mapstructure:"profile" required:"false" cty:"profile" hcl:"profile"`
 	InsecureSkipVerify *bool   `mapstructure:"insecure_skip_verify" required:"false" cty:"insecure_skip_verify" hcl:"insecure_skip_verify"`
-	Name               *string `mapstructure:"name" required:"true" cty:"name" hcl:"name"`
+	Name               *string `mapstructure:"name" cty:"name" hcl:"name"`
 	Project            *string `mapstructure:"project" cty:"project" hcl:"project"`
+	NameRegex          *string `mapstructure:"name_regex" cty:"name_regex" hcl:"name_regex"`
+	OS                 *string `mapstructure:"os" cty:"os" hcl:"os"`
+	Version            *string `mapstructure:"version" cty:"version" hcl:"version"`
+	MostRecent         *bool   `mapstructure:"most_recent" cty:"most_recent" hcl:"most_recent"`
+	Scope              *string `mapstructure:"scope" cty:"scope" hcl:"scope"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -36,6 +41,11 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"insecure_skip_verify": &hcldec.AttrSpec{Name: "insecure_skip_verify", Type: cty.Bool, Required: false},
 		"name":                 &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
 		"project":              &hcldec.AttrSpec{Name: "project", Type: cty.String, Required: false},
+		"name_regex":           &hcldec.AttrSpec{Name: "name_regex", Type: cty.String, Required: false},
+		"os":                   &hcldec.AttrSpec{Name: "os", Type: cty.String, Required: false},
+		"version":              &hcldec.AttrSpec{Name: "version", Type: cty.String, Required: false},
+		"most_recent":          &hcldec.AttrSpec{Name: "most_recent", Type: cty.Bool, Required: false},
+		"scope":                &hcldec.AttrSpec{Name: "scope", Type: cty.String, Required: false},
 	}
 	return s
 }
@@ -16,15 +16,19 @@ import (
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/imagefilter"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxideclient"
 	"github.com/zclconf/go-cty/cty"
 )
 
 var _ packer.Datasource = (*Datasource)(nil)
 
 // The `oxide-image` data source fetches [Oxide](https://oxide.computer) image information for use
-// in a Packer build. The image can be a project image or silo image.
+// in a Packer build. The image can be a project image or silo image, and can be fetched by name or
+// found by filtering images by name, operating system, and version.
 type Datasource struct {
 	config Config
+	filter imagefilter.Filter
 }
 
 // ConfigSpec returns the HCL specification that Packer uses to validate and
@@ -43,12 +47,28 @@ func (d *Datasource) Configure(args ...any) error {
 		return fmt.Errorf("failed decoding configuration: %w", err)
 	}
 
+	d.filter = imagefilter.Filter{
+		Name:      d.config.Name,
+		NameRegex: d.config.NameRegex,
+		OS:        d.config.OS,
+		Version:   d.config.Version,
+		Project:   d.config.Project,
+		Scope:     d.config.Scope,
+	}
+
 	// Enforce required configuration.
 	{
 		var multiErr *packer.MultiError
 
-		if d.config.Name == "" {
-			multiErr = packer.MultiErrorAppend(multiErr, errors.New("name is required"))
+		if d.filter.Empty() {
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				errors.New("at least one of name, name_regex, os, or version is required"),
+			)
+		}
+
+		for _, err := range d.filter.Prepare() {
+			multiErr = packer.MultiErrorAppend(multiErr, err)
 		}
 
 		if multiErr != nil && len(multiErr.Errors) > 0 {
@@ -62,46 +82,76 @@ func (d *Datasource) Configure(args ...any) error {
 // Execute fetches image information from the Oxide API and returns that
 // information in the format specified by [OutputSpec].
 func (d *Datasource) Execute() (cty.Value, error) {
-	opts := make([]oxide.ClientOption, 0)
-	if d.config.Host != "" {
-		opts = append(opts, oxide.WithHost(d.config.Host))
-	}
-	if d.config.Token != "" {
-		opts = append(opts, oxide.WithToken(d.config.Token))
-	}
-	if d.config.Profile != "" {
-		opts = append(opts, oxide.WithProfile(d.config.Profile))
-	}
-	if d.config.InsecureSkipVerify {
-		opts = append(opts, oxide.WithInsecureSkipVerify())
-	}
-	oxideClient, err := oxide.NewClient(opts...)
+	oxideClient, err := oxide.NewClient(oxideclient.Options(
+		d.config.Host,
+		d.config.Token,
+		d.config.Profile,
+		d.config.InsecureSkipVerify,
+	)...)
 	if err != nil {
 		return cty.NullVal(cty.EmptyObject), fmt.Errorf("failed creating oxide client: %w", err)
 	}
 
-	image, err := oxideClient.ImageView(context.TODO(), oxide.ImageViewParams{
-		Image: oxide.NameOrId(d.config.Name),
-		Project: oxide.NameOrId(
-			d.config.Project,
-		), // This relies on the Go SDK omitting empty strings from serialization to fetch silo images.
-	})
+	image, err := d.findImage(context.TODO(), oxideClient)
 	if err != nil {
-		return cty.NullVal(
-				cty.EmptyObject,
-			), fmt.Errorf(
+		return cty.NullVal(cty.EmptyObject), err
+	}
+
+	return hcl2helper.HCL2ValueFromConfig(
+		DatasourceOutput(imagefilter.NewDetails(*image)),
+		d.OutputSpec(),
+	), nil
+}
+
+// findImage returns the image matching the configuration. An image only
+// filtered by name is fetched directly, while other images are found by listing
+// the images in scope.
+func (d *Datasource) findImage(
+	ctx context.Context,
+	oxideClient *oxide.Client,
+) (*oxide.Image, error) {
+	if d.config.NameRegex == "" && d.config.OS == "" && d.config.Version == "" &&
+		d.filter.Scope != imagefilter.ScopeBoth {
+		project := d.config.Project
+		if d.filter.Scope == imagefilter.ScopeSilo {
+			project = ""
+		}
+
+		image, err := oxideClient.ImageView(ctx, oxide.ImageViewParams{
+			Image: oxide.NameOrId(d.config.Name),
+			// This relies on the Go SDK omitting empty strings from serialization
+			// to fetch silo images.
+			Project: oxide.NameOrId(project),
+		})
+		if err != nil {
+			return nil, fmt.Errorf(
 				"failed fetching image %q within project %q: %w",
 				d.config.Name,
-				d.config.Project,
+				project,
 				err,
 			)
+		}
+
+		return image, nil
+	}
+
+	matches, err := d.filter.List(ctx, oxideClient)
+	if err != nil {
+		return nil, err
 	}
 
-	output := DatasourceOutput{
-		ImageID: image.Id,
+	switch {
+	case len(matches) == 0:
+		return nil, errors.New("no image matches the filters")
+	case len(matches) > 1 && !d.config.MostRecent:
+		return nil, fmt.Errorf(
+			"%d images match the filters, narrow the filters or set most_recent: %s",
+			len(matches),
+			imagefilter.Describe(matches),
+		)
 	}
 
-	return hcl2helper.HCL2ValueFromConfig(output, d.OutputSpec()), nil
+	return &matches[0], nil
 }
 
 // OutputSpec returns the HCL specification that Packer uses to populate output
@@ -18,6 +18,9 @@ import (
 
 	"github.com/hashicorp/packer-plugin-sdk/acctest"
 	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/data-source/image"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxidetest"
+	"github.com/zclconf/go-cty/cty"
 )
 
 //go:embed testdata/*.pkr.hcl.tmpl
@@ -57,7 +60,11 @@ func TestAccDataSource_Config(t *testing.T) {
 					}
 				}
 
-				assertFileContains(t, logfile, "name is required")
+				assertFileContains(
+					t,
+					logfile,
+					"at least one of name, name_regex, os, or version is required",
+				)
 
 				return nil
 			},
@@ -77,7 +84,11 @@ func TestAccDataSource_Config(t *testing.T) {
 					}
 				}
 
-				assertFileContains(t, logfile, "name is required")
+				assertFileContains(
+					t,
+					logfile,
+					"at least one of name, name_regex, os, or version is required",
+				)
 
 				return nil
 			},
@@ -323,6 +334,232 @@ func TestAccDataSource_Image(t *testing.T) {
 	}
 }
 
+// createNightlyImages seeds server with nightly Ubuntu images in the `images`
+// project, created a day apart, along with a Debian image and a silo image. It
+// returns the images by name.
+func createNightlyImages(server *oxidetest.Server) map[string]oxide.Image {
+	images := make(map[string]oxide.Image)
+	for i, v := range []struct {
+		project string
+		name    string
+		os      string
+		version string
+	}{
+		{"images", "ubuntu-noble-20260101", "ubuntu", "24.04"},
+		{"images", "ubuntu-noble-20260102", "ubuntu", "24.04.1"},
+		{"images", "ubuntu-plucky-20260103", "ubuntu", "25.04"},
+		{"images", "debian-trixie-20260104", "debian", "13"},
+		{"", "ubuntu-noble-silo", "ubuntu", "24.04.2"},
+	} {
+		created := time.Date(2026, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		images[v.name] = server.CreateImage(v.project, oxide.Image{
+			Name:        oxide.Name(v.name),
+			Os:          v.os,
+			Version:     v.version,
+			TimeCreated: &created,
+		})
+	}
+
+	return images
+}
+
+// TestDatasource_Configure tests the validation of the data source
+// configuration.
+func TestDatasource_Configure(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config map[string]any
+		err    string
+	}{
+		"RequiresFilter": {
+			config: map[string]any{"project": "images"},
+			err:    "at least one of name, name_regex, os, or version is required",
+		},
+		"RejectsInvalidNameRegex": {
+			config: map[string]any{"name_regex": "ubuntu-("},
+			err:    "invalid name_regex",
+		},
+		"RejectsInvalidVersion": {
+			config: map[string]any{"version": ">= noble"},
+			err:    "invalid version constraint",
+		},
+		"RejectsInvalidScope": {
+			config: map[string]any{"name": "ubuntu", "scope": "rack"},
+			err:    `scope must be one of project, silo, or both, got "rack"`,
+		},
+		"RequiresProjectForScope": {
+			config: map[string]any{"name": "ubuntu", "scope": "both"},
+			err:    "project is required when scope is both",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var d image.Datasource
+			err := d.Configure(tc.config)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+// TestDatasource_Execute tests finding images against a fake Oxide API.
+func TestDatasource_Execute(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config   map[string]any
+		expected string
+	}{
+		"FetchesProjectImageByName": {
+			config:   map[string]any{"name": "ubuntu-noble-20260101", "project": "images"},
+			expected: "ubuntu-noble-20260101",
+		},
+		"FetchesSiloImageByName": {
+			config:   map[string]any{"name": "ubuntu-noble-silo"},
+			expected: "ubuntu-noble-silo",
+		},
+		"FiltersByNameRegex": {
+			config: map[string]any{
+				"name_regex": "^ubuntu-plucky-",
+				"project":    "images",
+			},
+			expected: "ubuntu-plucky-20260103",
+		},
+		"FiltersByOS": {
+			config:   map[string]any{"os": "Debian", "project": "images"},
+			expected: "debian-trixie-20260104",
+		},
+		"FiltersByVersionConstraint": {
+			config: map[string]any{
+				"os":          "ubuntu",
+				"version":     ">= 24.04, < 25",
+				"most_recent": true,
+				"project":     "images",
+			},
+			expected: "ubuntu-noble-20260102",
+		},
+		"SelectsMostRecent": {
+			config: map[string]any{
+				"name_regex":  "^ubuntu-",
+				"most_recent": true,
+				"project":     "images",
+			},
+			expected: "ubuntu-plucky-20260103",
+		},
+		"SearchesBothScopes": {
+			config: map[string]any{
+				"name_regex":  "^ubuntu-noble-",
+				"most_recent": true,
+				"project":     "images",
+				"scope":       "both",
+			},
+			expected: "ubuntu-noble-silo",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := oxidetest.NewServer(t)
+			images := createNightlyImages(server)
+			d := oxidetest.Configure[image.Datasource](t, server, nil, tc.config)
+
+			output, err := d.Execute()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, want := output.GetAttr("image_id").AsString(), images[tc.expected].Id
+			if got != want {
+				t.Errorf("expected image %s (%s), got %s", tc.expected, want, got)
+			}
+		})
+	}
+
+	t.Run("ReturnsImageDetails", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		modified := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+		expected := server.CreateImage("images", oxide.Image{
+			Name:         "ubuntu-noble",
+			Description:  "Ubuntu 24.04.",
+			Os:           "ubuntu",
+			Version:      "24.04",
+			Size:         21474836480,
+			BlockSize:    512,
+			Digest:       oxide.Digest{Value: &oxide.DigestSha256{Value: "2c26b46b"}},
+			TimeCreated:  &created,
+			TimeModified: &modified,
+		})
+		d := oxidetest.Configure[image.Datasource](t, server, nil, map[string]any{
+			"name":    "ubuntu-noble",
+			"project": "images",
+		})
+
+		output, err := d.Execute()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for attr, want := range map[string]cty.Value{
+			"image_id":      cty.StringVal(expected.Id),
+			"name":          cty.StringVal("ubuntu-noble"),
+			"description":   cty.StringVal("Ubuntu 24.04."),
+			"os":            cty.StringVal("ubuntu"),
+			"version":       cty.StringVal("24.04"),
+			"size":          cty.NumberUIntVal(21474836480),
+			"block_size":    cty.NumberIntVal(512),
+			"digest":        cty.StringVal("sha256:2c26b46b"),
+			"project_id":    cty.StringVal("images"),
+			"time_created":  cty.StringVal("2026-01-01T00:00:00Z"),
+			"time_modified": cty.StringVal("2026-01-02T00:00:00Z"),
+		} {
+			if got := output.GetAttr(attr); !got.RawEquals(want) {
+				t.Errorf("expected %s to be %#v, got %#v", attr, want, got)
+			}
+		}
+	})
+
+	t.Run("ListsCandidates", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		createNightlyImages(server)
+		d := oxidetest.Configure[image.Datasource](
+			t,
+			server,
+			nil,
+			map[string]any{"os": "ubuntu", "project": "images"},
+		)
+
+		_, err := d.Execute()
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		for _, s := range []string{
+			"3 images match the filters",
+			"ubuntu-plucky-20260103",
+			"ubuntu-noble-20260102",
+			"ubuntu-noble-20260101",
+		} {
+			if !strings.Contains(err.Error(), s) {
+				t.Errorf("expected error containing %q, got %v", s, err)
+			}
+		}
+	})
+
+	t.Run("RequiresMatch", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		createNightlyImages(server)
+		d := oxidetest.Configure[image.Datasource](
+			t,
+			server,
+			nil,
+			map[string]any{"os": "fedora", "project": "images"},
+		)
+
+		if _, err := d.Execute(); err == nil ||
+			!strings.Contains(err.Error(), "no image matches the filters") {
+			t.Errorf("expected no match error, got %v", err)
+		}
+	})
+}
+
 func assertFileContains(t *testing.T, filename string, expected string) {
 	b, err := os.ReadFile(filename)
 	if err != nil {
@@ -11,4 +11,36 @@ package image
 type DatasourceOutput struct {
 	// ID of the image that was fetched.
 	ImageID string `mapstructure:"image_id"`
+
+	// Name of the image.
+	Name string `mapstructure:"name"`
+
+	// Description of the image.
+	Description string `mapstructure:"description"`
+
+	// Operating system of the image (e.g., `ubuntu`).
+	OS string `mapstructure:"os"`
+
+	// Version of the image (e.g., `24.04`).
+	Version string `mapstructure:"version"`
+
+	// Size of the image in bytes, which is the minimum size of a disk created
+	// from it.
+	Size uint64 `mapstructure:"size"`
+
+	// Block size of the image in bytes.
+	BlockSize int `mapstructure:"block_size"`
+
+	// Digest of the image's contents, prefixed with the digest algorithm
+	// (e.g., `sha256:2c26b46b...`). Empty when Oxide hasn't computed one.
+	Digest string `mapstructure:"digest"`
+
+	// ID of the project the image belongs to. Empty for silo images.
+	ProjectID string `mapstructure:"project_id"`
+
+	// Time the image was created, in RFC 3339 format.
+	TimeCreated string `mapstructure:"time_created"`
+
+	// Time the image was last modified, in RFC 3339 format.
+	TimeModified string `mapstructure:"time_modified"`
 }
@@ -0,0 +1,51 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc struct-markdown
+
+package images
+
+// The configuration arguments for the data source. Arguments can either be required or optional.
+type Config struct {
+	// Oxide API URL (e.g., `https://oxide.sys.example.com`). If not specified,
+	// this defaults to the value of the `OXIDE_HOST` environment variable. When
+	// specified, `token` must be specified. Conflicts with `profile`.
+	Host string `mapstructure:"host" required:"false"`
+
+	// Oxide API token. If not specified, this defaults to the value of the
+	// `OXIDE_TOKEN` environment variable. When specified, `host` must be specified.
+	// Conflicts with `profile`.
+	Token string `mapstructure:"token" required:"false"`
+
+	// Oxide credentials profile. If not specified, this defaults to the value of
+	// the `OXIDE_PROFILE` environment variable. Conflicts with `host` and `token`.
+	Profile string `mapstructure:"profile" required:"false"`
+
+	// Skip TLS certificate verification when connecting to the Oxide API.
+	// Defaults to `false`.
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify" required:"false"`
+
+	// Name or ID of the project containing the images to fetch. Leave blank to
+	// fetch silo images instead of project images.
+	Project string `mapstructure:"project"`
+
+	// Fetch the images whose name matches this regular expression (e.g.,
+	// `^base-`).
+	NameRegex string `mapstructure:"name_regex"`
+
+	// Fetch the images with this operating system (e.g., `ubuntu`). Compared
+	// case-insensitively.
+	OS string `mapstructure:"os"`
+
+	// Fetch the images whose version satisfies this version constraint (e.g.,
+	// `>= 24.04, < 25`). A bare version such as `24.04` only matches that
+	// version. Images whose version isn't a valid version never match.
+	Version string `mapstructure:"version"`
+
+	// Images to search. Set to `project` to search the images of `project`,
+	// `silo` to search silo images, or `both` to search both. Defaults to
+	// `project` when `project` is set and `silo` otherwise.
+	Scope string `mapstructure:"scope"`
+}
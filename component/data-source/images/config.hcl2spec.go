@@ -0,0 +1,47 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package images
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatConfig struct {
+	Host               *string `mapstructure:"host" required:"false" cty:"host" hcl:"host"`
+	Token              *string `mapstructure:"token" required:"false" cty:"token" hcl:"token"`
+	Profile            *string `mapstructure:"profile" required:"false" cty:"profile" hcl:"profile"`
+	InsecureSkipVerify *bool   `mapstructure:"insecure_skip_verify" required:"false" cty:"insecure_skip_verify" hcl:"insecure_skip_verify"`
+	Project            *string `mapstructure:"project" cty:"project" hcl:"project"`
+	NameRegex          *string `mapstructure:"name_regex" cty:"name_regex" hcl:"name_regex"`
+	OS                 *string `mapstructure:"os" cty:"os" hcl:"os"`
+	Version            *string `mapstructure:"version" cty:"version" hcl:"version"`
+	Scope              *string `mapstructure:"scope" cty:"scope" hcl:"scope"`
+}
+
+// FlatMapstructure returns a new FlatConfig.
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatConfig)
+}
+
+// HCL2Spec returns the hcl spec of a Config.
+// This spec is used by HCL to read the fields of Config.
+// The decoded values from this spec will then be applied to a FlatConfig.
+func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"host":                 &hcldec.AttrSpec{Name: "host", Type: cty.String, Required: false},
+		"token":                &hcldec.AttrSpec{Name: "token", Type: cty.String, Required: false},
+		"profile":              &hcldec.AttrSpec{Name: "profile", Type: cty.String, Required: false},
+		"insecure_skip_verify": &hcldec.AttrSpec{Name: "insecure_skip_verify", Type: cty.Bool, Required: false},
+		"project":              &hcldec.AttrSpec{Name: "project", Type: cty.String, Required: false},
+		"name_regex":           &hcldec.AttrSpec{Name: "name_regex", Type: cty.String, Required: false},
+		"os":                   &hcldec.AttrSpec{Name: "os", Type: cty.String, Required: false},
+		"version":              &hcldec.AttrSpec{Name: "version", Type: cty.String, Required: false},
+		"scope":                &hcldec.AttrSpec{Name: "scope", Type: cty.String, Required: false},
+	}
+	return s
+}
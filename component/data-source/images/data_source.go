@@ -0,0 +1,108 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc struct-markdown
+
+package images
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/hcl2helper"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/imagefilter"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxideclient"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var _ packer.Datasource = (*Datasource)(nil)
+
+// The `oxide-images` data source fetches information about every [Oxide](https://oxide.computer)
+// image matching filters on name, operating system, and version, for use in a Packer build. The
+// images can be project images, silo images, or both. Use it with `dynamic "source"` blocks to
+// build one image from each matching image.
+type Datasource struct {
+	config Config
+	filter imagefilter.Filter
+}
+
+// ConfigSpec returns the HCL specification that Packer uses to validate and
+// configure this plugin component.
+func (d *Datasource) ConfigSpec() hcldec.ObjectSpec {
+	return d.config.FlatMapstructure().HCL2Spec()
+}
+
+// Configure decodes the configuration for this plugin component, checks whether
+// the configuration is valid, and stores any necessary state for future methods
+// to use during execution.
+func (d *Datasource) Configure(args ...any) error {
+	if err := config.Decode(&d.config, &config.DecodeOpts{
+		Interpolate: false,
+	}, args...); err != nil {
+		return fmt.Errorf("failed decoding configuration: %w", err)
+	}
+
+	d.filter = imagefilter.Filter{
+		NameRegex: d.config.NameRegex,
+		OS:        d.config.OS,
+		Version:   d.config.Version,
+		Project:   d.config.Project,
+		Scope:     d.config.Scope,
+	}
+
+	// Enforce required configuration.
+	{
+		var multiErr *packer.MultiError
+
+		for _, err := range d.filter.Prepare() {
+			multiErr = packer.MultiErrorAppend(multiErr, err)
+		}
+
+		if multiErr != nil && len(multiErr.Errors) > 0 {
+			return multiErr
+		}
+	}
+
+	return nil
+}
+
+// Execute fetches the matching images from the Oxide API and returns their
+// information in the format specified by [OutputSpec].
+func (d *Datasource) Execute() (cty.Value, error) {
+	oxideClient, err := oxide.NewClient(oxideclient.Options(
+		d.config.Host,
+		d.config.Token,
+		d.config.Profile,
+		d.config.InsecureSkipVerify,
+	)...)
+	if err != nil {
+		return cty.NullVal(cty.EmptyObject), fmt.Errorf("failed creating oxide client: %w", err)
+	}
+
+	images, err := d.filter.List(context.TODO(), oxideClient)
+	if err != nil {
+		return cty.NullVal(cty.EmptyObject), err
+	}
+
+	output := DatasourceOutput{
+		Images:   make([]Image, 0, len(images)),
+		ImageIDs: make([]string, 0, len(images)),
+	}
+	for _, image := range images {
+		output.Images = append(output.Images, Image(imagefilter.NewDetails(image)))
+		output.ImageIDs = append(output.ImageIDs, image.Id)
+	}
+
+	return hcl2helper.HCL2ValueFromConfig(output, d.OutputSpec()), nil
+}
+
+// OutputSpec returns the HCL specification that Packer uses to populate output
+// values for this plugin component.
+func (d *Datasource) OutputSpec() hcldec.ObjectSpec {
+	return (&DatasourceOutput{}).FlatMapstructure().HCL2Spec()
+}
@@ -0,0 +1,192 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package images_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/data-source/images"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxidetest"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// createBaseImages seeds server with base images of several operating systems
+// in the `images` project, created a day apart, along with a silo image.
+func createBaseImages(server *oxidetest.Server) {
+	for i, v := range []struct {
+		project string
+		name    string
+		os      string
+		version string
+	}{
+		{"images", "base-ubuntu-noble", "ubuntu", "24.04"},
+		{"images", "base-debian-trixie", "debian", "13"},
+		{"images", "base-alpine", "alpine", "3.22"},
+		{"images", "scratch", "ubuntu", "24.04"},
+		{"", "base-ubuntu-plucky", "ubuntu", "25.04"},
+	} {
+		created := time.Date(2026, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		server.CreateImage(v.project, oxide.Image{
+			Name:        oxide.Name(v.name),
+			Os:          v.os,
+			Version:     v.version,
+			Size:        1024 * 1024 * 1024,
+			TimeCreated: &created,
+		})
+	}
+}
+
+// imageNames returns the names of the images in output, in order.
+func imageNames(t *testing.T, output cty.Value) []string {
+	t.Helper()
+
+	var names []string
+	for _, image := range output.GetAttr("images").AsValueSlice() {
+		names = append(names, image.GetAttr("name").AsString())
+	}
+
+	return names
+}
+
+// TestDatasource_Configure tests the validation of the data source
+// configuration.
+func TestDatasource_Configure(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config map[string]any
+		err    string
+	}{
+		"RejectsInvalidNameRegex": {
+			config: map[string]any{"name_regex": "base-("},
+			err:    "invalid name_regex",
+		},
+		"RejectsInvalidVersion": {
+			config: map[string]any{"version": ">= noble"},
+			err:    "invalid version constraint",
+		},
+		"RequiresProjectForScope": {
+			config: map[string]any{"scope": "project"},
+			err:    "project is required when scope is project",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var d images.Datasource
+			err := d.Configure(tc.config)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+// TestDatasource_Execute tests listing images against a fake Oxide API.
+func TestDatasource_Execute(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config   map[string]any
+		expected []string
+	}{
+		"ListsProjectImages": {
+			config: map[string]any{"project": "images"},
+			expected: []string{
+				"scratch",
+				"base-alpine",
+				"base-debian-trixie",
+				"base-ubuntu-noble",
+			},
+		},
+		"ListsSiloImages": {
+			expected: []string{"base-ubuntu-plucky"},
+		},
+		"FiltersByNameRegex": {
+			config: map[string]any{"name_regex": "^base-", "project": "images"},
+			expected: []string{
+				"base-alpine",
+				"base-debian-trixie",
+				"base-ubuntu-noble",
+			},
+		},
+		"FiltersByOSAndVersion": {
+			config: map[string]any{
+				"os":      "ubuntu",
+				"version": ">= 24.04",
+				"project": "images",
+				"scope":   "both",
+			},
+			expected: []string{"base-ubuntu-plucky", "scratch", "base-ubuntu-noble"},
+		},
+		"ReturnsNoImages": {
+			config:   map[string]any{"os": "fedora", "project": "images"},
+			expected: nil,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := oxidetest.NewServer(t)
+			createBaseImages(server)
+			d := oxidetest.Configure[images.Datasource](t, server, nil, tc.config)
+
+			output, err := d.Execute()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := imageNames(t, output); !slices.Equal(got, tc.expected) {
+				t.Errorf("expected images %v, got %v", tc.expected, got)
+			}
+
+			if n := output.GetAttr("image_ids").LengthInt(); n != len(tc.expected) {
+				t.Errorf("expected %d image IDs, got %d", len(tc.expected), n)
+			}
+		})
+	}
+
+	t.Run("ReturnsImageDetails", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		expected := server.CreateImage("images", oxide.Image{
+			Name:        "base-ubuntu-noble",
+			Os:          "ubuntu",
+			Version:     "24.04",
+			Size:        21474836480,
+			TimeCreated: &created,
+		})
+		d := oxidetest.Configure[images.Datasource](
+			t,
+			server,
+			nil,
+			map[string]any{"project": "images"},
+		)
+
+		output, err := d.Execute()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		image := output.GetAttr("images").Index(cty.NumberIntVal(0))
+		for attr, want := range map[string]cty.Value{
+			"image_id":     cty.StringVal(expected.Id),
+			"name":         cty.StringVal("base-ubuntu-noble"),
+			"os":           cty.StringVal("ubuntu"),
+			"version":      cty.StringVal("24.04"),
+			"size":         cty.NumberUIntVal(21474836480),
+			"project_id":   cty.StringVal("images"),
+			"time_created": cty.StringVal("2026-01-01T00:00:00Z"),
+		} {
+			if got := image.GetAttr(attr); !got.RawEquals(want) {
+				t.Errorf("expected %s to be %#v, got %#v", attr, want, got)
+			}
+		}
+
+		ids := output.GetAttr("image_ids")
+		if got := ids.Index(cty.NumberIntVal(0)); !got.RawEquals(cty.StringVal(expected.Id)) {
+			t.Errorf("expected image_ids to be [%s], got %#v", expected.Id, ids)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type DatasourceOutput,Image
+//go:generate packer-sdc struct-markdown
+
+package images
+
+// The outputs returned by this data source component.
+type DatasourceOutput struct {
+	// Images that were fetched, most recently created first. Empty when no
+	// image matches. See [Image Outputs](#image-outputs).
+	Images []Image `mapstructure:"images"`
+
+	// IDs of the images that were fetched, in the same order as `images`.
+	ImageIDs []string `mapstructure:"image_ids"`
+}
+
+// Image is an image fetched by the data source. Its attributes are the same as
+// the outputs of the `oxide-image` data source.
+type Image struct {
+	// ID of the image.
+	ImageID string `mapstructure:"image_id"`
+
+	// Name of the image.
+	Name string `mapstructure:"name"`
+
+	// Description of the image.
+	Description string `mapstructure:"description"`
+
+	// Operating system of the image (e.g., `ubuntu`).
+	OS string `mapstructure:"os"`
+
+	// Version of the image (e.g., `24.04`).
+	Version string `mapstructure:"version"`
+
+	// Size of the image in bytes, which is the minimum size of a disk created
+	// from it.
+	Size uint64 `mapstructure:"size"`
+
+	// Block size of the image in bytes.
+	BlockSize int `mapstructure:"block_size"`
+
+	// Digest of the image's contents, prefixed with the digest algorithm
+	// (e.g., `sha256:2c26b46b...`). Empty when Oxide hasn't computed one.
+	Digest string `mapstructure:"digest"`
+
+	// ID of the project the image belongs to. Empty for silo images.
+	ProjectID string `mapstructure:"project_id"`
+
+	// Time the image was created, in RFC 3339 format.
+	TimeCreated string `mapstructure:"time_created"`
+
+	// Time the image was last modified, in RFC 3339 format.
+	TimeModified string `mapstructure:"time_modified"`
+}
@@ -0,0 +1,76 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package images
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatDatasourceOutput is an auto-generated flat version of DatasourceOutput.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatDatasourceOutput struct {
+	Images   []FlatImage `mapstructure:"images" cty:"images" hcl:"images"`
+	ImageIDs []string    `mapstructure:"image_ids" cty:"image_ids" hcl:"image_ids"`
+}
+
+// FlatMapstructure returns a new FlatDatasourceOutput.
+// FlatDatasourceOutput is an auto-generated flat version of DatasourceOutput.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*DatasourceOutput) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatDatasourceOutput)
+}
+
+// HCL2Spec returns the hcl spec of a DatasourceOutput.
+// This spec is used by HCL to read the fields of DatasourceOutput.
+// The decoded values from this spec will then be applied to a FlatDatasourceOutput.
+func (*FlatDatasourceOutput) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"images":    &hcldec.BlockListSpec{TypeName: "images", Nested: hcldec.ObjectSpec((*FlatImage)(nil).HCL2Spec())},
+		"image_ids": &hcldec.AttrSpec{Name: "image_ids", Type: cty.List(cty.String), Required: false},
+	}
+	return s
+}
+
+// FlatImage is an auto-generated flat version of Image.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatImage struct {
+	ImageID      *string `mapstructure:"image_id" cty:"image_id" hcl:"image_id"`
+	Name         *string `mapstructure:"name" cty:"name" hcl:"name"`
+	Description  *string `mapstructure:"description" cty:"description" hcl:"description"`
+	OS           *string `mapstructure:"os" cty:"os" hcl:"os"`
+	Version      *string `mapstructure:"version" cty:"version" hcl:"version"`
+	Size         *uint64 `mapstructure:"size" cty:"size" hcl:"size"`
+	BlockSize    *int    `mapstructure:"block_size" cty:"block_size" hcl:"block_size"`
+	Digest       *string `mapstructure:"digest" cty:"digest" hcl:"digest"`
+	ProjectID    *string `mapstructure:"project_id" cty:"project_id" hcl:"project_id"`
+	TimeCreated  *string `mapstructure:"time_created" cty:"time_created" hcl:"time_created"`
+	TimeModified *string `mapstructure:"time_modified" cty:"time_modified" hcl:"time_modified"`
+}
+
+// FlatMapstructure returns a new FlatImage.
+// FlatImage is an auto-generated flat version of Image.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Image) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatImage)
+}
+
+// HCL2Spec returns the hcl spec of a Image.
+// This spec is used by HCL to read the fields of Image.
+// The decoded values from this spec will then be applied to a FlatImage.
+func (*FlatImage) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"image_id":      &hcldec.AttrSpec{Name: "image_id", Type: cty.String, Required: false},
+		"name":          &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"description":   &hcldec.AttrSpec{Name: "description", Type: cty.String, Required: false},
+		"os":            &hcldec.AttrSpec{Name: "os", Type: cty.String, Required: false},
+		"version":       &hcldec.AttrSpec{Name: "version", Type: cty.String, Required: false},
+		"size":          &hcldec.AttrSpec{Name: "size", Type: cty.Number, Required: false},
+		"block_size":    &hcldec.AttrSpec{Name: "block_size", Type: cty.Number, Required: false},
+		"digest":        &hcldec.AttrSpec{Name: "digest", Type: cty.String, Required: false},
+		"project_id":    &hcldec.AttrSpec{Name: "project_id", Type: cty.String, Required: false},
+		"time_created":  &hcldec.AttrSpec{Name: "time_created", Type: cty.String, Required: false},
+		"time_modified": &hcldec.AttrSpec{Name: "time_modified", Type: cty.String, Required: false},
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package imagecopy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+var _ packer.Artifact = (*Artifact)(nil)
+
+// Artifact represents the input artifact of the post-processor along with the
+// results of copying its image to each target. Everything but its description
+// and the `image_copies` state is that of the input artifact.
+type Artifact struct {
+	packer.Artifact
+
+	// Results of copying the image, in the order the targets are configured.
+	Copies []ImageCopy
+}
+
+// ImageCopy is the result of copying the image to a target project.
+type ImageCopy struct {
+	// Name or ID of the project the image was copied to.
+	Project string
+	// Unique identifier of the copied image, empty when copying failed.
+	ImageID string
+	// Name of the copied image, empty when copying failed.
+	ImageName string
+	// Error copying the image, empty when copying succeeded.
+	Error string
+}
+
+// String returns a description of the artifact.
+func (a *Artifact) String() string {
+	copies := []string{a.Artifact.String()}
+	for _, c := range a.Copies {
+		if c.Error != "" {
+			copies = append(copies, fmt.Sprintf("failed copying to %s: %s", c.Project, c.Error))
+			continue
+		}
+
+		copies = append(
+			copies,
+			fmt.Sprintf("copied to %s as %s (%s)", c.Project, c.ImageName, c.ImageID),
+		)
+	}
+
+	return strings.Join(copies, ", ")
+}
+
+// State returns the state of the input artifact. The `image_copies` state
+// contains the results of copying the image instead.
+func (a *Artifact) State(name string) any {
+	if name == "image_copies" {
+		return a.Copies
+	}
+
+	return a.Artifact.State(name)
+}
@@ -0,0 +1,131 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,TargetConfig
+//go:generate packer-sdc struct-markdown
+
+package imagecopy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/mitchellh/mapstructure"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxideclient"
+)
+
+// The configuration arguments for the post-processor. Arguments can either be required or optional.
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// Oxide API URL (e.g., `https://oxide.sys.example.com`). If not specified,
+	// this defaults to the value of the `OXIDE_HOST` environment variable. When
+	// specified, `token` must be specified. Conflicts with `profile`.
+	Host string `mapstructure:"host" required:"false"`
+
+	// Oxide API token. If not specified, this defaults to the value of the
+	// `OXIDE_TOKEN` environment variable. When specified, `host` must be
+	// specified. Conflicts with `profile`.
+	Token string `mapstructure:"token" required:"false"`
+
+	// Oxide credentials profile. If not specified, this defaults to the value
+	// of the `OXIDE_PROFILE` environment variable. Conflicts with `host` and
+	// `token`.
+	Profile string `mapstructure:"profile" required:"false"`
+
+	// Skip TLS certificate verification when connecting to the Oxide API.
+	// Defaults to `false`.
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify" required:"false"`
+
+	// Projects to copy the image to. Repeat the block to copy the image to
+	// multiple projects. See [Target Configuration](#target-configuration).
+	Targets []TargetConfig `mapstructure:"target" required:"true"`
+
+	// Name of the copied images. Defaults to the name of the image being
+	// copied.
+	ImageName string `mapstructure:"image_name"`
+
+	// Maximum time each cleanup operation, such as deleting the temporary disk
+	// of a copy, may take before the post-processor gives up on it. Defaults
+	// to `5m`.
+	CleanupTimeout time.Duration `mapstructure:"cleanup_timeout" required:"false"`
+}
+
+// TargetConfig configures a project the image is copied to. Every target is
+// copied to with the post-processor's credentials, since images can only be
+// copied within their silo.
+type TargetConfig struct {
+	// Name or ID of the project to copy the image to.
+	Project string `mapstructure:"project" required:"true"`
+}
+
+// Prepare decodes the configuration and validates it.
+func (c *Config) Prepare(args ...any) error {
+	var metadata mapstructure.Metadata
+
+	if err := config.Decode(c, &config.DecodeOpts{
+		Metadata:    &metadata,
+		Interpolate: false,
+		PluginType:  PostProcessorID,
+	}, args...); err != nil {
+		return fmt.Errorf("failed decoding configuration: %w", err)
+	}
+
+	// Set defaults.
+	{
+		if c.CleanupTimeout == 0 {
+			c.CleanupTimeout = 5 * time.Minute
+		}
+	}
+
+	// Enforce required configuration.
+	{
+		var multiErr *packer.MultiError
+
+		if len(c.Targets) == 0 {
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				errors.New("at least one target is required"),
+			)
+		}
+
+		seen := make(map[TargetConfig]bool, len(c.Targets))
+		for i, target := range c.Targets {
+			if target.Project == "" {
+				multiErr = packer.MultiErrorAppend(
+					multiErr,
+					fmt.Errorf("target %d: project is required", i),
+				)
+				continue
+			}
+
+			if seen[target] {
+				multiErr = packer.MultiErrorAppend(
+					multiErr,
+					fmt.Errorf("target %d: project %q is already a target", i, target.Project),
+				)
+			}
+			seen[target] = true
+		}
+
+		if multiErr != nil && len(multiErr.Errors) > 0 {
+			return multiErr
+		}
+	}
+
+	packer.LogSecretFilter.Set(c.Token)
+
+	return nil
+}
+
+// clientOptions returns the options to create an Oxide client from the
+// configuration.
+func (c *Config) clientOptions() []oxide.ClientOption {
+	return oxideclient.Options(c.Host, c.Token, c.Profile, c.InsecureSkipVerify)
+}
@@ -0,0 +1,238 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc struct-markdown
+
+// Package imagecopy implements the `oxide-image-copy` post-processor, which
+// copies an Oxide image to other projects.
+package imagecopy
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+const PostProcessorID = "oxide.image-copy"
+
+var _ packer.PostProcessor = (*PostProcessor)(nil)
+
+// The `oxide-image-copy` post-processor copies the image built by the `oxide-instance` or
+// `oxide-iso` builder, or imported by the `oxide-import` post-processor, to other projects, so
+// that a single build can distribute an image to every project that needs it. The image is
+// copied to every target at once. For each target, a temporary disk is created from the image in
+// the target project and snapshotted, and the copy is created from that snapshot.
+//
+// The Oxide API can't read disks back, so images can only be copied to projects where the image
+// is visible, which are the projects of its silo. Images can't be copied to other silos or racks,
+// so every target is copied to with the same credentials.
+//
+// The post-processor does not manage images. Once it copies an image, it is up to you to use
+// the copies or delete them.
+type PostProcessor struct {
+	config Config
+}
+
+// ConfigSpec returns the HCL configuration specification for the
+// post-processor.
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+// Configure configures the post-processor and validates its configuration.
+func (p *PostProcessor) Configure(args ...any) error {
+	return p.config.Prepare(args...)
+}
+
+// PostProcess copies the image of artifact to every target and returns
+// artifact along with the result of copying to each target.
+func (p *PostProcessor) PostProcess(
+	ctx context.Context,
+	ui packer.Ui,
+	artifact packer.Artifact,
+) (packer.Artifact, bool, bool, error) {
+	imageID := artifact.Id()
+	if imageID == "" {
+		return nil, false, false, fmt.Errorf(
+			"artifact %s has no image to copy",
+			artifact.BuilderId(),
+		)
+	}
+
+	oxideClient, err := oxide.NewClient(p.config.clientOptions()...)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed creating oxide client: %w", err)
+	}
+
+	copies := make([]ImageCopy, len(p.config.Targets))
+	errs := make([]error, len(p.config.Targets))
+
+	var wg sync.WaitGroup
+	for i, target := range p.config.Targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			copies[i].Project = target.Project
+
+			image, err := p.copyImage(ctx, ui, oxideClient, target, imageID)
+			if err != nil {
+				ui.Errorf("Failed copying Oxide image to project %s: %v", target.Project, err)
+				errs[i] = fmt.Errorf("failed copying image to project %s: %w", target.Project, err)
+				copies[i].Error = err.Error()
+				return
+			}
+
+			ui.Sayf(
+				"Copied Oxide image to project %s: %s (%s)",
+				target.Project,
+				image.Name,
+				image.Id,
+			)
+
+			copies[i].ImageID = image.Id
+			copies[i].ImageName = string(image.Name)
+		}()
+	}
+	wg.Wait()
+
+	// The artifact is returned even when copying to a target failed, so that
+	// the copies that succeeded can be found and cleaned up.
+	return &Artifact{
+		Artifact: artifact,
+		Copies:   copies,
+	}, true, false, errors.Join(errs...)
+}
+
+// copyImage copies the image imageID to target through a temporary disk and
+// snapshot in the target project, which it deletes once the copy exists.
+func (p *PostProcessor) copyImage(
+	ctx context.Context,
+	ui packer.Ui,
+	oxideClient *oxide.Client,
+	target TargetConfig,
+	imageID string,
+) (*oxide.Image, error) {
+	source, err := oxideClient.ImageView(ctx, oxide.ImageViewParams{
+		Image: oxide.NameOrId(imageID),
+	})
+	if err != nil {
+		if errors.Is(err, oxide.ErrObjectNotFound) {
+			return nil, fmt.Errorf(
+				"image %s isn't visible, images can only be copied within their silo: %w",
+				imageID,
+				err,
+			)
+		}
+		return nil, fmt.Errorf("failed viewing image %s: %w", imageID, err)
+	}
+
+	name := temporaryName()
+
+	ui.Sayf("Creating temporary Oxide disk %s in project %s", name, target.Project)
+
+	disk, err := oxideClient.DiskCreate(ctx, oxide.DiskCreateParams{
+		Project: oxide.NameOrId(target.Project),
+		Body: &oxide.DiskCreate{
+			Name:        oxide.Name(name),
+			Description: fmt.Sprintf("Copy of image %s.", source.Name),
+			Size:        source.Size,
+			DiskBackend: oxide.DiskBackend{
+				Value: &oxide.DiskBackendDistributed{
+					DiskSource: oxide.DiskSource{
+						Value: &oxide.DiskSourceImage{ImageId: source.Id},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed creating disk: %w", err)
+	}
+	defer p.deleteDisk(ui, oxideClient, disk.Id)
+
+	snapshot, err := oxideClient.SnapshotCreate(ctx, oxide.SnapshotCreateParams{
+		Project: oxide.NameOrId(target.Project),
+		Body: &oxide.SnapshotCreate{
+			Name:        oxide.Name(name),
+			Description: fmt.Sprintf("Copy of image %s.", source.Name),
+			Disk:        oxide.NameOrId(disk.Id),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed creating snapshot: %w", err)
+	}
+	defer p.deleteSnapshot(ui, oxideClient, snapshot.Id)
+
+	image, err := oxideClient.ImageCreate(ctx, oxide.ImageCreateParams{
+		Project: oxide.NameOrId(target.Project),
+		Body: &oxide.ImageCreate{
+			Name:        oxide.Name(cmp.Or(p.config.ImageName, string(source.Name))),
+			Description: source.Description,
+			Os:          source.Os,
+			Source: oxide.ImageSource{
+				Value: &oxide.ImageSourceSnapshot{
+					Id: snapshot.Id,
+				},
+			},
+			Version: source.Version,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed creating image: %w", err)
+	}
+
+	return image, nil
+}
+
+// deleteSnapshot deletes the temporary snapshot a copy was created from.
+func (p *PostProcessor) deleteSnapshot(ui packer.Ui, oxideClient *oxide.Client, id string) {
+	ctx, cancel := context.WithTimeout(context.TODO(), p.config.CleanupTimeout)
+	defer cancel()
+
+	ui.Sayf("Deleting temporary Oxide snapshot: %s", id)
+
+	if err := oxideClient.SnapshotDelete(ctx, oxide.SnapshotDeleteParams{
+		Snapshot: oxide.NameOrId(id),
+	}); err != nil {
+		ui.Errorf(
+			"Failed deleting temporary Oxide snapshot %s during cleanup. "+
+				"Please delete it manually: %v",
+			id,
+			err,
+		)
+	}
+}
+
+// deleteDisk deletes the temporary disk a copy was created through.
+func (p *PostProcessor) deleteDisk(ui packer.Ui, oxideClient *oxide.Client, id string) {
+	ctx, cancel := context.WithTimeout(context.TODO(), p.config.CleanupTimeout)
+	defer cancel()
+
+	ui.Sayf("Deleting temporary Oxide disk: %s", id)
+
+	if err := oxideClient.DiskDelete(ctx, oxide.DiskDeleteParams{
+		Disk: oxide.NameOrId(id),
+	}); err != nil {
+		ui.Errorf(
+			"Failed deleting temporary Oxide disk %s during cleanup. Please delete it manually: %v",
+			id,
+			err,
+		)
+	}
+}
+
+// temporaryName returns a unique name for the temporary disk and snapshot of a
+// copy.
+func temporaryName() string {
+	id := uuid.TimeOrderedUUID()
+	return "packer-copy-" + id[len(id)-12:]
+}
@@ -0,0 +1,237 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package imagecopy_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/builder/instance"
+	imagecopy "github.com/oxidecomputer/packer-plugin-oxide/component/post-processor/image-copy"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxidetest"
+)
+
+// newTestPostProcessor returns a post-processor configured to run against
+// server. The configuration is merged over the defaults, which copy the image
+// to the `staging` and `production` projects.
+func newTestPostProcessor(
+	t *testing.T,
+	server *oxidetest.Server,
+	config map[string]any,
+) *imagecopy.PostProcessor {
+	t.Helper()
+
+	return oxidetest.Configure[imagecopy.PostProcessor](t, server, map[string]any{
+		"target": []map[string]any{
+			{"project": "staging"},
+			{"project": "production"},
+		},
+	}, config)
+}
+
+// createSourceImage seeds server with the image built in the `build` project
+// and returns the artifact of the build.
+func createSourceImage(server *oxidetest.Server) *instance.Artifact {
+	image := server.CreateImage("build", oxide.Image{
+		Name:        "ubuntu-noble",
+		Description: "Ubuntu Noble.",
+		Os:          "ubuntu",
+		Version:     "24.04",
+		Size:        1024 * 1024 * 1024,
+	})
+
+	return &instance.Artifact{ImageID: image.Id, ImageName: string(image.Name)}
+}
+
+// projectImages returns the images server holds in project.
+func projectImages(server *oxidetest.Server, project string) []oxide.Image {
+	var images []oxide.Image
+	for _, image := range server.Images() {
+		if image.ProjectId == project {
+			images = append(images, image)
+		}
+	}
+
+	return images
+}
+
+// TestPostProcessor_Configure tests the validation of the post-processor
+// configuration.
+func TestPostProcessor_Configure(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config map[string]any
+		err    string
+	}{
+		"RequiresTarget": {
+			config: map[string]any{},
+			err:    "at least one target is required",
+		},
+		"RequiresTargetProject": {
+			config: map[string]any{
+				"target": []map[string]any{{}},
+			},
+			err: "target 0: project is required",
+		},
+		"RejectsDuplicateTarget": {
+			config: map[string]any{
+				"target": []map[string]any{{"project": "staging"}, {"project": "staging"}},
+			},
+			err: `target 1: project "staging" is already a target`,
+		},
+		"RejectsTargetCredentials": {
+			config: map[string]any{
+				"target": []map[string]any{
+					{"project": "staging", "host": "https://oxide.example.com"},
+				},
+			},
+			err: `unknown configuration key: '"target[0].host"'`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var p imagecopy.PostProcessor
+			err := p.Configure(tc.config)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+// TestPostProcessor_PostProcess tests copying images against a fake Oxide API.
+func TestPostProcessor_PostProcess(t *testing.T) {
+	t.Run("CopiesImageToTargets", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		input := createSourceImage(server)
+		p := newTestPostProcessor(t, server, nil)
+
+		artifact, keep, _, err := p.PostProcess(t.Context(), packer.TestUi(t), input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !keep {
+			t.Error("expected input artifact to be kept")
+		}
+		if artifact.Id() != input.ImageID {
+			t.Errorf("expected artifact ID %s, got %s", input.ImageID, artifact.Id())
+		}
+
+		copies, ok := artifact.State("image_copies").([]imagecopy.ImageCopy)
+		if !ok || len(copies) != 2 {
+			t.Fatalf("expected 2 image copies, got %#v", artifact.State("image_copies"))
+		}
+
+		for i, project := range []string{"staging", "production"} {
+			images := projectImages(server, project)
+			if len(images) != 1 {
+				t.Fatalf("expected 1 image in project %s, got %d", project, len(images))
+			}
+
+			image := images[0]
+			if image.Name != "ubuntu-noble" || image.Os != "ubuntu" || image.Version != "24.04" {
+				t.Errorf("expected copy of source image in project %s, got %#v", project, image)
+			}
+			if copies[i].Project != project || copies[i].ImageID != image.Id {
+				t.Errorf(
+					"expected copy %d to be image %s in %s, got %#v",
+					i,
+					image.Id,
+					project,
+					copies[i],
+				)
+			}
+		}
+
+		server.AssertNoLeftovers(t, input.ImageID, copies[0].ImageID, copies[1].ImageID)
+	})
+
+	t.Run("UsesImageName", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		input := createSourceImage(server)
+		p := newTestPostProcessor(t, server, map[string]any{"image_name": "golden"})
+
+		if _, _, _, err := p.PostProcess(t.Context(), packer.TestUi(t), input); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, image := range projectImages(server, "staging") {
+			if image.Name != "golden" {
+				t.Errorf("expected image named golden, got %s", image.Name)
+			}
+		}
+	})
+
+	t.Run("ReportsImageOutsideSilo", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		input := &instance.Artifact{ImageID: "feb2c8ee-5a1d-4d66-beeb-289b860561bf"}
+		p := newTestPostProcessor(t, server, nil)
+
+		artifact, _, _, err := p.PostProcess(t.Context(), packer.TestUi(t), input)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), "can only be copied within their silo") {
+			t.Errorf("expected error about the image's silo, got %v", err)
+		}
+
+		copies, ok := artifact.State("image_copies").([]imagecopy.ImageCopy)
+		if !ok || len(copies) != 2 {
+			t.Fatalf("expected 2 image copies, got %#v", artifact.State("image_copies"))
+		}
+		for _, c := range copies {
+			if c.Error == "" || c.ImageID != "" {
+				t.Errorf("expected failed copy, got %#v", c)
+			}
+		}
+
+		server.AssertNoLeftovers(t)
+	})
+
+	for _, operation := range []string{"DiskCreate", "SnapshotCreate", "ImageCreate"} {
+		t.Run("HaltsOn"+operation, func(t *testing.T) {
+			server := oxidetest.NewServer(t)
+			input := createSourceImage(server)
+			server.Fail(operation, 1, oxidetest.Fault{})
+			p := newTestPostProcessor(t, server, nil)
+
+			artifact, keep, _, err := p.PostProcess(t.Context(), packer.TestUi(t), input)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !keep {
+				t.Error("expected input artifact to be kept")
+			}
+
+			// The copy that succeeded is reported along with the failed one.
+			copies, ok := artifact.State("image_copies").([]imagecopy.ImageCopy)
+			if !ok || len(copies) != 2 {
+				t.Fatalf("expected 2 image copies, got %#v", artifact.State("image_copies"))
+			}
+
+			var failed []string
+			imageIDs := []string{input.ImageID}
+			for _, c := range copies {
+				if c.Error != "" {
+					failed = append(failed, c.Project)
+					continue
+				}
+				imageIDs = append(imageIDs, c.ImageID)
+				if images := projectImages(server, c.Project); len(images) != 1 ||
+					images[0].Id != c.ImageID {
+					t.Errorf("expected copy %s in project %s, got %#v", c.ImageID, c.Project, images)
+				}
+			}
+			if len(failed) != 1 || !strings.Contains(err.Error(), failed[0]) {
+				t.Errorf("expected 1 failed copy reported in %v, got %v", err, failed)
+			}
+
+			server.AssertNoLeftovers(t, imageIDs...)
+		})
+	}
+}
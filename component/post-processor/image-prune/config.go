@@ -0,0 +1,143 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc struct-markdown
+
+package imageprune
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/mitchellh/mapstructure"
+)
+
+// The configuration arguments for the post-processor. Arguments can either be required or optional.
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// Oxide API URL (e.g., `https://oxide.sys.example.com`). If not specified,
+	// this defaults to the value of the `OXIDE_HOST` environment variable. When
+	// specified, `token` must be specified. Conflicts with `profile`.
+	Host string `mapstructure:"host" required:"false"`
+
+	// Oxide API token. If not specified, this defaults to the value of the
+	// `OXIDE_TOKEN` environment variable. When specified, `host` must be specified.
+	// Conflicts with `profile`.
+	Token string `mapstructure:"token" required:"false"`
+
+	// Oxide credentials profile. If not specified, this defaults to the value of
+	// the `OXIDE_PROFILE` environment variable. Conflicts with `host` and `token`.
+	Profile string `mapstructure:"profile" required:"false"`
+
+	// Skip TLS certificate verification when connecting to the Oxide API.
+	// Defaults to `false`.
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify" required:"false"`
+
+	// Name or ID of the project to prune images from. If not specified, silo
+	// images are pruned instead.
+	Project string `mapstructure:"project"`
+
+	// Prune images whose name starts with this prefix (e.g., `ubuntu-noble-`).
+	// At least one of `name_prefix` or `name_regex` must be set, and images
+	// must match both when both are set.
+	NamePrefix string `mapstructure:"name_prefix"`
+
+	// Prune images whose name matches this regular expression (e.g.,
+	// `^ubuntu-noble-nightly-[0-9a-f]{8}$`).
+	NameRegex string `mapstructure:"name_regex"`
+
+	// Number of the most recently created matching images to keep. The images
+	// just built are always kept, and count towards this number when they
+	// match. Defaults to `0`.
+	KeepLatest int `mapstructure:"keep_latest"`
+
+	// Only prune matching images created longer than this ago (e.g., `168h`).
+	// If not specified, images are pruned regardless of their age.
+	MaxAge time.Duration `mapstructure:"max_age"`
+
+	// Names of images to never prune, even when they match.
+	ProtectedNames []string `mapstructure:"protected_names"`
+
+	// Report the images that would be pruned without deleting them. Defaults
+	// to `false`.
+	DryRun bool `mapstructure:"dry_run"`
+
+	nameRegex *regexp.Regexp
+}
+
+// Prepare decodes the configuration and validates it.
+func (c *Config) Prepare(args ...any) error {
+	var metadata mapstructure.Metadata
+
+	if err := config.Decode(c, &config.DecodeOpts{
+		Metadata:    &metadata,
+		Interpolate: false,
+		PluginType:  PostProcessorID,
+	}, args...); err != nil {
+		return fmt.Errorf("failed decoding configuration: %w", err)
+	}
+
+	// Enforce required configuration.
+	{
+		var multiErr *packer.MultiError
+
+		if c.NamePrefix == "" && c.NameRegex == "" {
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				errors.New("at least one of name_prefix or name_regex is required"),
+			)
+		}
+
+		if c.NameRegex != "" {
+			re, err := regexp.Compile(c.NameRegex)
+			if err != nil {
+				multiErr = packer.MultiErrorAppend(
+					multiErr,
+					fmt.Errorf("invalid name_regex: %w", err),
+				)
+			}
+			c.nameRegex = re
+		}
+
+		if c.KeepLatest < 0 {
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				errors.New("keep_latest must not be negative"),
+			)
+		}
+
+		if c.MaxAge < 0 {
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				errors.New("max_age must not be negative"),
+			)
+		}
+
+		if multiErr != nil && len(multiErr.Errors) > 0 {
+			return multiErr
+		}
+	}
+
+	packer.LogSecretFilter.Set(c.Token)
+
+	return nil
+}
+
+// matches reports whether name matches the configured name prefix and regular
+// expression.
+func (c *Config) matches(name string) bool {
+	if !strings.HasPrefix(name, c.NamePrefix) {
+		return false
+	}
+
+	return c.nameRegex == nil || c.nameRegex.MatchString(name)
+}
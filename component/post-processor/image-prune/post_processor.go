@@ -0,0 +1,150 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc struct-markdown
+
+// Package imageprune implements the `oxide-image-prune` post-processor, which
+// deletes old Oxide images.
+package imageprune
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/imagefilter"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxideclient"
+)
+
+const PostProcessorID = "oxide.image-prune"
+
+var _ packer.PostProcessor = (*PostProcessor)(nil)
+
+// The `oxide-image-prune` post-processor deletes old [Oxide](https://oxide.computer) images, such
+// as those left behind by earlier nightly builds. It lists the images of a project or silo,
+// selects those whose name matches a prefix or regular expression, and deletes them. The latest
+// images, images younger than a maximum age, protected images, and the images just built are
+// kept.
+//
+// The post-processor passes its input artifact through unchanged, so it can be followed by
+// other post-processors.
+type PostProcessor struct {
+	config Config
+}
+
+// ConfigSpec returns the HCL configuration specification for the
+// post-processor.
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+// Configure configures the post-processor and validates its configuration.
+func (p *PostProcessor) Configure(args ...any) error {
+	return p.config.Prepare(args...)
+}
+
+// PostProcess deletes the images selected by the configuration, other than the
+// images of artifact, and returns artifact.
+func (p *PostProcessor) PostProcess(
+	ctx context.Context,
+	ui packer.Ui,
+	artifact packer.Artifact,
+) (packer.Artifact, bool, bool, error) {
+	oxideClient, err := oxide.NewClient(oxideclient.Options(
+		p.config.Host,
+		p.config.Token,
+		p.config.Profile,
+		p.config.InsecureSkipVerify,
+	)...)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed creating oxide client: %w", err)
+	}
+
+	images, err := oxideClient.ImageListAllPages(ctx, oxide.ImageListParams{
+		Project: oxide.NameOrId(p.config.Project),
+	})
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed listing images: %w", err)
+	}
+
+	prune := p.config.pruneImages(images, builtImageIDs(artifact), time.Now())
+	if len(prune) == 0 {
+		ui.Say("No Oxide images to prune")
+		return artifact, true, false, nil
+	}
+
+	var errs []error
+	for _, image := range prune {
+		if p.config.DryRun {
+			ui.Sayf("Would delete Oxide image %s (%s) (dry_run)", image.Name, image.Id)
+			continue
+		}
+
+		ui.Sayf("Deleting Oxide image %s (%s)", image.Name, image.Id)
+
+		if err := oxideClient.ImageDelete(ctx, oxide.ImageDeleteParams{
+			Image: oxide.NameOrId(image.Id),
+		}); err != nil && !errors.Is(err, oxide.ErrObjectNotFound) {
+			ui.Errorf("Failed deleting Oxide image %s (%s): %v", image.Name, image.Id, err)
+			errs = append(errs, fmt.Errorf("failed deleting image %s: %w", image.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, false, false, errors.Join(errs...)
+	}
+
+	return artifact, true, false, nil
+}
+
+// pruneImages returns the images to prune, which are those whose name matches
+// and that aren't kept. An image is kept when its ID is one of keep, its name is
+// protected, it's one of the latest matching images, or it's younger than the
+// maximum age at now.
+func (c *Config) pruneImages(images []oxide.Image, keep []string, now time.Time) []oxide.Image {
+	var matching []oxide.Image
+	for _, image := range images {
+		if c.matches(string(image.Name)) {
+			matching = append(matching, image)
+		}
+	}
+
+	// Sort the newest images first, keeping the name order the API lists images
+	// in for those created at the same time.
+	slices.SortStableFunc(matching, func(a, b oxide.Image) int {
+		return imagefilter.TimeCreated(b).Compare(imagefilter.TimeCreated(a))
+	})
+
+	var prune []oxide.Image
+	for i, image := range matching {
+		switch {
+		case slices.Contains(keep, image.Id),
+			slices.Contains(c.ProtectedNames, string(image.Name)),
+			i < c.KeepLatest,
+			c.MaxAge > 0 && now.Sub(imagefilter.TimeCreated(image)) < c.MaxAge:
+			continue
+		}
+
+		prune = append(prune, image)
+	}
+
+	return prune
+}
+
+// builtImageIDs returns the IDs of the images of artifact, which are never
+// pruned. Artifacts of this plugin's builders list every image they created in
+// their `image_ids` state.
+func builtImageIDs(artifact packer.Artifact) []string {
+	ids := []string{artifact.Id()}
+	if v, ok := artifact.State("image_ids").([]string); ok {
+		ids = append(ids, v...)
+	}
+
+	return ids
+}
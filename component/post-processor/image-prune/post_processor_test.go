@@ -0,0 +1,206 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package imageprune_test
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	imageprune "github.com/oxidecomputer/packer-plugin-oxide/component/post-processor/image-prune"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxidetest"
+)
+
+// newTestPostProcessor returns a post-processor configured to run against
+// server. The configuration is merged over the defaults.
+func newTestPostProcessor(
+	t *testing.T,
+	server *oxidetest.Server,
+	config map[string]any,
+) *imageprune.PostProcessor {
+	t.Helper()
+
+	return oxidetest.Configure[imageprune.PostProcessor](t, server, map[string]any{
+		"project":     "test-project",
+		"name_prefix": "nightly-",
+	}, config)
+}
+
+// createNightlyImages seeds server with n images in project named
+// `nightly-1` through `nightly-N`, created a day apart with the last created
+// an hour ago. It returns the images in creation order.
+func createNightlyImages(
+	t *testing.T,
+	server *oxidetest.Server,
+	project string,
+	n int,
+) []oxide.Image {
+	t.Helper()
+
+	images := make([]oxide.Image, 0, n)
+	for i := range n {
+		created := time.Now().Add(-time.Hour - time.Duration(n-1-i)*24*time.Hour)
+		images = append(images, server.CreateImage(project, oxide.Image{
+			Name:        oxide.Name(fmt.Sprintf("nightly-%d", i+1)),
+			TimeCreated: &created,
+		}))
+	}
+
+	return images
+}
+
+// imageNames returns the sorted names of the images server holds.
+func imageNames(server *oxidetest.Server) []string {
+	var names []string
+	for _, image := range server.Images() {
+		names = append(names, string(image.Name))
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// TestPostProcessor_Configure tests the validation of the post-processor
+// configuration.
+func TestPostProcessor_Configure(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config map[string]any
+		err    string
+	}{
+		"RequiresNameFilter": {
+			config: map[string]any{"name_prefix": ""},
+			err:    "at least one of name_prefix or name_regex is required",
+		},
+		"RejectsInvalidNameRegex": {
+			config: map[string]any{"name_regex": "nightly-("},
+			err:    "invalid name_regex",
+		},
+		"RejectsNegativeKeepLatest": {
+			config: map[string]any{"keep_latest": -1},
+			err:    "keep_latest must not be negative",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := map[string]any{"name_prefix": "nightly-"}
+			for k, v := range tc.config {
+				raw[k] = v
+			}
+
+			var p imageprune.PostProcessor
+			err := p.Configure(raw)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+// TestPostProcessor_PostProcess tests pruning images against a fake Oxide API.
+func TestPostProcessor_PostProcess(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config   map[string]any
+		expected []string
+	}{
+		"PrunesMatchingImages": {
+			expected: []string{"nightly-5", "other"},
+		},
+		"KeepsLatest": {
+			config:   map[string]any{"keep_latest": 2},
+			expected: []string{"nightly-4", "nightly-5", "other"},
+		},
+		"KeepsProtectedNames": {
+			config:   map[string]any{"protected_names": []string{"nightly-1"}},
+			expected: []string{"nightly-1", "nightly-5", "other"},
+		},
+		"KeepsYoungerThanMaxAge": {
+			config:   map[string]any{"max_age": "50h"},
+			expected: []string{"nightly-3", "nightly-4", "nightly-5", "other"},
+		},
+		"MatchesNameRegex": {
+			config:   map[string]any{"name_regex": "-[12]$"},
+			expected: []string{"nightly-3", "nightly-4", "nightly-5", "other"},
+		},
+		"DryRun": {
+			config: map[string]any{"dry_run": true},
+			expected: []string{
+				"nightly-1",
+				"nightly-2",
+				"nightly-3",
+				"nightly-4",
+				"nightly-5",
+				"other",
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := oxidetest.NewServer(t)
+			images := createNightlyImages(t, server, "test-project", 5)
+			server.CreateImage("test-project", oxide.Image{Name: "other"})
+			p := newTestPostProcessor(t, server, tc.config)
+
+			// The image just built is never pruned.
+			input := &packer.MockArtifact{IdValue: images[4].Id}
+
+			artifact, keep, _, err := p.PostProcess(t.Context(), packer.TestUi(t), input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if artifact != input || !keep {
+				t.Error("expected input artifact to be passed through")
+			}
+
+			if got := imageNames(server); !slices.Equal(got, tc.expected) {
+				t.Errorf("expected images %v, got %v", tc.expected, got)
+			}
+		})
+	}
+
+	t.Run("PrunesSiloImages", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		createNightlyImages(t, server, "", 2)
+		createNightlyImages(t, server, "test-project", 1)
+		p := newTestPostProcessor(t, server, map[string]any{"project": ""})
+
+		if _, _, _, err := p.PostProcess(
+			t.Context(),
+			packer.TestUi(t),
+			&packer.MockArtifact{},
+		); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		images := server.Images()
+		if len(images) != 1 || images[0].ProjectId != "test-project" {
+			t.Errorf("expected only the project image to be kept, got %v", imageNames(server))
+		}
+	})
+
+	t.Run("HaltsOnImageDelete", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		createNightlyImages(t, server, "test-project", 3)
+		server.Fail("ImageDelete", 1, oxidetest.Fault{})
+		p := newTestPostProcessor(t, server, nil)
+
+		artifact, _, _, err := p.PostProcess(t.Context(), packer.TestUi(t), &packer.MockArtifact{})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if artifact != nil {
+			t.Errorf("expected no artifact, got %s", artifact.String())
+		}
+
+		// The other images are still deleted.
+		if n := len(server.Images()); n != 1 {
+			t.Errorf("expected 1 image left, got %d", n)
+		}
+	})
+}
@@ -0,0 +1,194 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc struct-markdown
+
+package oxideimport
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/mitchellh/mapstructure"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/diskimport"
+)
+
+// Formats of the disk image file to import.
+const (
+	formatRaw   = "raw"
+	formatQCOW2 = "qcow2"
+)
+
+// The configuration arguments for the post-processor. Arguments can either be required or optional.
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// Oxide API URL (e.g., `https://oxide.sys.example.com`). If not specified,
+	// this defaults to the value of the `OXIDE_HOST` environment variable. When
+	// specified, `token` must be specified. Conflicts with `profile`.
+	Host string `mapstructure:"host" required:"false"`
+
+	// Oxide API token. If not specified, this defaults to the value of the
+	// `OXIDE_TOKEN` environment variable. When specified, `host` must be specified.
+	// Conflicts with `profile`.
+	Token string `mapstructure:"token" required:"false"`
+
+	// Oxide credentials profile. If not specified, this defaults to the value of
+	// the `OXIDE_PROFILE` environment variable. Conflicts with `host` and `token`.
+	Profile string `mapstructure:"profile" required:"false"`
+
+	// Skip TLS certificate verification when connecting to the Oxide API.
+	// Defaults to `false`.
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify" required:"false"`
+
+	// Name or ID of the project to create the image in.
+	Project string `mapstructure:"project" required:"true"`
+
+	// Name of the resulting image. The temporary disk and snapshot the image is
+	// created from are also given this name.
+	ImageName string `mapstructure:"image_name" required:"true"`
+
+	// Description of the resulting image. Defaults to `Created by Packer.`.
+	ImageDescription string `mapstructure:"image_description"`
+
+	// Operating system of the resulting image (e.g., `debian`).
+	ImageOS string `mapstructure:"image_os" required:"true"`
+
+	// Version of the resulting image (e.g., `13`).
+	ImageVersion string `mapstructure:"image_version" required:"true"`
+
+	// Path of the disk image file to import. Defaults to the only file of the
+	// input artifact, or its first file with a `.raw`, `.img`, or `.qcow2`
+	// extension.
+	SourceFile string `mapstructure:"source_file"`
+
+	// Format of the disk image file. Set to `raw` or `qcow2`. Defaults to
+	// `qcow2` when the file starts with the qcow2 magic and `raw` otherwise.
+	Format string `mapstructure:"format"`
+
+	// Block size of the disk the image is imported into. Must be `512`, `2048`,
+	// or `4096`. Defaults to `512`.
+	BlockSize int `mapstructure:"block_size"`
+
+	// Number of 512 KiB chunks uploaded at once. Defaults to `4`.
+	UploadParallelism int `mapstructure:"upload_parallelism"`
+
+	// Number of times a chunk that failed to upload with a server or network
+	// error is retried before the import fails. Chunks that were uploaded
+	// aren't uploaded again, but a failed import isn't resumed and uploads the
+	// whole disk image when run again. Set to `0` to fail on the first error.
+	// Defaults to `3`.
+	UploadRetries *int `mapstructure:"upload_retries"`
+
+	// Maximum time each cleanup operation, such as deleting the temporary disk,
+	// may take before the post-processor gives up on it. Defaults to `5m`.
+	CleanupTimeout time.Duration `mapstructure:"cleanup_timeout" required:"false"`
+}
+
+// Prepare decodes the configuration and validates it.
+func (c *Config) Prepare(args ...any) error {
+	var metadata mapstructure.Metadata
+
+	if err := config.Decode(c, &config.DecodeOpts{
+		Metadata:    &metadata,
+		Interpolate: false,
+		PluginType:  PostProcessorID,
+	}, args...); err != nil {
+		return fmt.Errorf("failed decoding configuration: %w", err)
+	}
+
+	// Set defaults.
+	{
+		if c.ImageDescription == "" {
+			c.ImageDescription = "Created by Packer."
+		}
+
+		if c.BlockSize == 0 {
+			c.BlockSize = 512
+		}
+
+		if c.UploadParallelism == 0 {
+			c.UploadParallelism = diskimport.DefaultParallelism
+		}
+
+		if c.UploadRetries == nil {
+			retries := 3
+			c.UploadRetries = &retries
+		}
+
+		if c.CleanupTimeout == 0 {
+			c.CleanupTimeout = 5 * time.Minute
+		}
+	}
+
+	// Enforce required configuration.
+	{
+		var multiErr *packer.MultiError
+
+		if c.Project == "" {
+			multiErr = packer.MultiErrorAppend(multiErr, errors.New("project is required"))
+		}
+
+		if c.ImageName == "" {
+			multiErr = packer.MultiErrorAppend(multiErr, errors.New("image_name is required"))
+		}
+
+		if c.ImageOS == "" || c.ImageVersion == "" {
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				errors.New("image_os and image_version are required"),
+			)
+		}
+
+		switch c.Format {
+		case "", formatRaw, formatQCOW2:
+		default:
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				fmt.Errorf(
+					"format must be one of %s or %s, got %q",
+					formatRaw,
+					formatQCOW2,
+					c.Format,
+				),
+			)
+		}
+
+		switch c.BlockSize {
+		case 512, 2048, 4096:
+		default:
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				fmt.Errorf("block_size must be one of 512, 2048, or 4096, got %d", c.BlockSize),
+			)
+		}
+
+		if c.UploadParallelism < 0 {
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				errors.New("upload_parallelism must not be negative"),
+			)
+		}
+
+		if *c.UploadRetries < 0 {
+			multiErr = packer.MultiErrorAppend(
+				multiErr,
+				errors.New("upload_retries must not be negative"),
+			)
+		}
+
+		if multiErr != nil && len(multiErr.Errors) > 0 {
+			return multiErr
+		}
+	}
+
+	packer.LogSecretFilter.Set(c.Token)
+
+	return nil
+}
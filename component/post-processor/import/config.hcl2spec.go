@@ -0,0 +1,75 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package oxideimport
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatConfig struct {
+	PackerBuildName     *string           `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType   *string           `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion   *string           `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug         *bool             `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce         *bool             `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError       *string           `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars      map[string]string `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars []string          `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	Host                *string           `mapstructure:"host" required:"false" cty:"host" hcl:"host"`
+	Token               *string           `mapstructure:"token" required:"false" cty:"token" hcl:"token"`
+	Profile             *string           `mapstructure:"profile" required:"false" cty:"profile" hcl:"profile"`
+	InsecureSkipVerify  *bool             `mapstructure:"insecure_skip_verify" required:"false" cty:"insecure_skip_verify" hcl:"insecure_skip_verify"`
+	Project             *string           `mapstructure:"project" required:"true" cty:"project" hcl:"project"`
+	ImageName           *string           `mapstructure:"image_name" required:"true" cty:"image_name" hcl:"image_name"`
+	ImageDescription    *string           `mapstructure:"image_description" cty:"image_description" hcl:"image_description"`
+	ImageOS             *string           `mapstructure:"image_os" required:"true" cty:"image_os" hcl:"image_os"`
+	ImageVersion        *string           `mapstructure:"image_version" required:"true" cty:"image_version" hcl:"image_version"`
+	SourceFile          *string           `mapstructure:"source_file" cty:"source_file" hcl:"source_file"`
+	Format              *string           `mapstructure:"format" cty:"format" hcl:"format"`
+	BlockSize           *int              `mapstructure:"block_size" cty:"block_size" hcl:"block_size"`
+	UploadParallelism   *int              `mapstructure:"upload_parallelism" cty:"upload_parallelism" hcl:"upload_parallelism"`
+	UploadRetries       *int              `mapstructure:"upload_retries" cty:"upload_retries" hcl:"upload_retries"`
+	CleanupTimeout      *string           `mapstructure:"cleanup_timeout" required:"false" cty:"cleanup_timeout" hcl:"cleanup_timeout"`
+}
+
+// FlatMapstructure returns a new FlatConfig.
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatConfig)
+}
+
+// HCL2Spec returns the hcl spec of a Config.
+// This spec is used by HCL to read the fields of Config.
+// The decoded values from this spec will then be applied to a FlatConfig.
+func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"packer_build_name":          &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":        &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":        &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":               &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":               &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":            &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":      &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables": &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"host":                       &hcldec.AttrSpec{Name: "host", Type: cty.String, Required: false},
+		"token":                      &hcldec.AttrSpec{Name: "token", Type: cty.String, Required: false},
+		"profile":                    &hcldec.AttrSpec{Name: "profile", Type: cty.String, Required: false},
+		"insecure_skip_verify":       &hcldec.AttrSpec{Name: "insecure_skip_verify", Type: cty.Bool, Required: false},
+		"project":                    &hcldec.AttrSpec{Name: "project", Type: cty.String, Required: false},
+		"image_name":                 &hcldec.AttrSpec{Name: "image_name", Type: cty.String, Required: false},
+		"image_description":          &hcldec.AttrSpec{Name: "image_description", Type: cty.String, Required: false},
+		"image_os":                   &hcldec.AttrSpec{Name: "image_os", Type: cty.String, Required: false},
+		"image_version":              &hcldec.AttrSpec{Name: "image_version", Type: cty.String, Required: false},
+		"source_file":                &hcldec.AttrSpec{Name: "source_file", Type: cty.String, Required: false},
+		"format":                     &hcldec.AttrSpec{Name: "format", Type: cty.String, Required: false},
+		"block_size":                 &hcldec.AttrSpec{Name: "block_size", Type: cty.Number, Required: false},
+		"upload_parallelism":         &hcldec.AttrSpec{Name: "upload_parallelism", Type: cty.Number, Required: false},
+		"upload_retries":             &hcldec.AttrSpec{Name: "upload_retries", Type: cty.Number, Required: false},
+		"cleanup_timeout":            &hcldec.AttrSpec{Name: "cleanup_timeout", Type: cty.String, Required: false},
+	}
+	return s
+}
@@ -0,0 +1,294 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:generate packer-sdc struct-markdown
+
+// Package oxideimport implements the `oxide-import` post-processor, which
+// imports raw and qcow2 disk images into Oxide.
+package oxideimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/builder/instance"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/diskimport"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/imagereplace"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxideclient"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/qcow2"
+)
+
+const PostProcessorID = "oxide.import"
+
+// sourceFileExtensions are the extensions of the artifact files that are
+// imported when the artifact has more than one file.
+var sourceFileExtensions = []string{".raw", ".img", ".qcow2"}
+
+var _ packer.PostProcessor = (*PostProcessor)(nil)
+
+// The `oxide-import` post-processor imports a raw or qcow2 disk image produced by another builder,
+// such as the `qemu` builder, into an [Oxide](https://oxide.computer) image. The disk image is
+// uploaded into a temporary disk through the Oxide bulk import API, which is finalized into a
+// snapshot that the image is created from. The resulting artifact is the same as the one
+// created by the `oxide-instance` builder, so it can be used by anything that accepts those.
+//
+// The post-processor does not manage images. Once it creates an image, it is up to you to use
+// it or delete it.
+type PostProcessor struct {
+	config Config
+}
+
+// ConfigSpec returns the HCL configuration specification for the
+// post-processor.
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+// Configure configures the post-processor and validates its configuration.
+func (p *PostProcessor) Configure(args ...any) error {
+	return p.config.Prepare(args...)
+}
+
+// PostProcess imports the disk image file of artifact into an Oxide image.
+func (p *PostProcessor) PostProcess(
+	ctx context.Context,
+	ui packer.Ui,
+	artifact packer.Artifact,
+) (packer.Artifact, bool, bool, error) {
+	source, err := p.sourceFile(artifact)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	oxideClient, err := oxide.NewClient(oxideclient.Options(
+		p.config.Host,
+		p.config.Token,
+		p.config.Profile,
+		p.config.InsecureSkipVerify,
+	)...)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed creating oxide client: %w", err)
+	}
+
+	// The upload can take a while, so a conflicting image fails the import
+	// before it starts rather than once the disk image is uploaded.
+	existing, err := p.existingImage(ctx, oxideClient)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed validating image name: %w", err)
+	}
+	if existing != nil {
+		if !p.config.PackerForce {
+			return nil, false, false, fmt.Errorf(
+				"image name conflicts with existing image: %s (%s): use -force to overwrite",
+				existing.Name,
+				existing.Id,
+			)
+		}
+
+		ui.Sayf(
+			"Existing image will be overwritten (-force): %s (%s)",
+			existing.Name,
+			existing.Id,
+		)
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed opening disk image: %w", err)
+	}
+	defer f.Close()
+
+	format, r, size, err := p.openDiskImage(f)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed opening disk image %s: %w", source, err)
+	}
+
+	ui.Sayf("Uploading %s disk image %s to Oxide", format, source)
+
+	progress := ui.TrackProgress(filepath.Base(source), 0, size, io.NopCloser(r))
+	defer progress.Close()
+
+	diskID, snapshot, err := diskimport.Import(ctx, oxideClient, diskimport.Params{
+		Project:     p.config.Project,
+		Name:        p.config.ImageName,
+		Description: p.config.ImageDescription,
+		BlockSize:   p.config.BlockSize,
+		Size:        size,
+		Parallelism: p.config.UploadParallelism,
+		Retries:     *p.config.UploadRetries,
+	}, progress)
+	defer p.cleanup(ui, oxideClient, diskID, snapshot)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed uploading disk image to Oxide: %w", err)
+	}
+
+	ui.Say("Creating Oxide image from imported disk")
+
+	body := oxide.ImageCreate{
+		Name:        oxide.Name(p.config.ImageName),
+		Description: p.config.ImageDescription,
+		Os:          p.config.ImageOS,
+		Source: oxide.ImageSource{
+			Value: &oxide.ImageSourceSnapshot{
+				Id: snapshot.Id,
+			},
+		},
+		Version: p.config.ImageVersion,
+	}
+
+	var image *oxide.Image
+	if existing != nil {
+		image, err = imagereplace.Replace(
+			ctx,
+			ui,
+			oxideClient,
+			p.config.Project,
+			p.config.CleanupTimeout,
+			body,
+		)
+	} else {
+		image, err = oxideClient.ImageCreate(ctx, oxide.ImageCreateParams{
+			Project: oxide.NameOrId(p.config.Project),
+			Body:    &body,
+		})
+	}
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed creating image: %w", err)
+	}
+
+	ui.Sayf("Created Oxide image: %s (%s)", image.Name, image.Id)
+
+	return instance.NewArtifact(PostProcessorID, image.Id, string(image.Name)), false, false, nil
+}
+
+// existingImage returns the image named image_name in the configured project,
+// or nil when there's no such image.
+func (p *PostProcessor) existingImage(
+	ctx context.Context,
+	oxideClient *oxide.Client,
+) (*oxide.Image, error) {
+	image, err := oxideClient.ImageView(ctx, oxide.ImageViewParams{
+		Project: oxide.NameOrId(p.config.Project),
+		Image:   oxide.NameOrId(p.config.ImageName),
+	})
+	if err != nil {
+		if errors.Is(err, oxide.ErrObjectNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// sourceFile returns the path of the disk image file to import from artifact.
+func (p *PostProcessor) sourceFile(artifact packer.Artifact) (string, error) {
+	if p.config.SourceFile != "" {
+		return p.config.SourceFile, nil
+	}
+
+	files := artifact.Files()
+	if len(files) == 1 {
+		return files[0], nil
+	}
+
+	for _, file := range files {
+		if slices.Contains(sourceFileExtensions, strings.ToLower(filepath.Ext(file))) {
+			return file, nil
+		}
+	}
+
+	return "", fmt.Errorf(
+		"artifact %s has no %s file to import, please set source_file",
+		artifact.BuilderId(),
+		strings.Join(sourceFileExtensions, ", "),
+	)
+}
+
+// openDiskImage returns the format of the disk image in f along with a reader
+// of its guest data and the size of that data.
+func (p *PostProcessor) openDiskImage(f *os.File) (string, io.Reader, int64, error) {
+	format := p.config.Format
+	if format == "" {
+		isQCOW2, err := qcow2.Detect(f)
+		if err != nil {
+			return "", nil, 0, err
+		}
+
+		format = formatRaw
+		if isQCOW2 {
+			format = formatQCOW2
+		}
+	}
+
+	if format == formatQCOW2 {
+		img, err := qcow2.Open(f)
+		if err != nil {
+			return "", nil, 0, err
+		}
+
+		return format, io.NewSectionReader(img, 0, img.Size()), img.Size(), nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if info.Size() == 0 {
+		return "", nil, 0, errors.New("disk image is empty")
+	}
+
+	return format, f, info.Size(), nil
+}
+
+// cleanup deletes the temporary snapshot and disk the image was imported
+// through.
+func (p *PostProcessor) cleanup(
+	ui packer.Ui,
+	oxideClient *oxide.Client,
+	diskID string,
+	snapshot *oxide.Snapshot,
+) {
+	ctx, cancel := context.WithTimeout(context.TODO(), p.config.CleanupTimeout)
+	defer cancel()
+
+	if snapshot != nil {
+		ui.Sayf("Deleting temporary Oxide snapshot: %s", snapshot.Id)
+
+		if err := oxideClient.SnapshotDelete(ctx, oxide.SnapshotDeleteParams{
+			Snapshot: oxide.NameOrId(snapshot.Id),
+		}); err != nil {
+			ui.Errorf(
+				"Failed deleting temporary Oxide snapshot %s during cleanup. "+
+					"Please delete it manually: %v",
+				snapshot.Id,
+				err,
+			)
+		}
+	}
+
+	if diskID != "" {
+		ui.Sayf("Deleting temporary Oxide disk: %s", diskID)
+
+		if err := oxideClient.DiskDelete(ctx, oxide.DiskDeleteParams{
+			Disk: oxide.NameOrId(diskID),
+		}); err != nil {
+			ui.Errorf(
+				"Failed deleting temporary Oxide disk %s during cleanup. "+
+					"Please delete it manually: %v",
+				diskID,
+				err,
+			)
+		}
+	}
+}
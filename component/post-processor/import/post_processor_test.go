@@ -0,0 +1,436 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package oxideimport_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/builder/instance"
+	oxideimport "github.com/oxidecomputer/packer-plugin-oxide/component/post-processor/import"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/diskimport"
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/oxidetest"
+)
+
+// testDiskImage is the guest data of the disk images used by the tests. Its
+// second chunk is all zeros and its size isn't a multiple of the block size.
+var testDiskImage = slices.Concat(
+	bytes.Repeat([]byte("a"), diskimport.ChunkSize),
+	make([]byte, diskimport.ChunkSize),
+	bytes.Repeat([]byte("b"), 3*diskimport.ChunkSize),
+	bytes.Repeat([]byte("c"), 1000),
+)
+
+// qcow2ClusterBits is the cluster size of the qcow2 images written by
+// [writeQCOW2], which is the default of qemu-img.
+const qcow2ClusterBits = 16
+
+// writeQCOW2 writes data as a version 3 qcow2 image, mirroring the images
+// qemu-img creates. Clusters that are all zeros are left unallocated, except for
+// one that's marked with the zero flag, and every other allocated cluster is
+// compressed.
+func writeQCOW2(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	clusterSize := 1 << qcow2ClusterBits
+	clusters := (len(data) + clusterSize - 1) / clusterSize
+
+	// The header, L1 table, and L2 table each take a cluster, followed by the
+	// data clusters.
+	const l1Offset, l2Offset = 1 << qcow2ClusterBits, 2 << qcow2ClusterBits
+	file := make([]byte, 3*clusterSize)
+
+	binary.BigEndian.PutUint32(file[0:], 0x514649fb)
+	binary.BigEndian.PutUint32(file[4:], 3)
+	binary.BigEndian.PutUint32(file[20:], qcow2ClusterBits)
+	binary.BigEndian.PutUint64(file[24:], uint64(len(data)))
+	binary.BigEndian.PutUint32(file[36:], 1)
+	binary.BigEndian.PutUint64(file[40:], l1Offset)
+	binary.BigEndian.PutUint32(file[96:], 4)
+	binary.BigEndian.PutUint32(file[100:], 104)
+	binary.BigEndian.PutUint64(file[l1Offset:], l2Offset|1<<63)
+
+	zeroFlagged := false
+	for i := range clusters {
+		cluster := make([]byte, clusterSize)
+		copy(cluster, data[i*clusterSize:])
+
+		var entry uint64
+		switch {
+		case bytes.Equal(cluster, make([]byte, clusterSize)) && !zeroFlagged:
+			entry = 1
+			zeroFlagged = true
+		case bytes.Equal(cluster, make([]byte, clusterSize)):
+		case i%2 == 0:
+			// Allocated clusters must be aligned to the cluster size.
+			file = append(file, make([]byte, (clusterSize-len(file)%clusterSize)%clusterSize)...)
+			entry = uint64(len(file)) | 1<<63
+			file = append(file, cluster...)
+		default:
+			var compressed bytes.Buffer
+			w, err := flate.NewWriter(&compressed, flate.BestCompression)
+			if err != nil {
+				t.Fatalf("failed creating compressor: %v", err)
+			}
+			if _, err := w.Write(cluster); err != nil {
+				t.Fatalf("failed compressing cluster: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed compressing cluster: %v", err)
+			}
+
+			// Compressed clusters are packed at sector granularity, so start
+			// this one partway through a sector.
+			offset := uint64(len(file)) + 100
+			sectors := (offset%512 + uint64(compressed.Len()) + 511) / 512
+			offsetBits := 62 - (qcow2ClusterBits - 8)
+			entry = 1<<62 | (sectors-1)<<offsetBits | offset
+
+			file = append(file, make([]byte, 100)...)
+			file = append(file, compressed.Bytes()...)
+		}
+
+		binary.BigEndian.PutUint64(file[l2Offset+i*8:], entry)
+	}
+
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatalf("failed writing qcow2 image: %v", err)
+	}
+}
+
+// newTestPostProcessor returns a post-processor configured to run against
+// server. The configuration is merged over the defaults.
+func newTestPostProcessor(
+	t *testing.T,
+	server *oxidetest.Server,
+	config map[string]any,
+) *oxideimport.PostProcessor {
+	t.Helper()
+
+	return oxidetest.Configure[oxideimport.PostProcessor](t, server, map[string]any{
+		"project":       "test-project",
+		"image_name":    "packer-test",
+		"image_os":      "debian",
+		"image_version": "13",
+	}, config)
+}
+
+// rawArtifact returns an artifact of a raw disk image of [testDiskImage].
+func rawArtifact(t *testing.T) packer.Artifact {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "disk.raw")
+	if err := os.WriteFile(path, testDiskImage, 0o644); err != nil {
+		t.Fatalf("failed writing disk image: %v", err)
+	}
+
+	return &packer.MockArtifact{FilesValue: []string{path}}
+}
+
+// cancellingUi is a [packer.Ui] that cancels an upload once it starts reading
+// the disk image.
+type cancellingUi struct {
+	packer.Ui
+	cancel context.CancelFunc
+}
+
+// TrackProgress returns stream, which calls cancel before its first read.
+func (u *cancellingUi) TrackProgress(
+	_ string,
+	_, _ int64,
+	stream io.ReadCloser,
+) io.ReadCloser {
+	return &cancellingReader{ReadCloser: stream, cancel: u.cancel}
+}
+
+// cancellingReader calls cancel before reading from the wrapped reader.
+type cancellingReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	r.cancel()
+	return r.ReadCloser.Read(p)
+}
+
+// assertImageContents fails the test when the contents of the image aren't
+// [testDiskImage] padded to the block size. The fake only holds the contents up
+// to the last chunk written.
+func assertImageContents(t *testing.T, server *oxidetest.Server, imageID string) {
+	t.Helper()
+
+	contents := server.Contents(imageID)
+	expected := slices.Concat(testDiskImage, make([]byte, 512-1000%512))
+	if !bytes.Equal(contents, expected) {
+		t.Errorf("unexpected image contents of %d bytes", len(contents))
+	}
+}
+
+// TestPostProcessor_Configure tests the validation of the post-processor
+// configuration.
+func TestPostProcessor_Configure(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config map[string]any
+		err    string
+	}{
+		"RequiresProject": {
+			config: map[string]any{"project": ""},
+			err:    "project is required",
+		},
+		"RequiresImageName": {
+			config: map[string]any{"image_name": ""},
+			err:    "image_name is required",
+		},
+		"RequiresImageOS": {
+			config: map[string]any{"image_os": ""},
+			err:    "image_os and image_version are required",
+		},
+		"RejectsInvalidFormat": {
+			config: map[string]any{"format": "vmdk"},
+			err:    "format must be one of raw or qcow2",
+		},
+		"RejectsInvalidBlockSize": {
+			config: map[string]any{"block_size": 1024},
+			err:    "block_size must be one of",
+		},
+		"RejectsNegativeUploadRetries": {
+			config: map[string]any{"upload_retries": -1},
+			err:    "upload_retries must not be negative",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := map[string]any{
+				"project":       "test-project",
+				"image_name":    "packer-test",
+				"image_os":      "debian",
+				"image_version": "13",
+			}
+			for k, v := range tc.config {
+				raw[k] = v
+			}
+
+			var p oxideimport.PostProcessor
+			err := p.Configure(raw)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+// TestPostProcessor_PostProcess tests importing disk images against a fake
+// Oxide API.
+func TestPostProcessor_PostProcess(t *testing.T) {
+	t.Run("ImportsRawImage", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		p := newTestPostProcessor(t, server, nil)
+
+		artifact, keep, _, err := p.PostProcess(t.Context(), packer.TestUi(t), rawArtifact(t))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if keep {
+			t.Error("expected input artifact not to be kept")
+		}
+
+		if artifact.BuilderId() != oxideimport.PostProcessorID {
+			t.Errorf(
+				"expected builder ID %s, got %s",
+				oxideimport.PostProcessorID,
+				artifact.BuilderId(),
+			)
+		}
+		if artifact.String() != "packer-test ("+artifact.Id()+")" {
+			t.Errorf("unexpected artifact: %s", artifact.String())
+		}
+
+		image := server.Images()[0]
+		if image.Os != "debian" || image.Version != "13" {
+			t.Errorf("unexpected image OS %q and version %q", image.Os, image.Version)
+		}
+
+		assertImageContents(t, server, artifact.Id())
+		if n := server.Calls("DiskBulkWriteImport"); n != 5 {
+			t.Errorf("expected 5 bulk writes, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t, artifact.Id())
+	})
+
+	t.Run("ImportsQCOW2Image", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		p := newTestPostProcessor(t, server, nil)
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "disk.qcow2")
+		writeQCOW2(t, path, testDiskImage)
+
+		// The disk image is picked out of the artifact's other files.
+		files := []string{filepath.Join(dir, "disk.qcow2.sha256"), path}
+		artifact, _, _, err := p.PostProcess(
+			t.Context(),
+			packer.TestUi(t),
+			&packer.MockArtifact{FilesValue: files},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertImageContents(t, server, artifact.Id())
+		server.AssertNoLeftovers(t, artifact.Id())
+	})
+
+	t.Run("RetriesFailedWrite", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("DiskBulkWriteImport", 1, oxidetest.Fault{})
+		p := newTestPostProcessor(t, server, map[string]any{"upload_parallelism": 1})
+
+		artifact, _, _, err := p.PostProcess(t.Context(), packer.TestUi(t), rawArtifact(t))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertImageContents(t, server, artifact.Id())
+		if n := server.Calls("DiskBulkWriteImport"); n != 6 {
+			t.Errorf("expected 6 bulk writes, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t, artifact.Id())
+	})
+
+	t.Run("DisablesRetries", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		server.Fail("DiskBulkWriteImport", 1, oxidetest.Fault{})
+		p := newTestPostProcessor(t, server, map[string]any{
+			"upload_parallelism": 1,
+			"upload_retries":     0,
+		})
+
+		_, _, _, err := p.PostProcess(t.Context(), packer.TestUi(t), rawArtifact(t))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if n := server.Calls("DiskBulkWriteImport"); n != 1 {
+			t.Errorf("expected 1 bulk write, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t)
+	})
+
+	t.Run("RejectsExistingImage", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage("test-project", oxide.Image{Name: "packer-test"})
+		p := newTestPostProcessor(t, server, nil)
+
+		_, _, _, err := p.PostProcess(t.Context(), packer.TestUi(t), rawArtifact(t))
+		if err == nil || !strings.Contains(err.Error(), "use -force to overwrite") {
+			t.Fatalf("expected image name conflict error, got %v", err)
+		}
+
+		// The conflict is caught before the disk image is uploaded.
+		if n := server.Calls("DiskCreate"); n != 0 {
+			t.Errorf("expected no disks to be created, got %d", n)
+		}
+
+		server.AssertNoLeftovers(t, existing.Id)
+	})
+
+	t.Run("ReplacesExistingImageWithForce", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		existing := server.CreateImage("test-project", oxide.Image{Name: "packer-test"})
+		p := newTestPostProcessor(t, server, map[string]any{"packer_force": true})
+
+		artifact, _, _, err := p.PostProcess(t.Context(), packer.TestUi(t), rawArtifact(t))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if artifact.Id() == existing.Id {
+			t.Errorf("expected existing image %s to be replaced", existing.Id)
+		}
+		if name := artifact.(*instance.Artifact).ImageName; name != "packer-test" {
+			t.Errorf("expected image named packer-test, got %s", name)
+		}
+
+		assertImageContents(t, server, artifact.Id())
+		server.AssertNoLeftovers(t, artifact.Id())
+	})
+
+	t.Run("CleansUpWhenCancelled", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		p := newTestPostProcessor(t, server, nil)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		ui := &cancellingUi{Ui: packer.TestUi(t), cancel: cancel}
+
+		_, _, _, err := p.PostProcess(ctx, ui, rawArtifact(t))
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled error, got %v", err)
+		}
+
+		// Bulk writes are stopped despite the cancellation, so the disk can be
+		// deleted.
+		server.AssertNoLeftovers(t)
+	})
+
+	t.Run("RequiresDiskImageFile", func(t *testing.T) {
+		server := oxidetest.NewServer(t)
+		p := newTestPostProcessor(t, server, nil)
+
+		_, _, _, err := p.PostProcess(
+			t.Context(),
+			packer.TestUi(t),
+			&packer.MockArtifact{FilesValue: []string{"disk.vmdk", "disk.ovf"}},
+		)
+		if err == nil || !strings.Contains(err.Error(), "please set source_file") {
+			t.Errorf("expected missing source file error, got %v", err)
+		}
+	})
+
+	// Each case fails a single API operation and checks that the import fails
+	// and cleans up every resource it created before the failure. Client errors
+	// aren't retried.
+	for _, operation := range []string{
+		"ImageView",
+		"DiskCreate",
+		"DiskBulkWriteImport",
+		"DiskFinalizeImport",
+		"ImageCreate",
+	} {
+		t.Run("HaltsOn"+operation, func(t *testing.T) {
+			server := oxidetest.NewServer(t)
+			server.Fail(operation, 1, oxidetest.Fault{
+				StatusCode: http.StatusBadRequest,
+				ErrorCode:  "InvalidRequest",
+			})
+			p := newTestPostProcessor(t, server, nil)
+
+			artifact, _, _, err := p.PostProcess(t.Context(), packer.TestUi(t), rawArtifact(t))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if artifact != nil {
+				t.Errorf("expected no artifact, got %s", artifact.String())
+			}
+
+			server.AssertNoLeftovers(t)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package diskimport uploads raw disk images into Oxide through the bulk import
+// disk API. A disk is created in the importing state, written to in chunks, and
+// finalized into a snapshot that images and other disks can be created from.
+package diskimport
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+// ChunkSize is the number of bytes sent in each bulk write request, which is
+// the most the Oxide API accepts.
+const ChunkSize = 512 * 1024
+
+// DefaultParallelism is the number of chunks written at once when
+// [Params.Parallelism] is unset.
+const DefaultParallelism = 4
+
+// retryDelay is the delay before the first retry of a failed write.
+const retryDelay = 500 * time.Millisecond
+
+// diskSizeAlignment is the size Oxide disks must be a multiple of.
+const diskSizeAlignment = 1024 * 1024 * 1024
+
+// Params are the parameters of an import.
+type Params struct {
+	// Name or ID of the project to create the disk and snapshot in.
+	Project string
+
+	// Name of the disk to import into. The snapshot it's finalized into has the
+	// same name.
+	Name string
+
+	// Description of the disk and snapshot.
+	Description string
+
+	// Block size of the disk. Must be 512, 2048, or 4096.
+	BlockSize int
+
+	// Size of the data in bytes. The disk is rounded up to the next GiB.
+	Size int64
+
+	// Number of chunks written at once. Defaults to [DefaultParallelism].
+	Parallelism int
+
+	// Number of times a chunk that failed to be written with a server or
+	// transport error is retried before the import fails.
+	Retries int
+}
+
+// DiskSize returns the size of a disk that holds size bytes of data.
+func DiskSize(size int64) uint64 {
+	return (uint64(size) + diskSizeAlignment - 1) / diskSizeAlignment * diskSizeAlignment
+}
+
+// Import writes the data read from r into a new disk and finalizes the disk into
+// a snapshot. The returned disk ID is set whenever the disk was created, even if
+// the import failed, so the caller can delete it. The snapshot is only returned
+// once the import succeeded, and is otherwise deleted.
+func Import(
+	ctx context.Context,
+	client *oxide.Client,
+	params Params,
+	r io.Reader,
+) (string, *oxide.Snapshot, error) {
+	disk, err := client.DiskCreate(ctx, oxide.DiskCreateParams{
+		Project: oxide.NameOrId(params.Project),
+		Body: &oxide.DiskCreate{
+			Name:        oxide.Name(params.Name),
+			Description: params.Description,
+			Size:        oxide.ByteCount(DiskSize(params.Size)),
+			DiskBackend: oxide.DiskBackend{
+				Value: &oxide.DiskBackendDistributed{
+					DiskSource: oxide.DiskSource{
+						Value: &oxide.DiskSourceImportingBlocks{
+							BlockSize: oxide.BlockSize(params.BlockSize),
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed creating disk: %w", err)
+	}
+
+	if err := client.DiskBulkWriteImportStart(ctx, oxide.DiskBulkWriteImportStartParams{
+		Disk: oxide.NameOrId(disk.Id),
+	}); err != nil {
+		return disk.Id, nil, fmt.Errorf("failed starting bulk write: %w", err)
+	}
+
+	if err := write(ctx, client, disk.Id, params, r); err != nil {
+		// The disk can only be deleted once bulk writes have stopped, so they're
+		// stopped even when ctx was cancelled.
+		stopErr := client.DiskBulkWriteImportStop(
+			context.WithoutCancel(ctx),
+			oxide.DiskBulkWriteImportStopParams{Disk: oxide.NameOrId(disk.Id)},
+		)
+		if stopErr != nil {
+			stopErr = fmt.Errorf("failed stopping bulk write: %w", stopErr)
+		}
+		return disk.Id, nil, errors.Join(err, stopErr)
+	}
+
+	if err := client.DiskBulkWriteImportStop(ctx, oxide.DiskBulkWriteImportStopParams{
+		Disk: oxide.NameOrId(disk.Id),
+	}); err != nil {
+		return disk.Id, nil, fmt.Errorf("failed stopping bulk write: %w", err)
+	}
+
+	if err := client.DiskFinalizeImport(ctx, oxide.DiskFinalizeImportParams{
+		Disk: oxide.NameOrId(disk.Id),
+		Body: &oxide.FinalizeDisk{SnapshotName: oxide.Name(params.Name)},
+	}); err != nil {
+		return disk.Id, nil, fmt.Errorf("failed finalizing disk: %w", err)
+	}
+
+	snapshot, err := client.SnapshotView(ctx, oxide.SnapshotViewParams{
+		Project:  oxide.NameOrId(params.Project),
+		Snapshot: oxide.NameOrId(params.Name),
+	})
+	if err != nil {
+		// The snapshot isn't returned to the caller, so it's deleted here, even
+		// when ctx was cancelled.
+		deleteErr := client.SnapshotDelete(context.WithoutCancel(ctx), oxide.SnapshotDeleteParams{
+			Project:  oxide.NameOrId(params.Project),
+			Snapshot: oxide.NameOrId(params.Name),
+		})
+		if deleteErr != nil {
+			deleteErr = fmt.Errorf(
+				"failed deleting snapshot %s, please delete it manually: %w",
+				params.Name,
+				deleteErr,
+			)
+		}
+		return disk.Id, nil, errors.Join(fmt.Errorf("failed viewing snapshot: %w", err), deleteErr)
+	}
+
+	return disk.Id, snapshot, nil
+}
+
+// chunk is data to write to a disk at an offset.
+type chunk struct {
+	offset uint64
+	data   []byte
+}
+
+// write writes the data read from r to the disk in chunks, with up to
+// [Params.Parallelism] chunks written at once. Chunks that are all zeros are
+// skipped since new disks are zeroed, and the final chunk is padded to the
+// block size. The first chunk that fails to be written stops the write.
+func write(
+	ctx context.Context,
+	client *oxide.Client,
+	diskID string,
+	params Params,
+	r io.Reader,
+) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	chunks := make(chan chunk)
+
+	var wg sync.WaitGroup
+	for range cmp.Or(params.Parallelism, DefaultParallelism) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for c := range chunks {
+				if err := writeChunk(ctx, client, diskID, params.Retries, c); err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}()
+	}
+
+	readErr := read(ctx, params.BlockSize, r, chunks)
+	close(chunks)
+	wg.Wait()
+
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+
+	return readErr
+}
+
+// read reads r in chunks and sends the chunks that aren't all zeros to chunks
+// until r is exhausted or ctx is done.
+func read(ctx context.Context, blockSize int, r io.Reader, chunks chan<- chunk) error {
+	zeros := make([]byte, ChunkSize)
+
+	var buf []byte
+	var offset uint64
+	for {
+		if buf == nil {
+			buf = make([]byte, ChunkSize)
+		}
+
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			data := buf[:n]
+			if rem := n % blockSize; rem != 0 {
+				data = append(data, zeros[:blockSize-rem]...)
+			}
+
+			if !bytes.Equal(data, zeros[:len(data)]) {
+				select {
+				case chunks <- chunk{offset: offset, data: data}:
+					// The chunk is owned by the worker writing it now.
+					buf = nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			offset += uint64(len(data))
+		}
+
+		switch {
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return nil
+		case err != nil:
+			return fmt.Errorf("failed reading disk image: %w", err)
+		}
+	}
+}
+
+// writeChunk writes c to the disk, retrying up to retries times on errors that
+// may succeed when retried. The delay between attempts doubles from
+// [retryDelay] with each retry.
+func writeChunk(
+	ctx context.Context,
+	client *oxide.Client,
+	diskID string,
+	retries int,
+	c chunk,
+) error {
+	data := base64.StdEncoding.EncodeToString(c.data)
+
+	for attempt := 0; ; attempt++ {
+		err := client.DiskBulkWriteImport(ctx, oxide.DiskBulkWriteImportParams{
+			Disk: oxide.NameOrId(diskID),
+			Body: &oxide.ImportBlocksBulkWrite{
+				Base64EncodedData: data,
+				Offset:            oxide.NewPointer(c.offset),
+			},
+		})
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= retries || ctx.Err() != nil || !retryable(err) {
+			return fmt.Errorf("failed writing at offset %d: %w", c.offset, err)
+		}
+
+		select {
+		case <-time.After(retryDelay << attempt):
+		case <-ctx.Done():
+			return fmt.Errorf("failed writing at offset %d: %w", c.offset, err)
+		}
+	}
+}
+
+// retryable returns whether a request that failed with err may succeed when
+// retried. Errors from the API are retryable when they're server errors or rate
+// limits, and all other errors are assumed to be transport errors.
+func retryable(err error) bool {
+	var httpErr *oxide.HTTPError
+	if !errors.As(err, &httpErr) {
+		return true
+	}
+
+	if httpErr.HTTPResponse == nil {
+		return false
+	}
+
+	code := httpErr.HTTPResponse.StatusCode
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
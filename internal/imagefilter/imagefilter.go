@@ -0,0 +1,256 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package imagefilter finds Oxide images by name, operating system, and
+// version among the images of a project, the silo images, or both.
+package imagefilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-version"
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+// Scopes of the images to search.
+const (
+	ScopeProject = "project"
+	ScopeSilo    = "silo"
+	ScopeBoth    = "both"
+)
+
+// maxDescribed is the number of images listed by [Describe].
+const maxDescribed = 10
+
+// Filter selects Oxide images. Empty fields match every image.
+type Filter struct {
+	// Exact name of the images.
+	Name string
+
+	// Regular expression the names of the images match.
+	NameRegex string
+
+	// Operating system of the images, compared case-insensitively.
+	OS string
+
+	// Version constraint the versions of the images satisfy (e.g.,
+	// `>= 24.04, < 25`).
+	Version string
+
+	// Name or ID of the project whose images are searched.
+	Project string
+
+	// Images to search, which is one of [ScopeProject], [ScopeSilo], or
+	// [ScopeBoth]. Defaults to [ScopeProject] when Project is set and
+	// [ScopeSilo] otherwise.
+	Scope string
+
+	nameRegex *regexp.Regexp
+	version   version.Constraints
+}
+
+// Prepare sets defaults for the filter and validates it. It must be called
+// before the filter is used.
+func (f *Filter) Prepare() []error {
+	var errs []error
+
+	if f.Scope == "" {
+		f.Scope = ScopeSilo
+		if f.Project != "" {
+			f.Scope = ScopeProject
+		}
+	}
+
+	if f.NameRegex != "" {
+		re, err := regexp.Compile(f.NameRegex)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid name_regex: %w", err))
+		}
+		f.nameRegex = re
+	}
+
+	if f.Version != "" {
+		constraints, err := version.NewConstraint(f.Version)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid version constraint: %w", err))
+		}
+		f.version = constraints
+	}
+
+	switch f.Scope {
+	case ScopeProject, ScopeBoth:
+		if f.Project == "" {
+			errs = append(errs, fmt.Errorf("project is required when scope is %s", f.Scope))
+		}
+	case ScopeSilo:
+	default:
+		errs = append(errs, fmt.Errorf(
+			"scope must be one of %s, %s, or %s, got %q",
+			ScopeProject,
+			ScopeSilo,
+			ScopeBoth,
+			f.Scope,
+		))
+	}
+
+	return errs
+}
+
+// Empty reports whether the filter matches every image in scope.
+func (f *Filter) Empty() bool {
+	return f.Name == "" && f.NameRegex == "" && f.OS == "" && f.Version == ""
+}
+
+// Matches reports whether image matches the filter.
+func (f *Filter) Matches(image oxide.Image) bool {
+	if f.Name != "" && string(image.Name) != f.Name {
+		return false
+	}
+
+	if f.nameRegex != nil && !f.nameRegex.MatchString(string(image.Name)) {
+		return false
+	}
+
+	if f.OS != "" && !strings.EqualFold(image.Os, f.OS) {
+		return false
+	}
+
+	if f.version != nil {
+		v, err := version.NewVersion(image.Version)
+		if err != nil || !f.version.Check(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// List returns the images in scope that match the filter, most recently
+// created first.
+func (f *Filter) List(ctx context.Context, client *oxide.Client) ([]oxide.Image, error) {
+	var projects []string
+	switch f.Scope {
+	case ScopeProject:
+		projects = []string{f.Project}
+	case ScopeSilo:
+		projects = []string{""}
+	case ScopeBoth:
+		projects = []string{f.Project, ""}
+	default:
+		return nil, errors.New("filter isn't prepared")
+	}
+
+	var matches []oxide.Image
+	for _, project := range projects {
+		// This relies on the Go SDK omitting empty strings from serialization to
+		// list silo images.
+		images, err := client.ImageListAllPages(ctx, oxide.ImageListParams{
+			Project: oxide.NameOrId(project),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed listing images within project %q: %w", project, err)
+		}
+
+		for _, image := range images {
+			if f.Matches(image) {
+				matches = append(matches, image)
+			}
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b oxide.Image) int {
+		return TimeCreated(b).Compare(TimeCreated(a))
+	})
+
+	return matches, nil
+}
+
+// Describe returns a description of the first images for error messages.
+func Describe(images []oxide.Image) string {
+	descriptions := make([]string, 0, maxDescribed+1)
+	for _, image := range images[:min(len(images), maxDescribed)] {
+		scope := "silo"
+		if image.ProjectId != "" {
+			scope = "project " + image.ProjectId
+		}
+
+		descriptions = append(descriptions, fmt.Sprintf(
+			"%s (%s) in %s, os %q, version %q, created %s",
+			image.Name,
+			image.Id,
+			scope,
+			image.Os,
+			image.Version,
+			TimeCreated(image).Format(time.RFC3339),
+		))
+	}
+
+	if n := len(images) - maxDescribed; n > 0 {
+		descriptions = append(descriptions, fmt.Sprintf("and %d more", n))
+	}
+
+	return strings.Join(descriptions, "; ")
+}
+
+// Details are the details of an image that data sources output. The outputs
+// of the data sources are converted from Details, so they must have the same
+// fields.
+type Details struct {
+	ImageID      string
+	Name         string
+	Description  string
+	OS           string
+	Version      string
+	Size         uint64
+	BlockSize    int
+	Digest       string
+	ProjectID    string
+	TimeCreated  string
+	TimeModified string
+}
+
+// NewDetails returns the details of image. Times are formatted in RFC 3339
+// format, and unknown ones are left empty.
+func NewDetails(image oxide.Image) Details {
+	details := Details{
+		ImageID:     image.Id,
+		Name:        string(image.Name),
+		Description: image.Description,
+		OS:          image.Os,
+		Version:     image.Version,
+		Size:        uint64(image.Size),
+		BlockSize:   int(image.BlockSize),
+		ProjectID:   image.ProjectId,
+	}
+
+	if digest, ok := image.Digest.Value.(*oxide.DigestSha256); ok {
+		details.Digest = fmt.Sprintf("%s:%s", image.Digest.Type(), digest.Value)
+	}
+
+	if image.TimeCreated != nil {
+		details.TimeCreated = image.TimeCreated.Format(time.RFC3339)
+	}
+
+	if image.TimeModified != nil {
+		details.TimeModified = image.TimeModified.Format(time.RFC3339)
+	}
+
+	return details
+}
+
+// TimeCreated returns the time image was created, or the zero time when it's
+// unknown.
+func TimeCreated(image oxide.Image) time.Time {
+	if image.TimeCreated == nil {
+		return time.Time{}
+	}
+
+	return *image.TimeCreated
+}
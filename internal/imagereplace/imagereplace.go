@@ -0,0 +1,115 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package imagereplace replaces Oxide images with new images of the same name
+// without losing the existing image when creating the new one fails.
+package imagereplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+// Replace creates an image in project in place of the existing image with the
+// same name, which is only deleted once the new image could be created. Since
+// images can't be renamed, the new image is first created under a temporary
+// name, and then re-created under the final name from the same source once the
+// existing image is deleted. A failure at any stage rolls back what it can and
+// reports which images are left. Each rollback may take up to cleanupTimeout.
+func Replace(
+	ctx context.Context,
+	ui packer.Ui,
+	oxideClient *oxide.Client,
+	project string,
+	cleanupTimeout time.Duration,
+	body oxide.ImageCreate,
+) (*oxide.Image, error) {
+	name := body.Name
+
+	temporaryBody := body
+	temporaryBody.Name = oxide.Name(TemporaryName())
+
+	ui.Sayf("Creating Oxide image under temporary name %s to replace %s", temporaryBody.Name, name)
+
+	temporaryImage, err := oxideClient.ImageCreate(ctx, oxide.ImageCreateParams{
+		Project: oxide.NameOrId(project),
+		Body:    &temporaryBody,
+	})
+	if err != nil {
+		ui.Errorf("The existing Oxide image %s is unchanged.", name)
+		return nil, err
+	}
+
+	ui.Sayf("Deleting existing Oxide image %s because -force is set", name)
+
+	if err := oxideClient.ImageDelete(ctx, oxide.ImageDeleteParams{
+		Project: oxide.NameOrId(project),
+		Image:   oxide.NameOrId(name),
+	}); err != nil && !errors.Is(err, oxide.ErrObjectNotFound) {
+		DeleteTemporary(ui, oxideClient, cleanupTimeout, temporaryImage)
+		ui.Errorf("The existing Oxide image %s is unchanged.", name)
+		return nil, fmt.Errorf("failed deleting existing image %s: %w", name, err)
+	}
+
+	ui.Sayf("Creating Oxide image %s", name)
+
+	image, err := oxideClient.ImageCreate(ctx, oxide.ImageCreateParams{
+		Project: oxide.NameOrId(project),
+		Body:    &body,
+	})
+	if err != nil {
+		ui.Errorf(
+			"The existing Oxide image %s was deleted. The new image is kept as %s (%s).",
+			name,
+			temporaryImage.Name,
+			temporaryImage.Id,
+		)
+		return nil, err
+	}
+
+	DeleteTemporary(ui, oxideClient, cleanupTimeout, temporaryImage)
+
+	return image, nil
+}
+
+// DeleteTemporary deletes an image created under a temporary name to replace
+// an existing image, such as by [Replace]. The deletion may take up to
+// cleanupTimeout.
+func DeleteTemporary(
+	ui packer.Ui,
+	oxideClient *oxide.Client,
+	cleanupTimeout time.Duration,
+	image *oxide.Image,
+) {
+	ui.Sayf("Deleting temporary Oxide image: %s", image.Id)
+
+	// The temporary image must be deleted even when the build was cancelled
+	// partway through replacing the existing image.
+	ctx, cancel := context.WithTimeout(context.TODO(), cleanupTimeout)
+	defer cancel()
+
+	if err := oxideClient.ImageDelete(ctx, oxide.ImageDeleteParams{
+		Image: oxide.NameOrId(image.Id),
+	}); err != nil {
+		ui.Errorf(
+			"Failed deleting temporary Oxide image %s (%s). Please delete it manually: %v",
+			image.Name,
+			image.Id,
+			err,
+		)
+	}
+}
+
+// TemporaryName returns a unique name for an image that replaces an existing
+// one before it's re-created under the final name.
+func TemporaryName() string {
+	id := uuid.TimeOrderedUUID()
+	return fmt.Sprintf("packer-replace-%s", id[len(id)-12:])
+}
@@ -0,0 +1,40 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package localaddr finds the local address Packer uses to reach the Oxide API,
+// which is also the address instances reach Packer at in most networks.
+package localaddr
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"net/url"
+)
+
+// Lookup returns the local address used to reach the Oxide API at host.
+func Lookup(ctx context.Context, host string) (netip.Addr, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	// Dialing UDP selects a route without sending any packets.
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap(), nil
+}
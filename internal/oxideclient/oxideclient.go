@@ -0,0 +1,30 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package oxideclient builds the options to create Oxide clients from the
+// credentials configured for the plugin's components.
+package oxideclient
+
+import "github.com/oxidecomputer/oxide.go/oxide"
+
+// Options returns the options to create an Oxide client with the given
+// credentials. Empty credentials are left for the client to read from the
+// environment.
+func Options(host, token, profile string, insecureSkipVerify bool) []oxide.ClientOption {
+	opts := make([]oxide.ClientOption, 0)
+	if host != "" {
+		opts = append(opts, oxide.WithHost(host))
+	}
+	if token != "" {
+		opts = append(opts, oxide.WithToken(token))
+	}
+	if profile != "" {
+		opts = append(opts, oxide.WithProfile(profile))
+	}
+	if insecureSkipVerify {
+		opts = append(opts, oxide.WithInsecureSkipVerify())
+	}
+
+	return opts
+}
@@ -0,0 +1,89 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package oxidetest
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+// Configure returns a plugin component of type T, such as a post-processor or
+// data source, configured to run against s. The configuration is merged over
+// defaults, which are merged over the credentials of s.
+func Configure[T any, PT interface {
+	*T
+	Configure(...any) error
+}](t testing.TB, s *Server, defaults, config map[string]any) PT {
+	t.Helper()
+
+	component := PT(new(T))
+	if err := component.Configure(s.config(defaults, config)); err != nil {
+		t.Fatalf("failed configuring %T: %v", component, err)
+	}
+
+	return component
+}
+
+// Prepare returns a builder of type T prepared to run against s. The
+// configuration is merged over defaults, which are merged over the credentials
+// of s.
+func Prepare[T any, PT interface {
+	*T
+	Prepare(...any) ([]string, []string, error)
+}](t testing.TB, s *Server, defaults, config map[string]any) PT {
+	t.Helper()
+
+	builder := PT(new(T))
+	if _, _, err := builder.Prepare(s.config(defaults, config)); err != nil {
+		t.Fatalf("failed preparing %T: %v", builder, err)
+	}
+
+	return builder
+}
+
+// AssertNoLeftovers fails t when s holds any instance, disk, snapshot, SSH key,
+// VPC subnet, or VPC, or any image other than images.
+func (s *Server) AssertNoLeftovers(t testing.TB, images ...string) {
+	t.Helper()
+
+	for _, v := range s.Instances() {
+		t.Errorf("leftover instance: %s (%s)", v.Name, v.Id)
+	}
+	for _, v := range s.Disks() {
+		t.Errorf("leftover disk: %s (%s)", v.Name, v.Id)
+	}
+	for _, v := range s.Snapshots() {
+		t.Errorf("leftover snapshot: %s (%s)", v.Name, v.Id)
+	}
+	for _, v := range s.SSHKeys() {
+		t.Errorf("leftover SSH key: %s (%s)", v.Name, v.Id)
+	}
+	for _, v := range s.Subnets() {
+		t.Errorf("leftover VPC subnet: %s (%s)", v.Name, v.Id)
+	}
+	for _, v := range s.VPCs() {
+		t.Errorf("leftover VPC: %s (%s)", v.Name, v.Id)
+	}
+	for _, v := range s.Images() {
+		if !slices.Contains(images, v.Id) {
+			t.Errorf("leftover image: %s (%s)", v.Name, v.Id)
+		}
+	}
+}
+
+// config returns the raw configuration of a plugin component that runs against
+// s, with each of configs merged over the previous ones.
+func (s *Server) config(configs ...map[string]any) map[string]any {
+	raw := map[string]any{
+		"host":  s.URL,
+		"token": Token,
+	}
+	for _, config := range configs {
+		maps.Copy(raw, config)
+	}
+
+	return raw
+}
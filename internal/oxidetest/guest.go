@@ -0,0 +1,116 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package oxidetest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// ShellGuest returns a [Server.SerialConsoleGuest] that behaves like a login
+// prompt on a Unix serial console. Once logged in with username and password,
+// input is passed to an interactive `sh` running on the test host. An empty
+// username skips the login prompt.
+//
+// Like a terminal, the guest echoes input, treats carriage returns as newlines,
+// and writes newlines as carriage return and newline pairs.
+func ShellGuest(username, password string) func(console io.ReadWriter) {
+	return func(console io.ReadWriter) {
+		in := bufio.NewReader(console)
+		out := &crlfWriter{w: console}
+
+		for username != "" {
+			fmt.Fprint(out, "login: ")
+			user, err := readLine(in, out, true)
+			if err != nil {
+				return
+			}
+
+			fmt.Fprint(out, "Password: ")
+			pass, err := readLine(in, out, false)
+			if err != nil {
+				return
+			}
+
+			if user == username && pass == password {
+				break
+			}
+
+			fmt.Fprint(out, "\nLogin incorrect\n")
+		}
+
+		cmd := exec.Command("sh", "-i")
+		cmd.Env = []string{"PATH=/usr/local/bin:/usr/bin:/bin", "PS1=$ ", "PS2=> "}
+		cmd.Stdout = out
+		cmd.Stderr = out
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			fmt.Fprintf(out, "failed starting shell: %v\n", err)
+			return
+		}
+
+		if err := cmd.Start(); err != nil {
+			fmt.Fprintf(out, "failed starting shell: %v\n", err)
+			return
+		}
+
+		buf := make([]byte, 4096)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				break
+			}
+			input := bytes.ReplaceAll(buf[:n], []byte("\r"), []byte("\n"))
+
+			out.Write(input)
+			if _, err := stdin.Write(input); err != nil {
+				break
+			}
+		}
+
+		stdin.Close()
+		cmd.Wait()
+	}
+}
+
+// readLine reads a line of input from in, echoing it to out when echo is set.
+func readLine(in *bufio.Reader, out io.Writer, echo bool) (string, error) {
+	var line []byte
+
+	for {
+		b, err := in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		if b == '\r' || b == '\n' {
+			fmt.Fprint(out, "\n")
+			return string(line), nil
+		}
+
+		line = append(line, b)
+		if echo {
+			out.Write([]byte{b})
+		}
+	}
+}
+
+// crlfWriter writes to w, replacing newlines with carriage return and newline
+// pairs.
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,1497 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package oxidetest
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
+	"github.com/oxidecomputer/oxide.go/oxide"
+	"golang.org/x/net/websocket"
+)
+
+// routes returns the handler serving the Oxide API endpoints known to the fake.
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /v1/images", s.handle("ImageList", s.imageList))
+	mux.Handle("GET /v1/images/{image}", s.handle("ImageView", s.imageView))
+	mux.Handle("POST /v1/images", s.handle("ImageCreate", s.imageCreate))
+	mux.Handle("DELETE /v1/images/{image}", s.handle("ImageDelete", s.imageDelete))
+	mux.Handle("POST /v1/images/{image}/promote", s.handle("ImagePromote", s.imagePromote))
+
+	mux.Handle("POST /v1/instances", s.handle("InstanceCreate", s.instanceCreate))
+	mux.Handle("GET /v1/instances/{instance}", s.handle("InstanceView", s.instanceView))
+	mux.Handle("POST /v1/instances/{instance}/stop", s.handle("InstanceStop", s.instanceStop))
+	mux.Handle("DELETE /v1/instances/{instance}", s.handle("InstanceDelete", s.instanceDelete))
+	mux.Handle(
+		"GET /v1/instances/{instance}/external-ips",
+		s.handle("InstanceExternalIpList", s.instanceExternalIPList),
+	)
+	mux.Handle(
+		"GET /v1/instances/{instance}/serial-console",
+		s.handle("InstanceSerialConsole", s.instanceSerialConsole),
+	)
+	mux.Handle(
+		"GET /v1/instances/{instance}/serial-console/stream",
+		s.handleStream("InstanceSerialConsoleStream", s.instanceSerialConsoleStream),
+	)
+
+	mux.Handle(
+		"GET /v1/network-interfaces",
+		s.handle("InstanceNetworkInterfaceList", s.instanceNetworkInterfaceList),
+	)
+
+	mux.Handle("POST /v1/floating-ips", s.handle("FloatingIpCreate", s.floatingIPCreate))
+	mux.Handle(
+		"GET /v1/floating-ips/{floating_ip}",
+		s.handle("FloatingIpView", s.floatingIPView),
+	)
+	mux.Handle(
+		"DELETE /v1/floating-ips/{floating_ip}",
+		s.handle("FloatingIpDelete", s.floatingIPDelete),
+	)
+	mux.Handle(
+		"POST /v1/floating-ips/{floating_ip}/detach",
+		s.handle("FloatingIpDetach", s.floatingIPDetach),
+	)
+
+	mux.Handle(
+		"GET /v1/vpc-firewall-rules",
+		s.handle("VpcFirewallRulesView", s.vpcFirewallRulesView),
+	)
+	mux.Handle(
+		"PUT /v1/vpc-firewall-rules",
+		s.handle("VpcFirewallRulesUpdate", s.vpcFirewallRulesUpdate),
+	)
+
+	mux.Handle("POST /v1/vpcs", s.handle("VpcCreate", s.vpcCreate))
+	mux.Handle("DELETE /v1/vpcs/{vpc}", s.handle("VpcDelete", s.vpcDelete))
+	mux.Handle("GET /v1/vpc-subnets", s.handle("VpcSubnetList", s.vpcSubnetList))
+	mux.Handle("POST /v1/vpc-subnets", s.handle("VpcSubnetCreate", s.vpcSubnetCreate))
+	mux.Handle("DELETE /v1/vpc-subnets/{subnet}", s.handle("VpcSubnetDelete", s.vpcSubnetDelete))
+
+	mux.Handle("POST /v1/disks", s.handle("DiskCreate", s.diskCreate))
+	mux.Handle("GET /v1/disks/{disk}", s.handle("DiskView", s.diskView))
+	mux.Handle("DELETE /v1/disks/{disk}", s.handle("DiskDelete", s.diskDelete))
+	mux.Handle(
+		"POST /v1/disks/{disk}/bulk-write-start",
+		s.handle("DiskBulkWriteImportStart", s.diskBulkWriteImportStart),
+	)
+	mux.Handle(
+		"POST /v1/disks/{disk}/bulk-write",
+		s.handle("DiskBulkWriteImport", s.diskBulkWriteImport),
+	)
+	mux.Handle(
+		"POST /v1/disks/{disk}/bulk-write-stop",
+		s.handle("DiskBulkWriteImportStop", s.diskBulkWriteImportStop),
+	)
+	mux.Handle(
+		"POST /v1/disks/{disk}/finalize",
+		s.handle("DiskFinalizeImport", s.diskFinalizeImport),
+	)
+
+	mux.Handle("GET /v1/snapshots/{snapshot}", s.handle("SnapshotView", s.snapshotView))
+	mux.Handle("POST /v1/snapshots", s.handle("SnapshotCreate", s.snapshotCreate))
+	mux.Handle("DELETE /v1/snapshots/{snapshot}", s.handle("SnapshotDelete", s.snapshotDelete))
+
+	mux.Handle("POST /v1/me/ssh-keys", s.handle("CurrentUserSshKeyCreate", s.sshKeyCreate))
+	mux.Handle(
+		"DELETE /v1/me/ssh-keys/{ssh_key}",
+		s.handle("CurrentUserSshKeyDelete", s.sshKeyDelete),
+	)
+
+	return mux
+}
+
+// lookup finds a resource in m by ID, or by name when the resource's project
+// matches project.
+func lookup[T any](
+	m map[string]*T,
+	nameOrID string,
+	project string,
+	name func(*T) oxide.Name,
+	projectID func(*T) string,
+) (*T, bool) {
+	if v, ok := m[nameOrID]; ok {
+		return v, true
+	}
+
+	for _, v := range m {
+		if string(name(v)) == nameOrID && projectID(v) == project {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+// decode reads the JSON request body into v, writing an error response and
+// returning false on failure.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return false
+	}
+	return true
+}
+
+func notFound(w http.ResponseWriter, kind, nameOrID string) {
+	writeError(
+		w,
+		http.StatusNotFound,
+		"ObjectNotFound",
+		fmt.Sprintf("not found: %s with id or name %q", kind, nameOrID),
+	)
+}
+
+func alreadyExists(w http.ResponseWriter, kind string, name oxide.Name) {
+	writeError(
+		w,
+		http.StatusBadRequest,
+		"ObjectAlreadyExists",
+		fmt.Sprintf("already exists: %s %q", kind, name),
+	)
+}
+
+func invalidRequest(w http.ResponseWriter, format string, args ...any) {
+	writeError(w, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf(format, args...))
+}
+
+func now() *time.Time {
+	t := time.Now().UTC()
+	return &t
+}
+
+func imageName(v *oxide.Image) oxide.Name           { return v.Name }
+func imageProject(v *oxide.Image) string            { return v.ProjectId }
+func instanceName(v *instance) oxide.Name           { return v.Name }
+func instanceProject(v *instance) string            { return v.ProjectId }
+func diskName(v *oxide.Disk) oxide.Name             { return v.Name }
+func diskProject(v *oxide.Disk) string              { return v.ProjectId }
+func snapshotName(v *oxide.Snapshot) oxide.Name     { return v.Name }
+func snapshotProject(v *oxide.Snapshot) string      { return v.ProjectId }
+func sshKeyName(v *oxide.SshKey) oxide.Name         { return v.Name }
+func sshKeyProject(*oxide.SshKey) string            { return "" }
+func floatingIPName(v *oxide.FloatingIp) oxide.Name { return v.Name }
+func floatingIPProject(v *oxide.FloatingIp) string  { return v.ProjectId }
+func vpcName(v *oxide.Vpc) oxide.Name               { return v.Name }
+func vpcProject(v *oxide.Vpc) string                { return v.ProjectId }
+func subnetName(v *oxide.VpcSubnet) oxide.Name      { return v.Name }
+func subnetVPC(v *oxide.VpcSubnet) string           { return v.VpcId }
+
+func (s *Server) imageList(w http.ResponseWriter, r *http.Request) {
+	project := r.URL.Query().Get("project")
+
+	images := []oxide.Image{}
+	for _, image := range s.images {
+		if image.ProjectId == project {
+			images = append(images, *image)
+		}
+	}
+
+	// The API sorts by name by default.
+	slices.SortFunc(images, func(a, b oxide.Image) int {
+		return strings.Compare(string(a.Name), string(b.Name))
+	})
+
+	writeJSON(w, http.StatusOK, oxide.ImageResultsPage{Items: images})
+}
+
+func (s *Server) imageView(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("image")
+
+	image, ok := lookup(s.images, nameOrID, r.URL.Query().Get("project"), imageName, imageProject)
+	if !ok {
+		notFound(w, "image", nameOrID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, image)
+}
+
+func (s *Server) imageCreate(w http.ResponseWriter, r *http.Request) {
+	project := r.URL.Query().Get("project")
+
+	var body oxide.ImageCreate
+	if !decode(w, r, &body) {
+		return
+	}
+
+	if _, ok := lookup(s.images, string(body.Name), project, imageName, imageProject); ok {
+		alreadyExists(w, "image", body.Name)
+		return
+	}
+
+	source, ok := body.Source.Value.(*oxide.ImageSourceSnapshot)
+	if !ok {
+		invalidRequest(w, "unsupported image source %q", body.Source.Type())
+		return
+	}
+
+	snapshot, ok := s.snapshots[source.Id]
+	if !ok {
+		notFound(w, "snapshot", source.Id)
+		return
+	}
+
+	image := &oxide.Image{
+		BlockSize:    4096,
+		Description:  body.Description,
+		Id:           uuid.TimeOrderedUUID(),
+		Name:         body.Name,
+		Os:           body.Os,
+		ProjectId:    project,
+		Size:         snapshot.Size,
+		TimeCreated:  now(),
+		TimeModified: now(),
+		Version:      body.Version,
+	}
+	s.images[image.Id] = image
+	s.copyContents(snapshot.Id, image.Id)
+
+	writeJSON(w, http.StatusCreated, image)
+}
+
+func (s *Server) imageDelete(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("image")
+
+	image, ok := lookup(s.images, nameOrID, r.URL.Query().Get("project"), imageName, imageProject)
+	if !ok {
+		notFound(w, "image", nameOrID)
+		return
+	}
+
+	delete(s.images, image.Id)
+	delete(s.contents, image.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) imagePromote(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("image")
+
+	image, ok := lookup(s.images, nameOrID, r.URL.Query().Get("project"), imageName, imageProject)
+	if !ok {
+		notFound(w, "image", nameOrID)
+		return
+	}
+
+	if image.ProjectId == "" {
+		invalidRequest(w, "image %q is already a silo image", image.Name)
+		return
+	}
+
+	if _, ok := lookup(s.images, string(image.Name), "", imageName, imageProject); ok {
+		alreadyExists(w, "image", image.Name)
+		return
+	}
+
+	image.ProjectId = ""
+	image.TimeModified = now()
+
+	writeJSON(w, http.StatusAccepted, image)
+}
+
+func (s *Server) instanceCreate(w http.ResponseWriter, r *http.Request) {
+	project := r.URL.Query().Get("project")
+
+	var body oxide.InstanceCreate
+	if !decode(w, r, &body) {
+		return
+	}
+
+	if _, ok := lookup(s.instances, string(body.Name), project, instanceName, instanceProject); ok {
+		alreadyExists(w, "instance", body.Name)
+		return
+	}
+
+	inst := &instance{
+		Instance: oxide.Instance{
+			Description:  body.Description,
+			Hostname:     string(body.Hostname),
+			Id:           uuid.TimeOrderedUUID(),
+			Memory:       body.Memory,
+			Name:         body.Name,
+			Ncpus:        body.Ncpus,
+			ProjectId:    project,
+			TimeCreated:  now(),
+			TimeModified: now(),
+		},
+		serialConsole: []byte(s.SerialConsoleOutput),
+	}
+
+	var floatingIPs []*oxide.FloatingIp
+	for _, eip := range body.ExternalIps {
+		switch v := eip.Value.(type) {
+		case *oxide.ExternalIpCreateEphemeral:
+			inst.externalIPs = append(inst.externalIPs, oxide.ExternalIp{
+				Value: &oxide.ExternalIpEphemeral{
+					Ip:       s.allocateIP(v.PoolSelector),
+					IpPoolId: ipPoolID(v.PoolSelector),
+				},
+			})
+		case *oxide.ExternalIpCreateFloating:
+			floatingIP, ok := lookup(
+				s.floatingIPs,
+				string(v.FloatingIp),
+				project,
+				floatingIPName,
+				floatingIPProject,
+			)
+			if !ok {
+				notFound(w, "floating ip", string(v.FloatingIp))
+				return
+			}
+			if floatingIP.InstanceId != "" {
+				invalidRequest(w, "floating ip %q is already attached", floatingIP.Name)
+				return
+			}
+			floatingIPs = append(floatingIPs, floatingIP)
+		default:
+			invalidRequest(w, "unsupported external IP type %q", eip.Type())
+			return
+		}
+	}
+
+	if v, ok := body.NetworkInterfaces.Value.(*oxide.InstanceNetworkInterfaceAttachmentCreate); ok {
+		for i, params := range v.Params {
+			s.nextIP++
+			inst.networkInterfaces = append(inst.networkInterfaces, oxide.InstanceNetworkInterface{
+				Description:  params.Description,
+				Id:           uuid.TimeOrderedUUID(),
+				InstanceId:   inst.Id,
+				IpStack:      privateIPStack(params.IpConfig, s.nextIP),
+				Name:         params.Name,
+				Primary:      oxide.NewPointer(i == 0),
+				SubnetId:     string(params.SubnetName),
+				VpcId:        string(params.VpcName),
+				TimeCreated:  now(),
+				TimeModified: now(),
+			})
+		}
+	}
+
+	if body.BootDisk.Value != nil {
+		disk, ok := s.attachDisk(w, inst, project, body.BootDisk)
+		if !ok {
+			return
+		}
+		inst.BootDiskId = disk.Id
+	}
+
+	for _, attachment := range body.Disks {
+		if _, ok := s.attachDisk(w, inst, project, attachment); !ok {
+			return
+		}
+	}
+
+	for _, floatingIP := range floatingIPs {
+		floatingIP.InstanceId = inst.Id
+	}
+
+	inst.pending = append([]oxide.InstanceState(nil), s.StartStates...)
+	inst.advance()
+	s.instances[inst.Id] = inst
+
+	writeJSON(w, http.StatusCreated, inst.Instance)
+}
+
+// attachDisk creates or looks up the disk described by attachment and attaches
+// it to inst.
+func (s *Server) attachDisk(
+	w http.ResponseWriter,
+	inst *instance,
+	project string,
+	attachment oxide.InstanceDiskAttachment,
+) (*oxide.Disk, bool) {
+	switch v := attachment.Value.(type) {
+	case *oxide.InstanceDiskAttachmentCreate:
+		if _, ok := lookup(s.disks, string(v.Name), project, diskName, diskProject); ok {
+			alreadyExists(w, "disk", v.Name)
+			return nil, false
+		}
+
+		disk := &oxide.Disk{
+			BlockSize:    4096,
+			Description:  v.Description,
+			Id:           uuid.TimeOrderedUUID(),
+			Name:         v.Name,
+			ProjectId:    project,
+			Size:         v.Size,
+			TimeCreated:  now(),
+			TimeModified: now(),
+		}
+
+		if backend, ok := v.DiskBackend.Value.(*oxide.DiskBackendDistributed); ok {
+			switch src := backend.DiskSource.Value.(type) {
+			case *oxide.DiskSourceBlank:
+				disk.BlockSize = src.BlockSize
+			case *oxide.DiskSourceImage:
+				if _, ok := s.images[src.ImageId]; !ok {
+					notFound(w, "image", src.ImageId)
+					return nil, false
+				}
+				disk.ImageId = src.ImageId
+				s.copyContents(src.ImageId, disk.Id)
+			case *oxide.DiskSourceSnapshot:
+				if _, ok := s.snapshots[src.SnapshotId]; !ok {
+					notFound(w, "snapshot", src.SnapshotId)
+					return nil, false
+				}
+				disk.SnapshotId = src.SnapshotId
+				s.copyContents(src.SnapshotId, disk.Id)
+			}
+		}
+
+		disk.State = oxide.DiskState{Value: &oxide.DiskStateAttached{Instance: inst.Id}}
+		s.disks[disk.Id] = disk
+
+		return disk, true
+	case *oxide.InstanceDiskAttachmentAttach:
+		disk, ok := lookup(s.disks, string(v.Name), project, diskName, diskProject)
+		if !ok {
+			notFound(w, "disk", string(v.Name))
+			return nil, false
+		}
+
+		if disk.State.State() != oxide.DiskStateStateDetached {
+			invalidRequest(w, "disk %q is not detached", disk.Name)
+			return nil, false
+		}
+
+		disk.State = oxide.DiskState{Value: &oxide.DiskStateAttached{Instance: inst.Id}}
+
+		return disk, true
+	default:
+		invalidRequest(w, "unsupported disk attachment type %q", attachment.Type())
+		return nil, false
+	}
+}
+
+// advance moves the instance to its next pending run state, if any.
+func (i *instance) advance() {
+	if len(i.pending) == 0 {
+		return
+	}
+
+	i.RunState = i.pending[0]
+	i.pending = i.pending[1:]
+	i.TimeRunStateUpdated = now()
+}
+
+func (s *Server) instanceView(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("instance")
+
+	inst, ok := lookup(
+		s.instances,
+		nameOrID,
+		r.URL.Query().Get("project"),
+		instanceName,
+		instanceProject,
+	)
+	if !ok {
+		notFound(w, "instance", nameOrID)
+		return
+	}
+
+	inst.advance()
+
+	writeJSON(w, http.StatusOK, inst.Instance)
+}
+
+func (s *Server) instanceStop(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("instance")
+
+	inst, ok := lookup(
+		s.instances,
+		nameOrID,
+		r.URL.Query().Get("project"),
+		instanceName,
+		instanceProject,
+	)
+	if !ok {
+		notFound(w, "instance", nameOrID)
+		return
+	}
+
+	if inst.RunState != oxide.InstanceStateStopped {
+		inst.pending = append([]oxide.InstanceState(nil), s.StopStates...)
+		inst.advance()
+	}
+
+	writeJSON(w, http.StatusAccepted, inst.Instance)
+}
+
+func (s *Server) instanceDelete(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("instance")
+
+	inst, ok := lookup(
+		s.instances,
+		nameOrID,
+		r.URL.Query().Get("project"),
+		instanceName,
+		instanceProject,
+	)
+	if !ok {
+		notFound(w, "instance", nameOrID)
+		return
+	}
+
+	switch inst.RunState {
+	case oxide.InstanceStateStopped, oxide.InstanceStateFailed:
+	default:
+		invalidRequest(w, "instance %q cannot be deleted while %s", inst.Name, inst.RunState)
+		return
+	}
+
+	// Deleting an instance detaches its disks and floating IPs but does not
+	// delete them.
+	for _, disk := range s.disks {
+		if attached, ok := disk.State.Value.(*oxide.DiskStateAttached); ok &&
+			attached.Instance == inst.Id {
+			disk.State = oxide.DiskState{Value: &oxide.DiskStateDetached{}}
+		}
+	}
+	for _, floatingIP := range s.floatingIPs {
+		if floatingIP.InstanceId == inst.Id {
+			floatingIP.InstanceId = ""
+		}
+	}
+
+	delete(s.instances, inst.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) instanceExternalIPList(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("instance")
+
+	inst, ok := lookup(
+		s.instances,
+		nameOrID,
+		r.URL.Query().Get("project"),
+		instanceName,
+		instanceProject,
+	)
+	if !ok {
+		notFound(w, "instance", nameOrID)
+		return
+	}
+
+	externalIPs := append([]oxide.ExternalIp{}, inst.externalIPs...)
+	for _, floatingIP := range s.floatingIPs {
+		if floatingIP.InstanceId == inst.Id {
+			externalIPs = append(externalIPs, oxide.ExternalIp{
+				Value: &oxide.ExternalIpFloating{
+					Description:  floatingIP.Description,
+					Id:           floatingIP.Id,
+					InstanceId:   floatingIP.InstanceId,
+					Ip:           floatingIP.Ip,
+					IpPoolId:     floatingIP.IpPoolId,
+					Name:         floatingIP.Name,
+					ProjectId:    floatingIP.ProjectId,
+					TimeCreated:  floatingIP.TimeCreated,
+					TimeModified: floatingIP.TimeModified,
+				},
+			})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, oxide.ExternalIpResultsPage{Items: externalIPs})
+}
+
+func (s *Server) instanceNetworkInterfaceList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	nameOrID := query.Get("instance")
+
+	inst, ok := lookup(s.instances, nameOrID, query.Get("project"), instanceName, instanceProject)
+	if !ok {
+		notFound(w, "instance", nameOrID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, oxide.InstanceNetworkInterfaceResultsPage{
+		Items: append([]oxide.InstanceNetworkInterface{}, inst.networkInterfaces...),
+	})
+}
+
+// privateIPStack returns the IP stack the fake assigns a network interface
+// created with config, using n to pick unique addresses.
+func privateIPStack(config oxide.PrivateIpStackCreate, n int) oxide.PrivateIpStack {
+	v4 := oxide.PrivateIpv4Stack{Ip: fmt.Sprintf("172.30.0.%d", n)}
+	v6 := oxide.PrivateIpv6Stack{Ip: fmt.Sprintf("fd00::%x", n)}
+
+	switch config.Value.(type) {
+	case *oxide.PrivateIpStackCreateV4:
+		return oxide.PrivateIpStack{Value: &oxide.PrivateIpStackV4{Value: v4}}
+	case *oxide.PrivateIpStackCreateV6:
+		return oxide.PrivateIpStack{Value: &oxide.PrivateIpStackV6{Value: v6}}
+	default:
+		return oxide.PrivateIpStack{Value: &oxide.PrivateIpStackDualStack{
+			Value: oxide.PrivateIpStackDualStackValue{V4: v4, V6: v6},
+		}}
+	}
+}
+
+func (s *Server) instanceSerialConsole(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("instance")
+	query := r.URL.Query()
+
+	inst, ok := lookup(
+		s.instances,
+		nameOrID,
+		query.Get("project"),
+		instanceName,
+		instanceProject,
+	)
+	if !ok {
+		notFound(w, "instance", nameOrID)
+		return
+	}
+
+	parse := func(name string) (uint64, bool) {
+		v, err := strconv.ParseUint(query.Get(name), 10, 64)
+		return v, err == nil
+	}
+
+	output := inst.serialConsole
+	end := uint64(len(output))
+
+	start := uint64(0)
+	fromStart, hasFromStart := parse("from_start")
+	mostRecent, hasMostRecent := parse("most_recent")
+	switch {
+	case hasFromStart && hasMostRecent:
+		invalidRequest(w, "only one of from_start and most_recent may be set")
+		return
+	case hasFromStart:
+		start = min(fromStart, end)
+	case hasMostRecent:
+		start = end - min(mostRecent, end)
+	default:
+		invalidRequest(w, "one of from_start or most_recent is required")
+		return
+	}
+
+	if maxBytes, ok := parse("max_bytes"); ok {
+		end = min(end, start+maxBytes)
+	}
+
+	data := make([]int, 0, end-start)
+	for _, b := range output[start:end] {
+		data = append(data, int(b))
+	}
+
+	writeJSON(w, http.StatusOK, oxide.InstanceSerialConsoleData{
+		Data:           data,
+		LastByteOffset: &end,
+	})
+}
+
+// instanceSerialConsoleStream serves the serial console websocket of an
+// instance. It replays the requested amount of past output and records all
+// input the client sends.
+func (s *Server) instanceSerialConsoleStream(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("instance")
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	inst, ok := lookup(
+		s.instances,
+		nameOrID,
+		query.Get("project"),
+		instanceName,
+		instanceProject,
+	)
+	var output []byte
+	if ok {
+		output = inst.serialConsole
+		if mostRecent, err := strconv.ParseUint(query.Get("most_recent"), 10, 64); err == nil {
+			output = output[uint64(len(output))-min(mostRecent, uint64(len(output))):]
+		}
+		output = slices.Clone(output)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		notFound(w, "instance", nameOrID)
+		return
+	}
+
+	websocket.Server{Handler: func(conn *websocket.Conn) {
+		defer conn.Close()
+
+		if len(output) > 0 {
+			if err := websocket.Message.Send(conn, output); err != nil {
+				return
+			}
+		}
+
+		var guestInput *io.PipeWriter
+		if s.SerialConsoleGuest != nil {
+			var console serialConsoleStream
+			console.PipeReader, guestInput = io.Pipe()
+			console.output = func(p []byte) error {
+				s.mu.Lock()
+				inst.serialConsole = append(inst.serialConsole, p...)
+				s.mu.Unlock()
+
+				return websocket.Message.Send(conn, p)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				s.SerialConsoleGuest(&console)
+			}()
+			defer func() { <-done }()
+			defer guestInput.Close()
+		}
+
+		for {
+			var input []byte
+			if err := websocket.Message.Receive(conn, &input); err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			inst.serialConsoleInput = append(inst.serialConsoleInput, input...)
+			s.mu.Unlock()
+
+			if guestInput != nil {
+				if _, err := guestInput.Write(input); err != nil {
+					return
+				}
+			}
+		}
+	}}.ServeHTTP(w, r)
+}
+
+// serialConsoleStream is the console a [Server.SerialConsoleGuest] is attached
+// to. Reads return the input received over the stream and writes are sent as
+// output.
+type serialConsoleStream struct {
+	*io.PipeReader
+
+	mu     sync.Mutex
+	output func(p []byte) error
+}
+
+func (c *serialConsoleStream) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.output(slices.Clone(p)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (s *Server) diskView(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("disk")
+
+	disk, ok := lookup(s.disks, nameOrID, r.URL.Query().Get("project"), diskName, diskProject)
+	if !ok {
+		notFound(w, "disk", nameOrID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, disk)
+}
+
+func (s *Server) diskDelete(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("disk")
+
+	disk, ok := lookup(s.disks, nameOrID, r.URL.Query().Get("project"), diskName, diskProject)
+	if !ok {
+		notFound(w, "disk", nameOrID)
+		return
+	}
+
+	switch disk.State.State() {
+	case oxide.DiskStateStateDetached, oxide.DiskStateStateImportReady:
+	default:
+		invalidRequest(w, "disk %q cannot be deleted while %s", disk.Name, disk.State.State())
+		return
+	}
+
+	delete(s.disks, disk.Id)
+	delete(s.contents, disk.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) diskCreate(w http.ResponseWriter, r *http.Request) {
+	project := r.URL.Query().Get("project")
+
+	var body oxide.DiskCreate
+	if !decode(w, r, &body) {
+		return
+	}
+
+	if _, ok := lookup(s.disks, string(body.Name), project, diskName, diskProject); ok {
+		alreadyExists(w, "disk", body.Name)
+		return
+	}
+
+	disk := &oxide.Disk{
+		BlockSize:    4096,
+		Description:  body.Description,
+		Id:           uuid.TimeOrderedUUID(),
+		Name:         body.Name,
+		ProjectId:    project,
+		Size:         body.Size,
+		State:        oxide.DiskState{Value: &oxide.DiskStateDetached{}},
+		TimeCreated:  now(),
+		TimeModified: now(),
+	}
+
+	backend, ok := body.DiskBackend.Value.(*oxide.DiskBackendDistributed)
+	if !ok {
+		invalidRequest(w, "unsupported disk backend %q", body.DiskBackend.Type())
+		return
+	}
+
+	switch src := backend.DiskSource.Value.(type) {
+	case *oxide.DiskSourceBlank:
+		disk.BlockSize = src.BlockSize
+	case *oxide.DiskSourceImportingBlocks:
+		disk.BlockSize = src.BlockSize
+		disk.State = oxide.DiskState{Value: &oxide.DiskStateImportReady{}}
+	case *oxide.DiskSourceImage:
+		image, ok := s.images[src.ImageId]
+		if !ok {
+			notFound(w, "image", src.ImageId)
+			return
+		}
+		disk.BlockSize = image.BlockSize
+		disk.ImageId = image.Id
+	default:
+		invalidRequest(w, "unsupported disk source %q", backend.DiskSource.Type())
+		return
+	}
+
+	if disk.Size%(1024*1024*1024) != 0 {
+		invalidRequest(w, "disk size %d must be a multiple of 1 GiB", disk.Size)
+		return
+	}
+
+	s.disks[disk.Id] = disk
+	s.copyContents(disk.ImageId, disk.Id)
+
+	writeJSON(w, http.StatusCreated, disk)
+}
+
+// importingDisk looks up the disk of a bulk import request, writing an error
+// response and returning false unless it's in state.
+func (s *Server) importingDisk(
+	w http.ResponseWriter,
+	r *http.Request,
+	state oxide.DiskStateState,
+) (*oxide.Disk, bool) {
+	nameOrID := r.PathValue("disk")
+
+	disk, ok := lookup(s.disks, nameOrID, r.URL.Query().Get("project"), diskName, diskProject)
+	if !ok {
+		notFound(w, "disk", nameOrID)
+		return nil, false
+	}
+
+	if disk.State.State() != state {
+		invalidRequest(w, "disk %q is %s rather than %s", disk.Name, disk.State.State(), state)
+		return nil, false
+	}
+
+	return disk, true
+}
+
+func (s *Server) diskBulkWriteImportStart(w http.ResponseWriter, r *http.Request) {
+	disk, ok := s.importingDisk(w, r, oxide.DiskStateStateImportReady)
+	if !ok {
+		return
+	}
+
+	disk.State = oxide.DiskState{Value: &oxide.DiskStateImportingFromBulkWrites{}}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) diskBulkWriteImport(w http.ResponseWriter, r *http.Request) {
+	disk, ok := s.importingDisk(w, r, oxide.DiskStateStateImportingFromBulkWrites)
+	if !ok {
+		return
+	}
+
+	var body oxide.ImportBlocksBulkWrite
+	if !decode(w, r, &body) {
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(body.Base64EncodedData)
+	if err != nil {
+		invalidRequest(w, "invalid base64 encoded data: %v", err)
+		return
+	}
+
+	offset := *body.Offset
+	switch {
+	case len(data) > 512*1024:
+		invalidRequest(w, "bulk write of %d bytes exceeds 512 KiB", len(data))
+		return
+	case offset%uint64(disk.BlockSize) != 0 || uint64(len(data))%uint64(disk.BlockSize) != 0:
+		invalidRequest(w, "bulk write is not aligned to block size %d", disk.BlockSize)
+		return
+	case offset+uint64(len(data)) > uint64(disk.Size):
+		invalidRequest(w, "bulk write past the end of disk %q", disk.Name)
+		return
+	}
+
+	contents := s.contents[disk.Id]
+	if end := int(offset) + len(data); end > len(contents) {
+		contents = append(contents, make([]byte, end-len(contents))...)
+	}
+	copy(contents[offset:], data)
+	s.contents[disk.Id] = contents
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) diskBulkWriteImportStop(w http.ResponseWriter, r *http.Request) {
+	disk, ok := s.importingDisk(w, r, oxide.DiskStateStateImportingFromBulkWrites)
+	if !ok {
+		return
+	}
+
+	disk.State = oxide.DiskState{Value: &oxide.DiskStateImportReady{}}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) diskFinalizeImport(w http.ResponseWriter, r *http.Request) {
+	disk, ok := s.importingDisk(w, r, oxide.DiskStateStateImportReady)
+	if !ok {
+		return
+	}
+
+	var body oxide.FinalizeDisk
+	if !decode(w, r, &body) {
+		return
+	}
+
+	if body.SnapshotName != "" {
+		if _, ok := lookup(
+			s.snapshots,
+			string(body.SnapshotName),
+			disk.ProjectId,
+			snapshotName,
+			snapshotProject,
+		); ok {
+			alreadyExists(w, "snapshot", body.SnapshotName)
+			return
+		}
+
+		snapshot := &oxide.Snapshot{
+			Description:  disk.Description,
+			DiskId:       disk.Id,
+			Id:           uuid.TimeOrderedUUID(),
+			Name:         body.SnapshotName,
+			ProjectId:    disk.ProjectId,
+			Size:         disk.Size,
+			State:        oxide.SnapshotStateReady,
+			TimeCreated:  now(),
+			TimeModified: now(),
+		}
+		s.snapshots[snapshot.Id] = snapshot
+		s.copyContents(disk.Id, snapshot.Id)
+	}
+
+	disk.State = oxide.DiskState{Value: &oxide.DiskStateDetached{}}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// copyContents copies the data of the resource with ID from into the resource
+// with ID to.
+func (s *Server) copyContents(from, to string) {
+	if contents, ok := s.contents[from]; ok {
+		s.contents[to] = slices.Clone(contents)
+	}
+}
+
+func (s *Server) snapshotView(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("snapshot")
+
+	snapshot, ok := lookup(
+		s.snapshots,
+		nameOrID,
+		r.URL.Query().Get("project"),
+		snapshotName,
+		snapshotProject,
+	)
+	if !ok {
+		notFound(w, "snapshot", nameOrID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+func (s *Server) snapshotCreate(w http.ResponseWriter, r *http.Request) {
+	project := r.URL.Query().Get("project")
+
+	var body oxide.SnapshotCreate
+	if !decode(w, r, &body) {
+		return
+	}
+
+	if _, ok := lookup(s.snapshots, string(body.Name), project, snapshotName, snapshotProject); ok {
+		alreadyExists(w, "snapshot", body.Name)
+		return
+	}
+
+	disk, ok := lookup(s.disks, string(body.Disk), project, diskName, diskProject)
+	if !ok {
+		notFound(w, "disk", string(body.Disk))
+		return
+	}
+
+	snapshot := &oxide.Snapshot{
+		Description:  body.Description,
+		DiskId:       disk.Id,
+		Id:           uuid.TimeOrderedUUID(),
+		Name:         body.Name,
+		ProjectId:    project,
+		Size:         disk.Size,
+		State:        oxide.SnapshotStateReady,
+		TimeCreated:  now(),
+		TimeModified: now(),
+	}
+	s.snapshots[snapshot.Id] = snapshot
+	s.copyContents(disk.Id, snapshot.Id)
+
+	writeJSON(w, http.StatusCreated, snapshot)
+}
+
+func (s *Server) snapshotDelete(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("snapshot")
+
+	snapshot, ok := lookup(
+		s.snapshots,
+		nameOrID,
+		r.URL.Query().Get("project"),
+		snapshotName,
+		snapshotProject,
+	)
+	if !ok {
+		notFound(w, "snapshot", nameOrID)
+		return
+	}
+
+	delete(s.snapshots, snapshot.Id)
+	delete(s.contents, snapshot.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) floatingIPCreate(w http.ResponseWriter, r *http.Request) {
+	project := r.URL.Query().Get("project")
+
+	var body oxide.FloatingIpCreate
+	if !decode(w, r, &body) {
+		return
+	}
+
+	if _, ok := lookup(
+		s.floatingIPs,
+		string(body.Name),
+		project,
+		floatingIPName,
+		floatingIPProject,
+	); ok {
+		alreadyExists(w, "floating ip", body.Name)
+		return
+	}
+
+	var poolSelector oxide.PoolSelector
+	if v, ok := body.AddressAllocator.Value.(*oxide.AddressAllocatorAuto); ok {
+		poolSelector = v.PoolSelector
+	}
+
+	floatingIP := &oxide.FloatingIp{
+		Description:  body.Description,
+		Id:           uuid.TimeOrderedUUID(),
+		Ip:           s.allocateIP(poolSelector),
+		IpPoolId:     ipPoolID(poolSelector),
+		Name:         body.Name,
+		ProjectId:    project,
+		TimeCreated:  now(),
+		TimeModified: now(),
+	}
+	s.floatingIPs[floatingIP.Id] = floatingIP
+
+	writeJSON(w, http.StatusCreated, floatingIP)
+}
+
+func (s *Server) floatingIPView(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("floating_ip")
+
+	floatingIP, ok := lookup(
+		s.floatingIPs,
+		nameOrID,
+		r.URL.Query().Get("project"),
+		floatingIPName,
+		floatingIPProject,
+	)
+	if !ok {
+		notFound(w, "floating ip", nameOrID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, floatingIP)
+}
+
+func (s *Server) floatingIPDelete(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("floating_ip")
+
+	floatingIP, ok := lookup(
+		s.floatingIPs,
+		nameOrID,
+		r.URL.Query().Get("project"),
+		floatingIPName,
+		floatingIPProject,
+	)
+	if !ok {
+		notFound(w, "floating ip", nameOrID)
+		return
+	}
+
+	if floatingIP.InstanceId != "" {
+		invalidRequest(w, "floating ip %q cannot be deleted while attached", floatingIP.Name)
+		return
+	}
+
+	delete(s.floatingIPs, floatingIP.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) floatingIPDetach(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("floating_ip")
+
+	floatingIP, ok := lookup(
+		s.floatingIPs,
+		nameOrID,
+		r.URL.Query().Get("project"),
+		floatingIPName,
+		floatingIPProject,
+	)
+	if !ok {
+		notFound(w, "floating ip", nameOrID)
+		return
+	}
+
+	if floatingIP.InstanceId == "" {
+		invalidRequest(w, "floating ip %q is not attached", floatingIP.Name)
+		return
+	}
+
+	floatingIP.InstanceId = ""
+
+	writeJSON(w, http.StatusAccepted, floatingIP)
+}
+
+// allocateIP returns an unused external IP from the pool selected by
+// poolSelector. Pools automatically selected for IPv6 allocate IPv6 addresses.
+func (s *Server) allocateIP(poolSelector oxide.PoolSelector) string {
+	s.nextIP++
+
+	if v, ok := poolSelector.Value.(*oxide.PoolSelectorAuto); ok &&
+		v.IpVersion == oxide.IpVersionV6 {
+		return fmt.Sprintf("2001:db8::%x", s.nextIP)
+	}
+
+	return fmt.Sprintf("203.0.113.%d", s.nextIP)
+}
+
+// ipPoolID returns the ID of the IP pool selected by poolSelector.
+func ipPoolID(poolSelector oxide.PoolSelector) string {
+	if v, ok := poolSelector.Value.(*oxide.PoolSelectorExplicit); ok {
+		return string(v.Pool)
+	}
+
+	return "default"
+}
+
+func (s *Server) vpcFirewallRulesView(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	writeJSON(w, http.StatusOK, oxide.VpcFirewallRules{
+		Rules: append(
+			[]oxide.VpcFirewallRule{},
+			s.firewalls[firewallKey(query.Get("project"), query.Get("vpc"))]...,
+		),
+	})
+}
+
+func (s *Server) vpcFirewallRulesUpdate(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var body oxide.VpcFirewallRuleUpdateParams
+	if !decode(w, r, &body) {
+		return
+	}
+
+	names := make(map[oxide.Name]bool)
+	for _, rule := range body.Rules {
+		if names[rule.Name] {
+			invalidRequest(w, "firewall rule names must be unique: %q", rule.Name)
+			return
+		}
+		names[rule.Name] = true
+	}
+
+	rules := firewallRules(body.Rules)
+	s.firewalls[firewallKey(query.Get("project"), query.Get("vpc"))] = rules
+
+	writeJSON(w, http.StatusOK, oxide.VpcFirewallRules{Rules: rules})
+}
+
+// firewallKey returns the key of a VPC's firewall rules in [Server].
+func firewallKey(project, vpc string) string {
+	return project + "/" + vpc
+}
+
+// firewallRules returns the firewall rules created by a firewall rules update.
+func firewallRules(updates []oxide.VpcFirewallRuleUpdate) []oxide.VpcFirewallRule {
+	rules := make([]oxide.VpcFirewallRule, 0, len(updates))
+	for _, update := range updates {
+		rules = append(rules, oxide.VpcFirewallRule{
+			Action:       update.Action,
+			Description:  update.Description,
+			Direction:    update.Direction,
+			Filters:      update.Filters,
+			Id:           uuid.TimeOrderedUUID(),
+			Name:         update.Name,
+			Priority:     update.Priority,
+			Status:       update.Status,
+			Targets:      update.Targets,
+			TimeCreated:  now(),
+			TimeModified: now(),
+		})
+	}
+
+	return rules
+}
+
+func (s *Server) vpcCreate(w http.ResponseWriter, r *http.Request) {
+	project := r.URL.Query().Get("project")
+
+	var body oxide.VpcCreate
+	if !decode(w, r, &body) {
+		return
+	}
+
+	if _, ok := lookup(s.vpcs, string(body.Name), project, vpcName, vpcProject); ok {
+		alreadyExists(w, "vpc", body.Name)
+		return
+	}
+
+	vpc := &oxide.Vpc{
+		Description:    body.Description,
+		DnsName:        body.DnsName,
+		Id:             uuid.TimeOrderedUUID(),
+		Ipv6Prefix:     "fd00:1122:3344::/48",
+		Name:           body.Name,
+		ProjectId:      project,
+		SystemRouterId: uuid.TimeOrderedUUID(),
+		TimeCreated:    now(),
+		TimeModified:   now(),
+	}
+	s.vpcs[vpc.Id] = vpc
+
+	// Like Oxide, new VPCs have a default subnet and firewall rules.
+	subnet := &oxide.VpcSubnet{
+		Description:  "The default subnet for " + string(vpc.Name),
+		Id:           uuid.TimeOrderedUUID(),
+		Ipv4Block:    "172.30.0.0/22",
+		Ipv6Block:    "fd00:1122:3344:1::/64",
+		Name:         "default",
+		TimeCreated:  now(),
+		TimeModified: now(),
+		VpcId:        vpc.Id,
+	}
+	s.subnets[subnet.Id] = subnet
+
+	s.firewalls[firewallKey(project, string(vpc.Name))] = firewallRules(
+		[]oxide.VpcFirewallRuleUpdate{
+			{
+				Action:      oxide.VpcFirewallRuleActionAllow,
+				Description: "allow inbound SSH from anywhere",
+				Direction:   oxide.VpcFirewallRuleDirectionInbound,
+				Filters: oxide.VpcFirewallRuleFilter{
+					Ports: []oxide.L4PortRange{"22"},
+					Protocols: []oxide.VpcFirewallRuleProtocol{
+						{Value: &oxide.VpcFirewallRuleProtocolTcp{}},
+					},
+				},
+				Name:     "allow-ssh",
+				Priority: oxide.NewPointer(65534),
+				Status:   oxide.VpcFirewallRuleStatusEnabled,
+				Targets: []oxide.VpcFirewallRuleTarget{
+					{Value: &oxide.VpcFirewallRuleTargetVpc{Value: vpc.Name}},
+				},
+			},
+		},
+	)
+
+	writeJSON(w, http.StatusCreated, vpc)
+}
+
+func (s *Server) vpcDelete(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("vpc")
+	project := r.URL.Query().Get("project")
+
+	vpc, ok := lookup(s.vpcs, nameOrID, project, vpcName, vpcProject)
+	if !ok {
+		notFound(w, "vpc", nameOrID)
+		return
+	}
+
+	for _, subnet := range s.subnets {
+		if subnet.VpcId == vpc.Id {
+			invalidRequest(w, "VPC cannot be deleted while VPC Subnets exist")
+			return
+		}
+	}
+
+	delete(s.vpcs, vpc.Id)
+	delete(s.firewalls, firewallKey(vpc.ProjectId, string(vpc.Name)))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) vpcSubnetList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	vpc, ok := lookup(s.vpcs, query.Get("vpc"), query.Get("project"), vpcName, vpcProject)
+	if !ok {
+		notFound(w, "vpc", query.Get("vpc"))
+		return
+	}
+
+	subnets := []oxide.VpcSubnet{}
+	for _, subnet := range s.subnets {
+		if subnet.VpcId == vpc.Id {
+			subnets = append(subnets, *subnet)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, oxide.VpcSubnetResultsPage{Items: subnets})
+}
+
+func (s *Server) vpcSubnetCreate(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var body oxide.VpcSubnetCreate
+	if !decode(w, r, &body) {
+		return
+	}
+
+	vpc, ok := lookup(s.vpcs, query.Get("vpc"), query.Get("project"), vpcName, vpcProject)
+	if !ok {
+		notFound(w, "vpc", query.Get("vpc"))
+		return
+	}
+
+	if _, ok := lookup(s.subnets, string(body.Name), vpc.Id, subnetName, subnetVPC); ok {
+		alreadyExists(w, "vpc subnet", body.Name)
+		return
+	}
+
+	subnet := &oxide.VpcSubnet{
+		Description:  body.Description,
+		Id:           uuid.TimeOrderedUUID(),
+		Ipv4Block:    body.Ipv4Block,
+		Ipv6Block:    cmp.Or(body.Ipv6Block, "fd00:1122:3344:2::/64"),
+		Name:         body.Name,
+		TimeCreated:  now(),
+		TimeModified: now(),
+		VpcId:        vpc.Id,
+	}
+	s.subnets[subnet.Id] = subnet
+
+	writeJSON(w, http.StatusCreated, subnet)
+}
+
+func (s *Server) vpcSubnetDelete(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("subnet")
+	query := r.URL.Query()
+
+	subnet, ok := s.subnets[nameOrID]
+	if !ok {
+		vpc, vpcOK := lookup(s.vpcs, query.Get("vpc"), query.Get("project"), vpcName, vpcProject)
+		if vpcOK {
+			subnet, ok = lookup(s.subnets, nameOrID, vpc.Id, subnetName, subnetVPC)
+		}
+	}
+	if !ok {
+		notFound(w, "vpc subnet", nameOrID)
+		return
+	}
+
+	delete(s.subnets, subnet.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) sshKeyCreate(w http.ResponseWriter, r *http.Request) {
+	var body oxide.SshKeyCreate
+	if !decode(w, r, &body) {
+		return
+	}
+
+	if _, ok := lookup(s.sshKeys, string(body.Name), "", sshKeyName, sshKeyProject); ok {
+		alreadyExists(w, "ssh key", body.Name)
+		return
+	}
+
+	sshKey := &oxide.SshKey{
+		Description:  body.Description,
+		Id:           uuid.TimeOrderedUUID(),
+		Name:         body.Name,
+		PublicKey:    body.PublicKey,
+		TimeCreated:  now(),
+		TimeModified: now(),
+	}
+	s.sshKeys[sshKey.Id] = sshKey
+
+	writeJSON(w, http.StatusCreated, sshKey)
+}
+
+func (s *Server) sshKeyDelete(w http.ResponseWriter, r *http.Request) {
+	nameOrID := r.PathValue("ssh_key")
+
+	sshKey, ok := lookup(s.sshKeys, nameOrID, "", sshKeyName, sshKeyProject)
+	if !ok {
+		notFound(w, "ssh key", nameOrID)
+		return
+	}
+
+	delete(s.sshKeys, sshKey.Id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
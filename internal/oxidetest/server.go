@@ -0,0 +1,507 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package oxidetest provides an in-memory fake of the Oxide API for use in
+// tests. The fake keeps state between requests so that plugin components can be
+// exercised end to end without a rack, and it can inject faults into any
+// operation to test error handling and cleanup paths.
+package oxidetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
+	"github.com/oxidecomputer/oxide.go/oxide"
+)
+
+// Token is the API token accepted by [Server].
+const Token = "oxidetest-token"
+
+// Fault describes an error response that [Server] returns in place of handling
+// a request.
+type Fault struct {
+	// HTTP status code of the response. Defaults to 500.
+	StatusCode int
+
+	// Oxide error code of the response (e.g., `ObjectNotFound`). Defaults to
+	// `Internal`.
+	ErrorCode string
+
+	// Message of the response. Defaults to a message naming the operation.
+	Message string
+
+	// Number of requests for the operation to handle normally before the fault
+	// is returned, such as to fail the second of two calls. Defaults to 0.
+	After int
+}
+
+// fault is a [Fault] registered against an operation along with the number of
+// requests it should still be returned for.
+type fault struct {
+	Fault
+	remaining int
+}
+
+// instance is an Oxide instance along with the fake's bookkeeping for it.
+type instance struct {
+	oxide.Instance
+
+	// Run states the instance will move through on subsequent views.
+	pending []oxide.InstanceState
+
+	// External IPs attached to the instance.
+	externalIPs []oxide.ExternalIp
+
+	// Network interfaces attached to the instance.
+	networkInterfaces []oxide.InstanceNetworkInterface
+
+	// Output written to the instance's serial console.
+	serialConsole []byte
+
+	// Input received from serial console stream connections.
+	serialConsoleInput []byte
+}
+
+// Server is a stateful, in-memory fake of the Oxide API backed by
+// [httptest.Server]. The zero value is not usable; create one with
+// [NewServer].
+type Server struct {
+	// URL of the fake, suitable for use with [oxide.WithHost].
+	URL string
+
+	// Run states an instance moves through after creation. The first state is
+	// returned by InstanceCreate and each subsequent InstanceView advances to the
+	// next state. Defaults to `starting` followed by `running`.
+	StartStates []oxide.InstanceState
+
+	// Run states an instance moves through after InstanceStop, following the
+	// same rules as StartStates. Defaults to `stopping` followed by `stopped`.
+	StopStates []oxide.InstanceState
+
+	// Serial console output of an instance once it's created.
+	SerialConsoleOutput string
+
+	// Guest attached to serial console stream connections, such as
+	// [ShellGuest]. It reads the input sent over the connection and its writes
+	// are sent as output and appended to the instance's serial console. It
+	// should return once reading fails. When nil, input is only recorded.
+	SerialConsoleGuest func(console io.ReadWriter)
+
+	server *httptest.Server
+
+	mu          sync.Mutex
+	calls       map[string]int
+	faults      map[string][]*fault
+	images      map[string]*oxide.Image
+	instances   map[string]*instance
+	disks       map[string]*oxide.Disk
+	snapshots   map[string]*oxide.Snapshot
+	sshKeys     map[string]*oxide.SshKey
+	floatingIPs map[string]*oxide.FloatingIp
+	firewalls   map[string][]oxide.VpcFirewallRule
+	vpcs        map[string]*oxide.Vpc
+	subnets     map[string]*oxide.VpcSubnet
+	contents    map[string][]byte
+	nextIP      int
+}
+
+// NewServer starts a fake Oxide API server and registers its shutdown with t.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		StartStates: []oxide.InstanceState{
+			oxide.InstanceStateStarting,
+			oxide.InstanceStateRunning,
+		},
+		StopStates: []oxide.InstanceState{
+			oxide.InstanceStateStopping,
+			oxide.InstanceStateStopped,
+		},
+		calls:       make(map[string]int),
+		faults:      make(map[string][]*fault),
+		images:      make(map[string]*oxide.Image),
+		instances:   make(map[string]*instance),
+		disks:       make(map[string]*oxide.Disk),
+		snapshots:   make(map[string]*oxide.Snapshot),
+		sshKeys:     make(map[string]*oxide.SshKey),
+		floatingIPs: make(map[string]*oxide.FloatingIp),
+		firewalls:   make(map[string][]oxide.VpcFirewallRule),
+		vpcs:        make(map[string]*oxide.Vpc),
+		subnets:     make(map[string]*oxide.VpcSubnet),
+		contents:    make(map[string][]byte),
+	}
+
+	s.server = httptest.NewServer(s.routes())
+	s.URL = s.server.URL
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// Client returns an Oxide client configured to talk to the fake.
+func (s *Server) Client(t testing.TB) *oxide.Client {
+	t.Helper()
+
+	client, err := oxide.NewClient(oxide.WithHost(s.URL), oxide.WithToken(Token))
+	if err != nil {
+		t.Fatalf("failed creating oxide client: %v", err)
+	}
+
+	return client
+}
+
+// Fail makes the next n requests for operation return f. The operation is the
+// name of the corresponding [oxide.Client] method (e.g., `InstanceCreate`). A
+// negative n fails every subsequent request.
+func (s *Server) Fail(operation string, n int, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults[operation] = append(s.faults[operation], &fault{Fault: f, remaining: n})
+}
+
+// Calls returns the number of requests received for operation, including those
+// that were failed by an injected [Fault].
+func (s *Server) Calls(operation string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[operation]
+}
+
+// CreateImage seeds the fake with an image. An empty project creates a silo
+// image.
+func (s *Server) CreateImage(project string, image oxide.Image) oxide.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	if image.Id == "" {
+		image.Id = uuid.TimeOrderedUUID()
+	}
+	if image.BlockSize == 0 {
+		image.BlockSize = 4096
+	}
+	if image.TimeCreated == nil {
+		image.TimeCreated = &now
+	}
+	if image.TimeModified == nil {
+		image.TimeModified = &now
+	}
+	image.ProjectId = project
+	s.images[image.Id] = &image
+
+	return image
+}
+
+// Images returns the images known to the fake.
+func (s *Server) Images() []oxide.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return values(s.images, func(v *oxide.Image) oxide.Image { return *v })
+}
+
+// Instances returns the instances known to the fake.
+func (s *Server) Instances() []oxide.Instance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return values(s.instances, func(v *instance) oxide.Instance { return v.Instance })
+}
+
+// Disks returns the disks known to the fake.
+func (s *Server) Disks() []oxide.Disk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return values(s.disks, func(v *oxide.Disk) oxide.Disk { return *v })
+}
+
+// CreateDisk seeds the fake with a detached disk in project.
+func (s *Server) CreateDisk(project string, disk oxide.Disk) oxide.Disk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if disk.Id == "" {
+		disk.Id = uuid.TimeOrderedUUID()
+	}
+	if disk.BlockSize == 0 {
+		disk.BlockSize = 4096
+	}
+	if disk.State.Value == nil {
+		disk.State = oxide.DiskState{Value: &oxide.DiskStateDetached{}}
+	}
+	if disk.TimeCreated == nil {
+		disk.TimeCreated = now()
+	}
+	if disk.TimeModified == nil {
+		disk.TimeModified = now()
+	}
+	disk.ProjectId = project
+	s.disks[disk.Id] = &disk
+
+	return disk
+}
+
+// Contents returns the data of a disk, snapshot, or image, as written through
+// bulk imports and copied between resources. Data past the last write is
+// omitted since disks start out zeroed.
+func (s *Server) Contents(id string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.contents[id])
+}
+
+// Snapshots returns the snapshots known to the fake.
+func (s *Server) Snapshots() []oxide.Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return values(s.snapshots, func(v *oxide.Snapshot) oxide.Snapshot { return *v })
+}
+
+// CreateSnapshot seeds the fake with a ready snapshot in project.
+func (s *Server) CreateSnapshot(project string, snapshot oxide.Snapshot) oxide.Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if snapshot.Id == "" {
+		snapshot.Id = uuid.TimeOrderedUUID()
+	}
+	if snapshot.State == "" {
+		snapshot.State = oxide.SnapshotStateReady
+	}
+	if snapshot.TimeCreated == nil {
+		snapshot.TimeCreated = now()
+	}
+	if snapshot.TimeModified == nil {
+		snapshot.TimeModified = now()
+	}
+	snapshot.ProjectId = project
+	s.snapshots[snapshot.Id] = &snapshot
+
+	return snapshot
+}
+
+// SSHKeys returns the SSH public keys known to the fake.
+func (s *Server) SSHKeys() []oxide.SshKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return values(s.sshKeys, func(v *oxide.SshKey) oxide.SshKey { return *v })
+}
+
+// CreateFloatingIP seeds the fake with a floating IP in project.
+func (s *Server) CreateFloatingIP(project string, floatingIP oxide.FloatingIp) oxide.FloatingIp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if floatingIP.Id == "" {
+		floatingIP.Id = uuid.TimeOrderedUUID()
+	}
+	if floatingIP.Ip == "" {
+		floatingIP.Ip = s.allocateIP(oxide.PoolSelector{})
+	}
+	if floatingIP.TimeCreated == nil {
+		floatingIP.TimeCreated = now()
+	}
+	if floatingIP.TimeModified == nil {
+		floatingIP.TimeModified = now()
+	}
+	floatingIP.ProjectId = project
+	s.floatingIPs[floatingIP.Id] = &floatingIP
+
+	return floatingIP
+}
+
+// FloatingIPs returns the floating IPs known to the fake.
+func (s *Server) FloatingIPs() []oxide.FloatingIp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return values(s.floatingIPs, func(v *oxide.FloatingIp) oxide.FloatingIp { return *v })
+}
+
+// SetFirewallRules replaces the firewall rules of a VPC in project.
+func (s *Server) SetFirewallRules(project, vpc string, rules []oxide.VpcFirewallRuleUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.firewalls[firewallKey(project, vpc)] = firewallRules(rules)
+}
+
+// FirewallRules returns the firewall rules of a VPC in project.
+func (s *Server) FirewallRules(project, vpc string) []oxide.VpcFirewallRule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.firewalls[firewallKey(project, vpc)])
+}
+
+// VPCs returns the VPCs known to the fake.
+func (s *Server) VPCs() []oxide.Vpc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return values(s.vpcs, func(v *oxide.Vpc) oxide.Vpc { return *v })
+}
+
+// Subnets returns the VPC subnets known to the fake.
+func (s *Server) Subnets() []oxide.VpcSubnet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return values(s.subnets, func(v *oxide.VpcSubnet) oxide.VpcSubnet { return *v })
+}
+
+// SetInstanceState forces the run state of an instance, discarding any pending
+// transitions.
+func (s *Server) SetInstanceState(id string, state oxide.InstanceState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if inst, ok := s.instances[id]; ok {
+		inst.RunState = state
+		inst.pending = nil
+	}
+}
+
+// WriteSerialConsole appends data to the serial console output of an
+// instance.
+func (s *Server) WriteSerialConsole(id string, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if inst, ok := s.instances[id]; ok {
+		inst.serialConsole = append(inst.serialConsole, data...)
+	}
+}
+
+// SerialConsoleInput returns the input an instance received over serial
+// console stream connections.
+func (s *Server) SerialConsoleInput(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if inst, ok := s.instances[id]; ok {
+		return string(inst.serialConsoleInput)
+	}
+
+	return ""
+}
+
+// handle wraps an operation's handler to authenticate the request, record the
+// call, and return any injected fault. The handler is called with the server
+// lock held.
+func (s *Server) handle(
+	operation string,
+	h func(w http.ResponseWriter, r *http.Request),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.admit(operation, w, r) {
+			h(w, r)
+		}
+	}
+}
+
+// handleStream is like [Server.handle] but calls the handler without the server
+// lock held, for long-lived connections.
+func (s *Server) handleStream(
+	operation string,
+	h func(w http.ResponseWriter, r *http.Request),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		ok := s.admit(operation, w, r)
+		s.mu.Unlock()
+
+		if ok {
+			h(w, r)
+		}
+	}
+}
+
+// admit authenticates the request, records the call, and writes any injected
+// fault. It reports whether the request should be handled. It must be called
+// with the server lock held.
+func (s *Server) admit(operation string, w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") != "Bearer "+Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", "credentials missing or invalid")
+		return false
+	}
+
+	s.calls[operation]++
+
+	for i, f := range s.faults[operation] {
+		if f.remaining == 0 {
+			continue
+		}
+		if f.After > 0 {
+			f.After--
+			continue
+		}
+		if f.remaining > 0 {
+			f.remaining--
+		}
+		if f.remaining == 0 {
+			s.faults[operation] = slices.Delete(s.faults[operation], i, i+1)
+		}
+
+		status, code, message := f.StatusCode, f.ErrorCode, f.Message
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		if code == "" {
+			code = "Internal"
+		}
+		if message == "" {
+			message = fmt.Sprintf("injected fault for %s", operation)
+		}
+		writeError(w, status, code, message)
+		return false
+	}
+
+	return true
+}
+
+// writeJSON writes v as the JSON response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an Oxide API error response.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, oxide.ErrorResponse{
+		ErrorCode: code,
+		Message:   message,
+		RequestId: uuid.TimeOrderedUUID(),
+	})
+}
+
+// values returns the values of m converted by fn, ordered by ID.
+func values[T any, V any](m map[string]*T, fn func(*T) V) []V {
+	keys := slices.Sorted(maps.Keys(m))
+	res := make([]V, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, fn(m[k]))
+	}
+	return res
+}
@@ -0,0 +1,301 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package qcow2 reads the guest data of qcow2 disk images, the format used by
+// QEMU. Only standalone images are supported: images with a backing file,
+// encryption, an external data file, extended L2 entries, or zstd compression
+// are rejected.
+//
+// See https://gitlab.com/qemu-project/qemu/-/blob/master/docs/interop/qcow2.txt
+// for the format.
+package qcow2
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// magic is the first 4 bytes of every qcow2 image.
+var magic = []byte{'Q', 'F', 'I', 0xfb}
+
+// Incompatible feature bits of version 3 images.
+const (
+	featureDirty            = 1 << 0
+	featureCorrupt          = 1 << 1
+	featureExternalDataFile = 1 << 2
+	featureCompressionType  = 1 << 3
+	featureExtendedL2       = 1 << 4
+)
+
+// Bits of L1 and L2 table entries.
+const (
+	offsetMask     = 0x00fffffffffffe00
+	flagCompressed = 1 << 62
+	flagZero       = 1 << 0
+)
+
+// Limits that keep a malformed header from causing huge allocations.
+const (
+	minClusterBits = 9
+	maxClusterBits = 21
+	maxL1Size      = 32 * 1024 * 1024
+)
+
+// Detect returns whether the data read from r starts with the qcow2 magic.
+func Detect(r io.ReaderAt) (bool, error) {
+	buf := make([]byte, len(magic))
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return bytes.Equal(buf, magic), nil
+}
+
+// Image is a qcow2 image whose guest data can be read with [Image.ReadAt].
+// Unallocated and zeroed clusters read as zeros.
+type Image struct {
+	r io.ReaderAt
+
+	clusterBits uint32
+	clusterSize int64
+	size        int64
+	l1          []uint64
+
+	// mu guards the caches of the last L2 table and the last compressed cluster
+	// read, which suit sequential reads.
+	mu         sync.Mutex
+	l2Offset   uint64
+	l2         []uint64
+	clusterOff uint64
+	cluster    []byte
+}
+
+// Open reads the header and L1 table of the qcow2 image read from r.
+func Open(r io.ReaderAt) (*Image, error) {
+	header := make([]byte, 104)
+	if _, err := r.ReadAt(header[:72], 0); err != nil {
+		return nil, fmt.Errorf("failed reading header: %w", err)
+	}
+
+	if !bytes.Equal(header[:4], magic) {
+		return nil, errors.New("not a qcow2 image")
+	}
+
+	version := binary.BigEndian.Uint32(header[4:])
+	if version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported qcow2 version %d", version)
+	}
+
+	if binary.BigEndian.Uint64(header[8:]) != 0 {
+		return nil, errors.New("qcow2 images with a backing file are not supported")
+	}
+
+	if binary.BigEndian.Uint32(header[32:]) != 0 {
+		return nil, errors.New("encrypted qcow2 images are not supported")
+	}
+
+	if version == 3 {
+		if _, err := r.ReadAt(header[72:], 72); err != nil {
+			return nil, fmt.Errorf("failed reading header: %w", err)
+		}
+
+		features := binary.BigEndian.Uint64(header[72:])
+		switch {
+		case features&featureCorrupt != 0:
+			return nil, errors.New("qcow2 image is marked corrupt")
+		case features&featureExternalDataFile != 0:
+			return nil, errors.New("qcow2 images with an external data file are not supported")
+		case features&featureExtendedL2 != 0:
+			return nil, errors.New("qcow2 images with extended L2 entries are not supported")
+		case features&^(featureDirty|featureCompressionType) != 0:
+			return nil, fmt.Errorf("unsupported qcow2 incompatible features %#x", features)
+		}
+
+		// The compression type field is only present in longer headers, and is
+		// only set to something other than zlib along with its feature bit.
+		if features&featureCompressionType != 0 {
+			compression := make([]byte, 1)
+			if _, err := r.ReadAt(compression, 104); err != nil {
+				return nil, fmt.Errorf("failed reading header: %w", err)
+			}
+			if compression[0] != 0 {
+				return nil, errors.New("qcow2 images compressed with zstd are not supported")
+			}
+		}
+	}
+
+	clusterBits := binary.BigEndian.Uint32(header[20:])
+	if clusterBits < minClusterBits || clusterBits > maxClusterBits {
+		return nil, fmt.Errorf("invalid qcow2 cluster bits %d", clusterBits)
+	}
+
+	size := binary.BigEndian.Uint64(header[24:])
+	if size > 1<<62 {
+		return nil, fmt.Errorf("invalid qcow2 size %d", size)
+	}
+
+	img := &Image{
+		r:           r,
+		clusterBits: clusterBits,
+		clusterSize: 1 << clusterBits,
+		size:        int64(size),
+	}
+
+	// Each L1 entry points to an L2 table that maps a cluster's worth of
+	// entries, so the L1 table must cover every cluster of the image.
+	l1Size := binary.BigEndian.Uint32(header[36:])
+	l2Span := uint64(img.clusterSize) * uint64(img.clusterSize/8)
+	if l1Size > maxL1Size || uint64(l1Size)*l2Span < size {
+		return nil, fmt.Errorf("invalid qcow2 L1 table size %d", l1Size)
+	}
+
+	l1, err := img.readTable(binary.BigEndian.Uint64(header[40:]), int(l1Size))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading L1 table: %w", err)
+	}
+	img.l1 = l1
+
+	return img, nil
+}
+
+// Size returns the size of the image's guest data in bytes.
+func (img *Image) Size() int64 {
+	return img.size
+}
+
+// ReadAt reads len(p) bytes of guest data starting at off.
+func (img *Image) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	img.mu.Lock()
+	defer img.mu.Unlock()
+
+	var n int
+	for n < len(p) {
+		if off >= img.size {
+			return n, io.EOF
+		}
+
+		inCluster := off & (img.clusterSize - 1)
+		length := min(int64(len(p)-n), img.clusterSize-inCluster, img.size-off)
+
+		if err := img.readCluster(p[n:n+int(length)], off, inCluster); err != nil {
+			return n, err
+		}
+
+		n += int(length)
+		off += length
+	}
+
+	return n, nil
+}
+
+// readCluster fills p with the guest data at off, which is inCluster bytes into
+// its cluster. p must not extend past the end of the cluster.
+func (img *Image) readCluster(p []byte, off int64, inCluster int64) error {
+	entry, err := img.l2Entry(uint64(off) >> img.clusterBits)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case entry&flagCompressed != 0:
+		cluster, err := img.compressedCluster(entry)
+		if err != nil {
+			return fmt.Errorf("failed reading compressed cluster at offset %d: %w", off, err)
+		}
+		copy(p, cluster[inCluster:])
+
+	case entry&flagZero != 0, entry&offsetMask == 0:
+		clear(p)
+
+	default:
+		hostOffset := int64(entry&offsetMask) + inCluster
+		if _, err := img.r.ReadAt(p, hostOffset); err != nil {
+			return fmt.Errorf("failed reading cluster at offset %d: %w", off, err)
+		}
+	}
+
+	return nil
+}
+
+// l2Entry returns the L2 table entry of a guest cluster, or zero when its L2
+// table isn't allocated.
+func (img *Image) l2Entry(cluster uint64) (uint64, error) {
+	entries := uint64(img.clusterSize / 8)
+
+	l2Offset := img.l1[cluster/entries] & offsetMask
+	if l2Offset == 0 {
+		return 0, nil
+	}
+
+	if img.l2 == nil || img.l2Offset != l2Offset {
+		l2, err := img.readTable(l2Offset, int(entries))
+		if err != nil {
+			return 0, fmt.Errorf("failed reading L2 table: %w", err)
+		}
+		img.l2Offset = l2Offset
+		img.l2 = l2
+	}
+
+	return img.l2[cluster%entries], nil
+}
+
+// compressedCluster returns the decompressed data of the cluster that a
+// compressed L2 entry points to.
+func (img *Image) compressedCluster(entry uint64) ([]byte, error) {
+	// The entry holds the host offset in its low bits followed by the number of
+	// additional 512-byte sectors the compressed data spans.
+	offsetBits := 62 - (img.clusterBits - 8)
+	hostOffset := entry & (1<<offsetBits - 1)
+	sectors := (entry>>offsetBits)&(1<<(img.clusterBits-8)-1) + 1
+
+	if img.cluster != nil && img.clusterOff == hostOffset {
+		return img.cluster, nil
+	}
+
+	// The compressed data ends within the last sector, which may extend past
+	// the end of the file.
+	compressed := make([]byte, sectors*512-hostOffset%512)
+	n, err := img.r.ReadAt(compressed, int64(hostOffset))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	cluster := make([]byte, img.clusterSize)
+	r := flate.NewReader(bytes.NewReader(compressed[:n]))
+	if _, err := io.ReadFull(r, cluster); err != nil {
+		return nil, fmt.Errorf("failed decompressing: %w", err)
+	}
+
+	img.clusterOff = hostOffset
+	img.cluster = cluster
+
+	return cluster, nil
+}
+
+// readTable reads a table of n big-endian 64-bit entries at offset.
+func (img *Image) readTable(offset uint64, n int) ([]uint64, error) {
+	buf := make([]byte, n*8)
+	if _, err := img.r.ReadAt(buf, int64(offset)); err != nil {
+		return nil, err
+	}
+
+	table := make([]uint64, n)
+	for i := range table {
+		table[i] = binary.BigEndian.Uint64(buf[i*8:])
+	}
+
+	return table, nil
+}
@@ -0,0 +1,323 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package qcow2_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/oxidecomputer/packer-plugin-oxide/internal/qcow2"
+)
+
+// clusterBits is the cluster size of the images written by [newTestImage],
+// which is the default of qemu-img.
+const clusterBits = 16
+
+const clusterSize = 1 << clusterBits
+
+// Offsets of the L1 and L2 tables and the uncompressed data cluster in the
+// images written by [newTestImage].
+const l1Offset, l2Offset, dataOffset = 1 * clusterSize, 2 * clusterSize, 3 * clusterSize
+
+// testData is the guest data of the images written by [newTestImage]. Its
+// clusters are allocated, zero flagged, unallocated, and compressed, in order.
+var testData = slices.Concat(
+	bytes.Repeat([]byte("a"), clusterSize),
+	make([]byte, 2*clusterSize),
+	bytes.Repeat([]byte("c"), clusterSize),
+)
+
+// newTestImage returns a version 3 qcow2 image of [testData]. Its compressed
+// cluster is the last thing in the file and doesn't start on a sector, so its
+// last sector extends past the end of the file, as in images qemu-img writes.
+func newTestImage(t *testing.T) []byte {
+	t.Helper()
+
+	file := make([]byte, dataOffset+clusterSize)
+
+	copy(file, "QFI\xfb")
+	binary.BigEndian.PutUint32(file[4:], 3)
+	binary.BigEndian.PutUint32(file[20:], clusterBits)
+	binary.BigEndian.PutUint64(file[24:], uint64(len(testData)))
+	binary.BigEndian.PutUint32(file[36:], 1)
+	binary.BigEndian.PutUint64(file[40:], l1Offset)
+	binary.BigEndian.PutUint32(file[96:], 4)
+	binary.BigEndian.PutUint32(file[100:], 104)
+
+	binary.BigEndian.PutUint64(file[l1Offset:], l2Offset|1<<63)
+
+	copy(file[dataOffset:], testData[:clusterSize])
+	binary.BigEndian.PutUint64(file[l2Offset:], dataOffset|1<<63)
+	binary.BigEndian.PutUint64(file[l2Offset+8:], 1)
+
+	var compressed bytes.Buffer
+	w, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		t.Fatalf("failed creating compressor: %v", err)
+	}
+	if _, err := w.Write(testData[3*clusterSize:]); err != nil {
+		t.Fatalf("failed compressing cluster: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed compressing cluster: %v", err)
+	}
+
+	offset := uint64(len(file)) + 100
+	sectors := (offset%512 + uint64(compressed.Len()) + 511) / 512
+	offsetBits := 62 - (clusterBits - 8)
+	binary.BigEndian.PutUint64(
+		file[l2Offset+3*8:],
+		1<<62|(sectors-1)<<offsetBits|offset,
+	)
+
+	file = append(file, make([]byte, 100)...)
+	return append(file, compressed.Bytes()...)
+}
+
+// TestDetect tests detecting qcow2 images by their magic.
+func TestDetect(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data     []byte
+		expected bool
+	}{
+		"DetectsQCOW2": {data: []byte("QFI\xfb\x00\x00\x00\x03"), expected: true},
+		"RejectsRaw":   {data: []byte("\xeb\x63\x90\x10"), expected: false},
+		"RejectsShort": {data: []byte("QF"), expected: false},
+		"RejectsEmpty": {data: nil, expected: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := qcow2.Detect(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, got)
+			}
+		})
+	}
+}
+
+// TestOpen tests rejecting qcow2 images that can't be read.
+func TestOpen(t *testing.T) {
+	for name, tc := range map[string]struct {
+		modify func(file []byte) []byte
+		err    string
+	}{
+		"RejectsTruncatedHeader": {
+			modify: func(file []byte) []byte { return file[:50] },
+			err:    "failed reading header",
+		},
+		"RejectsTruncatedVersion3Header": {
+			modify: func(file []byte) []byte { return file[:90] },
+			err:    "failed reading header",
+		},
+		"RejectsMissingMagic": {
+			modify: func(file []byte) []byte {
+				copy(file, "QFI\x00")
+				return file
+			},
+			err: "not a qcow2 image",
+		},
+		"RejectsUnsupportedVersion": {
+			modify: func(file []byte) []byte {
+				binary.BigEndian.PutUint32(file[4:], 4)
+				return file
+			},
+			err: "unsupported qcow2 version 4",
+		},
+		"RejectsBackingFile": {
+			modify: func(file []byte) []byte {
+				binary.BigEndian.PutUint64(file[8:], 512)
+				binary.BigEndian.PutUint32(file[16:], 10)
+				return file
+			},
+			err: "with a backing file are not supported",
+		},
+		"RejectsEncryption": {
+			modify: func(file []byte) []byte {
+				binary.BigEndian.PutUint32(file[32:], 2)
+				return file
+			},
+			err: "encrypted qcow2 images are not supported",
+		},
+		"RejectsCorrupt": {
+			modify: incompatibleFeatures(1 << 1),
+			err:    "marked corrupt",
+		},
+		"RejectsExternalDataFile": {
+			modify: incompatibleFeatures(1 << 2),
+			err:    "with an external data file are not supported",
+		},
+		"RejectsExtendedL2": {
+			modify: incompatibleFeatures(1 << 4),
+			err:    "with extended L2 entries are not supported",
+		},
+		"RejectsUnknownIncompatibleFeature": {
+			modify: incompatibleFeatures(1 << 5),
+			err:    "unsupported qcow2 incompatible features 0x20",
+		},
+		"RejectsZstd": {
+			modify: func(file []byte) []byte {
+				file = incompatibleFeatures(1 << 3)(file)
+				binary.BigEndian.PutUint32(file[100:], 112)
+				file[104] = 1
+				return file
+			},
+			err: "compressed with zstd are not supported",
+		},
+		"RejectsSmallClusterBits": {
+			modify: func(file []byte) []byte {
+				binary.BigEndian.PutUint32(file[20:], 8)
+				return file
+			},
+			err: "invalid qcow2 cluster bits 8",
+		},
+		"RejectsLargeClusterBits": {
+			modify: func(file []byte) []byte {
+				binary.BigEndian.PutUint32(file[20:], 22)
+				return file
+			},
+			err: "invalid qcow2 cluster bits 22",
+		},
+		"RejectsUndersizedL1Table": {
+			modify: func(file []byte) []byte {
+				// A single L2 table maps clusterSize/8 clusters.
+				size := uint64(clusterSize) * clusterSize / 8
+				binary.BigEndian.PutUint64(file[24:], size+1)
+				return file
+			},
+			err: "invalid qcow2 L1 table size 1",
+		},
+		"RejectsL1TablePastEnd": {
+			modify: func(file []byte) []byte {
+				binary.BigEndian.PutUint64(file[40:], uint64(len(file)))
+				return file
+			},
+			err: "failed reading L1 table",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := tc.modify(newTestImage(t))
+
+			_, err := qcow2.Open(bytes.NewReader(file))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+
+	t.Run("AcceptsZlibCompressionType", func(t *testing.T) {
+		file := incompatibleFeatures(1 << 3)(newTestImage(t))
+		binary.BigEndian.PutUint32(file[100:], 112)
+
+		if _, err := qcow2.Open(bytes.NewReader(file)); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("AcceptsDirty", func(t *testing.T) {
+		file := incompatibleFeatures(1 << 0)(newTestImage(t))
+
+		if _, err := qcow2.Open(bytes.NewReader(file)); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+// incompatibleFeatures returns a function that sets the incompatible feature
+// bits of an image to features.
+func incompatibleFeatures(features uint64) func(file []byte) []byte {
+	return func(file []byte) []byte {
+		binary.BigEndian.PutUint64(file[72:], features)
+		return file
+	}
+}
+
+// TestImage_ReadAt tests reading the guest data of qcow2 images.
+func TestImage_ReadAt(t *testing.T) {
+	t.Run("ReadsGuestData", func(t *testing.T) {
+		img, err := qcow2.Open(bytes.NewReader(newTestImage(t)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if img.Size() != int64(len(testData)) {
+			t.Errorf("expected size %d, got %d", len(testData), img.Size())
+		}
+
+		got, err := io.ReadAll(io.NewSectionReader(img, 0, img.Size()))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bytes.Equal(got, testData) {
+			t.Error("unexpected guest data")
+		}
+	})
+
+	t.Run("ReadsAcrossClusters", func(t *testing.T) {
+		img, err := qcow2.Open(bytes.NewReader(newTestImage(t)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// The read spans the end of the unallocated cluster and the start of
+		// the compressed cluster.
+		p := make([]byte, 200)
+		off := int64(3*clusterSize - 100)
+		if _, err := img.ReadAt(p, off); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bytes.Equal(p, testData[off:off+200]) {
+			t.Error("unexpected guest data")
+		}
+	})
+
+	t.Run("ReturnsEOFPastEnd", func(t *testing.T) {
+		img, err := qcow2.Open(bytes.NewReader(newTestImage(t)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		p := make([]byte, 200)
+		n, err := img.ReadAt(p, img.Size()-100)
+		if n != 100 || !errors.Is(err, io.EOF) {
+			t.Errorf("expected 100 bytes and EOF, got %d bytes and %v", n, err)
+		}
+	})
+
+	t.Run("RejectsTruncatedCompressedCluster", func(t *testing.T) {
+		file := newTestImage(t)
+		img, err := qcow2.Open(bytes.NewReader(file[:len(file)-10]))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = img.ReadAt(make([]byte, 512), 3*clusterSize)
+		if err == nil || !strings.Contains(err.Error(), "failed reading compressed cluster") {
+			t.Errorf("expected compressed cluster error, got %v", err)
+		}
+	})
+
+	t.Run("RejectsTruncatedDataCluster", func(t *testing.T) {
+		file := newTestImage(t)
+		img, err := qcow2.Open(bytes.NewReader(file[:dataOffset+100]))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = img.ReadAt(make([]byte, 512), 0)
+		if err == nil || !strings.Contains(err.Error(), "failed reading cluster") {
+			t.Errorf("expected cluster error, got %v", err)
+		}
+	})
+}
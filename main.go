@@ -11,7 +11,12 @@ import (
 	"github.com/hashicorp/packer-plugin-sdk/plugin"
 	"github.com/hashicorp/packer-plugin-sdk/version"
 	"github.com/oxidecomputer/packer-plugin-oxide/component/builder/instance"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/builder/iso"
 	"github.com/oxidecomputer/packer-plugin-oxide/component/data-source/image"
+	"github.com/oxidecomputer/packer-plugin-oxide/component/data-source/images"
+	imagecopy "github.com/oxidecomputer/packer-plugin-oxide/component/post-processor/image-copy"
+	imageprune "github.com/oxidecomputer/packer-plugin-oxide/component/post-processor/image-prune"
+	oxideimport "github.com/oxidecomputer/packer-plugin-oxide/component/post-processor/import"
 )
 
 var (
@@ -31,7 +36,12 @@ var (
 func main() {
 	pluginSet := plugin.NewSet()
 	pluginSet.RegisterBuilder("instance", new(instance.Builder))
+	pluginSet.RegisterBuilder("iso", new(iso.Builder))
 	pluginSet.RegisterDatasource("image", new(image.Datasource))
+	pluginSet.RegisterDatasource("images", new(images.Datasource))
+	pluginSet.RegisterPostProcessor("image-copy", new(imagecopy.PostProcessor))
+	pluginSet.RegisterPostProcessor("image-prune", new(imageprune.PostProcessor))
+	pluginSet.RegisterPostProcessor("import", new(oxideimport.PostProcessor))
 	pluginSet.SetVersion(
 		version.NewPluginVersion(Version, VersionPreRelease, VersionMetadata),
 	)